@@ -0,0 +1,112 @@
+// Package pubsub provides the broker embedded in the process, accessible without the HTTP server
+package pubsub
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/takashabe/go-pubsub/client"
+	"github.com/takashabe/go-pubsub/datastore"
+	"github.com/takashabe/go-pubsub/models"
+	"github.com/takashabe/go-pubsub/server"
+)
+
+// Broker is the pubsub broker in the process, the Brokers are isolated from each other
+type Broker struct {
+	store  *models.Store
+	server *server.Server
+
+	// stop is stop the sweeper of the expired messages
+	stop context.CancelFunc
+}
+
+// NewBroker return Broker on the datastore of the config, nil config is the new in-memory datastore.
+// the expired messages are swept until Close
+func NewBroker(cfg *datastore.Config) (*Broker, error) {
+	store, err := models.NewStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go store.RunRetentionSweeper(ctx, models.RetentionSweepInterval)
+
+	return &Broker{
+		store:  store,
+		server: server.NewServerWithStore(store),
+		stop:   cancel,
+	}, nil
+}
+
+// Close stop the sweeper of the expired messages and the push loops, and release the datastore
+func (b *Broker) Close() error {
+	b.stop()
+	return b.store.Close()
+}
+
+// Store return the Store of the Broker
+func (b *Broker) Store() *models.Store {
+	return b.store
+}
+
+// Handler return the REST API handler of the Broker, same as the pubsub server
+func (b *Broker) Handler() http.Handler {
+	return b.server.Routes()
+}
+
+// Client return the client accessing the Broker without HTTP
+func (b *Broker) Client(ctx context.Context) (*client.Client, error) {
+	return NewLocalClient(ctx, b.store)
+}
+
+// CreateTopic create the Topic
+func (b *Broker) CreateTopic(id string) (*models.Topic, error) {
+	t, err := b.store.NewTopic(id)
+	if err != nil {
+		return nil, err
+	}
+	b.store.Stats().GetTopicAdapter().AddTopic(t.Name, 1)
+	return t, nil
+}
+
+// Publish publish the message to the Topic, and return the message id
+func (b *Broker) Publish(topicID string, data []byte, attr map[string]string) (string, error) {
+	t, err := b.store.GetTopic(topicID)
+	if err != nil {
+		return "", err
+	}
+	id, err := t.Publish(data, attr)
+	if err != nil {
+		return "", err
+	}
+	b.store.Stats().GetTopicAdapter().AddMessage(t.Name, 1)
+	return id, nil
+}
+
+// Subscribe create the Subscription of the Topic with the options, same as the server and the client
+func (b *Broker) Subscribe(id, topicID string, opts models.SubscriptionOptions) (*models.Subscription, error) {
+	sub, err := b.store.NewSubscriptionWithOptions(id, topicID, opts)
+	if err != nil {
+		return nil, err
+	}
+	b.store.Stats().GetSubscriptionAdapter().AddSubscription(sub.Name, 1)
+	return sub, nil
+}
+
+// Pull returns readable messages of the Subscription,
+// when not exist readable messages, waits until published new message or ctx is done
+func (b *Broker) Pull(ctx context.Context, subID string, size int) ([]*models.PullMessage, error) {
+	sub, err := b.store.GetSubscription(subID)
+	if err != nil {
+		return nil, err
+	}
+	return sub.PullWait(ctx, size)
+}
+
+// Ack ack the messages of the Subscription
+func (b *Broker) Ack(subID string, ackIDs ...string) error {
+	sub, err := b.store.GetSubscription(subID)
+	if err != nil {
+		return err
+	}
+	return sub.Ack(ackIDs...)
+}
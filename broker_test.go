@@ -0,0 +1,188 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/takashabe/go-pubsub/datastore"
+	"github.com/takashabe/go-pubsub/models"
+)
+
+func setupBroker(t *testing.T) *Broker {
+	b, err := NewBroker(nil)
+	if err != nil {
+		t.Fatalf("failed to create broker, got err %v", err)
+	}
+	return b
+}
+
+func TestBrokerPublishAndAck(t *testing.T) {
+	b := setupBroker(t)
+	defer b.Close()
+	if _, err := b.CreateTopic("A"); err != nil {
+		t.Fatalf("failed to create topic, got err %v", err)
+	}
+	if _, err := b.Subscribe("a", "A", models.SubscriptionOptions{AckDeadline: 10 * time.Second}); err != nil {
+		t.Fatalf("failed to subscribe, got err %v", err)
+	}
+
+	cases := []struct {
+		publish    []string
+		expectData []string
+	}{
+		{[]string{"1"}, []string{"1"}},
+		{[]string{"2", "3"}, []string{"2", "3"}},
+	}
+	for i, c := range cases {
+		for _, d := range c.publish {
+			if _, err := b.Publish("A", []byte(d), nil); err != nil {
+				t.Fatalf("#%d: failed to publish, got err %v", i, err)
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		msgs, err := b.Pull(ctx, "a", 10)
+		cancel()
+		if err != nil {
+			t.Fatalf("#%d: failed to pull, got err %v", i, err)
+		}
+		got := []string{}
+		ackIDs := []string{}
+		for _, m := range msgs {
+			got = append(got, string(m.Message.Data))
+			ackIDs = append(ackIDs, m.AckID)
+		}
+		if !reflect.DeepEqual(got, c.expectData) {
+			t.Errorf("#%d: want %v, got %v", i, c.expectData, got)
+		}
+		if err := b.Ack("a", ackIDs...); err != nil {
+			t.Fatalf("#%d: failed to ack, got err %v", i, err)
+		}
+	}
+
+	// all messages are acked
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.Pull(ctx, "a", 10); err != models.ErrEmptyMessage {
+		t.Errorf("want %v, got %v", models.ErrEmptyMessage, err)
+	}
+}
+
+func TestBrokerHandler(t *testing.T) {
+	brokers := []*Broker{setupBroker(t), setupBroker(t)}
+	for _, b := range brokers {
+		defer b.Close()
+	}
+	if _, err := brokers[0].CreateTopic("A"); err != nil {
+		t.Fatalf("failed to create topic, got err %v", err)
+	}
+
+	cases := []struct {
+		broker *Broker
+		expect []string
+	}{
+		{brokers[0], []string{"A"}},
+		{brokers[1], []string{}},
+	}
+	for i, c := range cases {
+		ts := httptest.NewServer(c.broker.Handler())
+		res, err := http.Get(ts.URL + "/topic/")
+		if err != nil {
+			t.Fatalf("#%d: failed to request, got err %v", i, err)
+		}
+		var topics []struct {
+			Name string `json:"name"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&topics)
+		res.Body.Close()
+		ts.Close()
+		if err != nil {
+			t.Fatalf("#%d: failed to decode, got err %v", i, err)
+		}
+		got := []string{}
+		for _, topic := range topics {
+			got = append(got, topic.Name)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestBrokerStats(t *testing.T) {
+	brokers := []*Broker{setupBroker(t), setupBroker(t)}
+	for _, b := range brokers {
+		defer b.Close()
+	}
+	if _, err := brokers[0].CreateTopic("A"); err != nil {
+		t.Fatalf("failed to create topic, got err %v", err)
+	}
+
+	cases := []struct {
+		broker *Broker
+		expect float64
+	}{
+		{brokers[0], 1},
+		{brokers[1], 0},
+	}
+	for i, c := range cases {
+		b, err := c.broker.Store().Stats().TopicSummary()
+		if err != nil {
+			t.Fatalf("#%d: failed to get stats, got err %v", i, err)
+		}
+		var got map[string]float64
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("#%d: failed to decode, got err %v", i, err)
+		}
+		if got["topic.topic_num"] != c.expect {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got["topic.topic_num"])
+		}
+	}
+}
+
+func TestBrokerCloseAndReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsub")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := &datastore.Config{File: &datastore.FileConfig{Path: filepath.Join(dir, "pubsub.db")}}
+
+	cases := []struct {
+		create string
+		expect []string
+	}{
+		{"A", []string{"A"}},
+		{"B", []string{"A", "B"}},
+	}
+	for i, c := range cases {
+		b, err := NewBroker(cfg)
+		if err != nil {
+			t.Fatalf("#%d: failed to create broker, got err %v", i, err)
+		}
+		if _, err := b.CreateTopic(c.create); err != nil {
+			t.Fatalf("#%d: failed to create topic, got err %v", i, err)
+		}
+		topics, err := b.Store().ListTopic()
+		if err != nil {
+			t.Fatalf("#%d: failed to list topics, got err %v", i, err)
+		}
+		got := []string{}
+		for _, topic := range topics {
+			got = append(got, topic.Name)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+		if err := b.Close(); err != nil {
+			t.Fatalf("#%d: failed to close, got err %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// batching parameters of the ack and nack sent from the Message
+const (
+	ackFlushInterval = 100 * time.Millisecond
+	maxAckBatchSize  = 1000
+)
+
+// acker is batching ack and nack requests, and send them on a timer or size threshold
+type acker struct {
+	sub     *Subscription
+	ackIDs  []string
+	nackIDs []string
+	timer   *time.Timer
+	mu      sync.Mutex
+}
+
+func newAcker(sub *Subscription) *acker {
+	return &acker{
+		sub: sub,
+	}
+}
+
+// ack add AckID to the batch
+func (a *acker) ack(ackID string) {
+	a.mu.Lock()
+	a.ackIDs = append(a.ackIDs, ackID)
+	full := len(a.ackIDs) >= maxAckBatchSize
+	a.scheduleFlush()
+	a.mu.Unlock()
+
+	if full {
+		a.flush()
+	}
+}
+
+// nack add AckID to the batch
+func (a *acker) nack(ackID string) {
+	a.mu.Lock()
+	a.nackIDs = append(a.nackIDs, ackID)
+	full := len(a.nackIDs) >= maxAckBatchSize
+	a.scheduleFlush()
+	a.mu.Unlock()
+
+	if full {
+		a.flush()
+	}
+}
+
+// scheduleFlush require locked mutex
+func (a *acker) scheduleFlush() {
+	if a.timer == nil {
+		a.timer = time.AfterFunc(ackFlushInterval, a.flush)
+	}
+}
+
+// flush send all batched ack and nack.
+// the failed messages are redelivered after the ack deadline, so ignore the error.
+func (a *acker) flush() {
+	a.mu.Lock()
+	ackIDs, nackIDs := a.ackIDs, a.nackIDs
+	a.ackIDs, a.nackIDs = nil, nil
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.mu.Unlock()
+
+	ctx := context.Background()
+	if len(ackIDs) > 0 {
+		a.sub.Ack(ctx, ackIDs)
+	}
+	if len(nackIDs) > 0 {
+		a.sub.Nack(ctx, nackIDs)
+	}
+}
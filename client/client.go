@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // Message is a message sent to and received from the server
@@ -14,24 +16,68 @@ type Message struct {
 	Attributes  map[string]string `json:"attributes"`
 	AckID       string            `json:"-"`
 	PublishTime time.Time         `json:"publish_time"`
+	OrderingKey string            `json:"ordering_key"`
+
+	// DeliveryAttempt is number of the delivery on the Subscription, counted from 1
+	DeliveryAttempt int `json:"-"`
+
+	// sub is the Subscription received the message
+	sub *Subscription
+}
+
+// ErrNotReceivedMessage represent the message is not received from the Subscription
+var ErrNotReceivedMessage = errors.New("not received message from the subscription")
+
+// Ack acknowledges the message to the received Subscription.
+// the ack is sent asynchronously in batches.
+func (m *Message) Ack() error {
+	if m.sub == nil {
+		return ErrNotReceivedMessage
+	}
+	m.sub.ackAsync(m.AckID)
+	return nil
+}
+
+// Nack releases the message to the received Subscription, the message will be redelivered.
+// the nack is sent asynchronously in batches.
+func (m *Message) Nack() error {
+	if m.sub == nil {
+		return ErrNotReceivedMessage
+	}
+	m.sub.nackAsync(m.AckID)
+	return nil
+}
+
+// ModifyDeadline modify the ack deadline of the message, the deadline is counted from now.
+// during the Receive, the message is released from the Receive and no longer extended automatically.
+func (m *Message) ModifyDeadline(d time.Duration) error {
+	if m.sub == nil {
+		return ErrNotReceivedMessage
+	}
+	if r := m.sub.getReceiver(); r != nil {
+		r.done([]string{m.AckID})
+	}
+	return m.sub.modifyAckDeadline(context.Background(), d, []string{m.AckID})
 }
 
 // PublishMessage represent format of publish message
 type PublishMessage struct {
-	Data       []byte            `json:"data"`
-	Attributes map[string]string `json:"attributes"`
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	OrderingKey string            `json:"ordering_key,omitempty"`
 }
 
 func (m *Message) toPublish() PublishMessage {
 	return PublishMessage{
-		Data:       m.Data,
-		Attributes: m.Attributes,
+		Data:        m.Data,
+		Attributes:  m.Attributes,
+		OrderingKey: m.OrderingKey,
 	}
 }
 
 // Client is a client for server
 type Client struct {
-	s service
+	s Service
 }
 
 // NewClient returns a new pubsub client
@@ -55,6 +101,10 @@ func NewClient(ctx context.Context, addr string) (*Client, error) {
 				serverURL:  addr + "subscription/",
 				httpClient: httpClient,
 			},
+			snapshotter: &restSnapshotter{
+				serverURL:  addr + "snapshot/",
+				httpClient: httpClient,
+			},
 			monitoring: &restMonitoring{
 				serverURL:  addr + "stats/",
 				httpClient: httpClient,
@@ -63,9 +113,22 @@ func NewClient(ctx context.Context, addr string) (*Client, error) {
 	}, nil
 }
 
+// NewClientWithService returns a new pubsub client accessing the server through the Service
+func NewClientWithService(ctx context.Context, s Service) (*Client, error) {
+	if s == nil {
+		return nil, errors.New("require non-nil service")
+	}
+	return &Client{s: s}, nil
+}
+
 // CreateTopic creates new Topic
 func (c *Client) CreateTopic(ctx context.Context, id string) (*Topic, error) {
-	err := c.s.createTopic(ctx, id)
+	return c.CreateTopicWithConfig(ctx, id, TopicConfig{})
+}
+
+// CreateTopicWithConfig creates new Topic with the configuration
+func (c *Client) CreateTopicWithConfig(ctx context.Context, id string, cfg TopicConfig) (*Topic, error) {
+	err := c.s.CreateTopic(ctx, id, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -80,7 +143,7 @@ func (c *Client) Topic(id string) *Topic {
 
 // Topics returns existing the topic list
 func (c *Client) Topics(ctx context.Context) ([]*Topic, error) {
-	ids, err := c.s.listTopics(ctx)
+	ids, err := c.s.ListTopics(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -93,7 +156,7 @@ func (c *Client) Topics(ctx context.Context) ([]*Topic, error) {
 
 // CreateSubscription creates new Subscription
 func (c *Client) CreateSubscription(ctx context.Context, id string, cfg SubscriptionConfig) (*Subscription, error) {
-	err := c.s.createSubscription(ctx, id, cfg)
+	err := c.s.CreateSubscription(ctx, id, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -108,7 +171,7 @@ func (c *Client) Subscription(id string) *Subscription {
 
 // Subscriptions returns all existing the subscription list
 func (c *Client) Subscriptions(ctx context.Context) ([]*Subscription, error) {
-	ids, err := c.s.listSubscriptions(ctx)
+	ids, err := c.s.ListSubscriptions(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -119,7 +182,35 @@ func (c *Client) Subscriptions(ctx context.Context) ([]*Subscription, error) {
 	return subscriptions, nil
 }
 
+// CreateSnapshot creates new Snapshot captured the unacked messages of the Subscription
+func (c *Client) CreateSnapshot(ctx context.Context, id string, cfg SnapshotConfig) (*Snapshot, error) {
+	err := c.s.CreateSnapshot(ctx, id, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSnapshot(id, c.s), nil
+}
+
+// Snapshot returns reference of the snapshot
+func (c *Client) Snapshot(id string) *Snapshot {
+	return newSnapshot(id, c.s)
+}
+
+// Snapshots returns all existing the snapshot list
+func (c *Client) Snapshots(ctx context.Context) ([]*Snapshot, error) {
+	ids, err := c.s.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []*Snapshot{}
+	for _, id := range ids {
+		snapshots = append(snapshots, newSnapshot(id, c.s))
+	}
+	return snapshots, nil
+}
+
 // Stats returns stats summary
 func (c *Client) Stats(ctx context.Context) ([]byte, error) {
-	return c.s.statsSummary(ctx)
+	return c.s.StatsSummary(ctx)
 }
@@ -3,10 +3,12 @@ package client
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,7 +23,7 @@ func setupServer(t *testing.T) *httptest.Server {
 	if err := s.PrepareServer(); err != nil {
 		t.Fatalf("failed to PrepareServer, error=%v", err)
 	}
-	return httptest.NewServer(server.Routes())
+	return httptest.NewServer(s.Routes())
 }
 
 func createDummyTopics(t *testing.T, ts *httptest.Server) {
@@ -382,6 +384,101 @@ func TestPublish(t *testing.T) {
 	}
 }
 
+func TestPublishBatch(t *testing.T) {
+	s, err := server.NewServer("testdata/config.yaml")
+	if err != nil {
+		t.Fatalf("failed to server.NewServer, error=%v", err)
+	}
+	if err := s.PrepareServer(); err != nil {
+		t.Fatalf("failed to PrepareServer, error=%v", err)
+	}
+	// count the publish requests
+	var mu sync.Mutex
+	publishCount := 0
+	routes := s.Routes()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/publish") {
+			mu.Lock()
+			publishCount++
+			mu.Unlock()
+		}
+		routes.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+
+	topic := client.Topic("topic1")
+	topic.PublishSettings = PublishSettings{
+		DelayThreshold: time.Minute,
+		CountThreshold: 2,
+	}
+	results := []*PublishResult{}
+	for i := 0; i < 3; i++ {
+		results = append(results, topic.Publish(ctx, &Message{Data: []byte(fmt.Sprintf("msg%d", i))}))
+	}
+
+	// sent the first batch by CountThreshold
+	for i, r := range results[:2] {
+		if _, err := r.Get(ctx); err != nil {
+			t.Fatalf("#%d: want non-error, got %v", i, err)
+		}
+	}
+	select {
+	case <-results[2].done:
+		t.Errorf("want not yet sent the last message")
+	default:
+	}
+
+	// sent the rest by the Stop
+	topic.Stop()
+	ids := map[string]bool{}
+	for i, r := range results {
+		id, err := r.Get(ctx)
+		if err != nil {
+			t.Fatalf("#%d: want non-error, got %v", i, err)
+		}
+		ids[id] = true
+	}
+	if len(ids) != len(results) {
+		t.Errorf("want unique message ids %d, got %v", len(results), ids)
+	}
+	if want := 2; publishCount != want {
+		t.Errorf("want publish request count %d, got %d", want, publishCount)
+	}
+
+	// publish after the Stop
+	if _, err := topic.Publish(ctx, &Message{}).Get(ctx); err != ErrTopicStopped {
+		t.Errorf("want error %v, got %v", ErrTopicStopped, err)
+	}
+
+	// exceeded BufferedByteLimit
+	topic = client.Topic("topic1")
+	topic.PublishSettings = PublishSettings{BufferedByteLimit: 1}
+	if _, err := topic.Publish(ctx, &Message{Data: []byte(`msg`)}).Get(ctx); err != ErrOverflow {
+		t.Errorf("want error %v, got %v", ErrOverflow, err)
+	}
+
+	// ctx done before the batch is sent
+	topic = client.Topic("topic1")
+	topic.PublishSettings = PublishSettings{DelayThreshold: time.Minute}
+	cctx, cancel := context.WithCancel(ctx)
+	canceled := topic.Publish(cctx, &Message{Data: []byte(`canceled`)})
+	sent := topic.Publish(ctx, &Message{Data: []byte(`sent`)})
+	cancel()
+	topic.Stop()
+	if _, err := canceled.Get(ctx); err != context.Canceled {
+		t.Errorf("want error %v, got %v", context.Canceled, err)
+	}
+	if _, err := sent.Get(ctx); err != nil {
+		t.Errorf("want non-error, got %v", err)
+	}
+}
+
 func TestReceiveAndAck(t *testing.T) {
 	ts := setupServer(t)
 	defer ts.Close()
@@ -407,33 +504,75 @@ func TestReceiveAndAck(t *testing.T) {
 		msgIDs := publishMessages(t, client.Topic("topic1"), c.inputs)
 
 		sub := client.Subscription("sub1")
-		ackIDs := []string{}
-		for j := 0; j < len(msgIDs); j++ {
-			err := sub.Receive(ctx, func(ctx context.Context, msg *Message) {
-				// expect: the received message ID exists in recently published messages
-				contain := false
-				for _, pid := range msgIDs {
-					if msg.ID == pid {
-						contain = true
-						break
-					}
+		cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		var mu sync.Mutex
+		received := 0
+		err := sub.Receive(cctx, func(ctx context.Context, msg *Message) {
+			// expect: the received message ID exists in recently published messages
+			contain := false
+			for _, pid := range msgIDs {
+				if msg.ID == pid {
+					contain = true
+					break
 				}
-				if !contain {
-					t.Errorf("#%d: want message id %s contain publish messaged", i, msg.ID)
-				}
-
-				// collect AckID
-				ackIDs = append(ackIDs, msg.AckID)
-			})
-			if err != nil {
-				t.Fatalf("#%d: want non-error, got %v", i, err)
 			}
-		}
+			if !contain {
+				t.Errorf("#%d: want message id %s contain publish messaged", i, msg.ID)
+			}
+			if err := sub.Ack(ctx, []string{msg.AckID}); err != nil {
+				t.Errorf("#%d: want non-error, got %v", i, err)
+			}
 
-		err := sub.Ack(ctx, ackIDs)
+			mu.Lock()
+			defer mu.Unlock()
+			received++
+			if received == len(msgIDs) {
+				cancel()
+			}
+		})
+		cancel()
 		if err != nil {
 			t.Fatalf("#%d: want non-error, got %v", i, err)
 		}
+		if received != len(msgIDs) {
+			t.Errorf("#%d: want received %d messages, got %d", i, len(msgIDs), received)
+		}
+	}
+}
+
+func TestReceiveExtendAckDeadline(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	createDummySubscriptions(t, ts, client.Topic("topic1"))
+	publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
+
+	// handler takes longer than the ack deadline
+	sub := client.Subscription("sub1")
+	sub.ReceiveSettings = ReceiveSettings{NumGoroutines: 1}
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	received := 0
+	err = sub.Receive(cctx, func(ctx context.Context, msg *Message) {
+		mu.Lock()
+		received++
+		mu.Unlock()
+		time.Sleep(2500 * time.Millisecond)
+		sub.Ack(ctx, []string{msg.AckID})
+		cancel()
+	})
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	// want not redelivered while the handler running
+	if received != 1 {
+		t.Errorf("want received 1 message, got %d", received)
 	}
 }
 
@@ -458,7 +597,7 @@ func TestAckAndNack(t *testing.T) {
 					t.Errorf("want non error, got %v", err)
 				}
 				// expect can't pull message after the Ack
-				err = sub.Receive(ctx, func(ctx context.Context, msg *Message) {})
+				_, err = sub.Pull(ctx, 1)
 				if err != ErrNotFoundMessage {
 					t.Errorf("want error %v, got %v", ErrNotFoundMessage, err)
 				}
@@ -470,8 +609,8 @@ func TestAckAndNack(t *testing.T) {
 				if err != nil {
 					t.Errorf("want non error, got %v", err)
 				}
-				// expect can't pull message after the Ack
-				err = sub.Receive(ctx, func(ctx context.Context, msg *Message) {})
+				// expect can pull message after the Nack
+				_, err = sub.Pull(ctx, 1)
 				if err != nil {
 					t.Errorf("want non error, got %v", err)
 				}
@@ -486,14 +625,393 @@ func TestAckAndNack(t *testing.T) {
 			t.Fatalf("#%d: want non error, got %v", i, err)
 		}
 
-		// publish and receive one message
+		// publish and pull one message
 		publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
-		var ackIDs []string
-		sub.Receive(ctx, func(ctx context.Context, msg *Message) {
-			ackIDs = []string{msg.AckID}
+		msgs, err := sub.Pull(ctx, 1)
+		if err != nil {
+			t.Fatalf("#%d: want non error, got %v", i, err)
+		}
+		c.fn(sub, []string{msgs[0].AckID})
+	}
+}
+
+func TestAckExactlyOnce(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub1", SubscriptionConfig{
+		Topic:                     client.Topic("topic1"),
+		EnableExactlyOnceDelivery: true,
+	})
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
+	msgs, err := sub.Pull(ctx, 1)
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+
+	// second ack is failed
+	if err := sub.Ack(ctx, []string{msgs[0].AckID}); err != nil {
+		t.Errorf("want non error, got %v", err)
+	}
+	err = sub.Ack(ctx, []string{msgs[0].AckID})
+	ackErr, ok := err.(*AckError)
+	if !ok {
+		t.Fatalf("want *AckError, got %v", err)
+	}
+	if want := []string{msgs[0].AckID}; !reflect.DeepEqual(ackErr.AckIDs, want) {
+		t.Errorf("want %v, got %v", want, ackErr.AckIDs)
+	}
+}
+
+func TestSeekToTime(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub1", SubscriptionConfig{
+		Topic:               client.Topic("topic1"),
+		RetainAckedMessages: true,
+	})
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
+	msgs, err := sub.Pull(ctx, 1)
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if err := sub.Ack(ctx, []string{msgs[0].AckID}); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+
+	// acked message is redelivered
+	if err := sub.SeekToTime(ctx, time.Time{}); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	msgs, err = sub.Pull(ctx, 1)
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if got := string(msgs[0].Data); got != "msg1" {
+		t.Errorf("want msg1, got %s", got)
+	}
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub1", SubscriptionConfig{
+		Topic: client.Topic("topic1"),
+	})
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
+	snap, err := client.CreateSnapshot(ctx, "snap1", SnapshotConfig{Subscription: sub})
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	cfg, err := snap.Config(ctx)
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if got := cfg.Topic.ID; got != "topic1" {
+		t.Errorf("want topic1, got %s", got)
+	}
+
+	// acked message is redelivered by restore
+	msgs, err := sub.Pull(ctx, 1)
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if err := sub.Ack(ctx, []string{msgs[0].AckID}); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if err := sub.RestoreSnapshot(ctx, snap); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	msgs, err = sub.Pull(ctx, 1)
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if got := string(msgs[0].Data); got != "msg1" {
+		t.Errorf("want msg1, got %s", got)
+	}
+
+	if err := snap.Delete(ctx); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if err := sub.RestoreSnapshot(ctx, snap); err == nil {
+		t.Errorf("want error for the deleted snapshot, got nil")
+	}
+}
+
+func TestMessageAckAndNack(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+
+	cases := []struct {
+		fn        func(msg *Message)
+		expectErr error
+	}{
+		{func(msg *Message) { msg.Ack() }, ErrNotFoundMessage},
+		{func(msg *Message) { msg.Nack() }, nil},
+		{func(msg *Message) { msg.ModifyDeadline(0) }, nil},
+		{func(msg *Message) { msg.ModifyDeadline(time.Minute) }, ErrNotFoundMessage},
+	}
+	for i, c := range cases {
+		sub, err := client.CreateSubscription(ctx, fmt.Sprintf("sub-%d", i), SubscriptionConfig{
+			Topic: client.Topic("topic1"),
 		})
+		if err != nil {
+			t.Fatalf("#%d: want non error, got %v", i, err)
+		}
+		publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
+		msgs, err := sub.Pull(ctx, 1)
+		if err != nil {
+			t.Fatalf("#%d: want non error, got %v", i, err)
+		}
+
+		c.fn(msgs[0])
+		// wait flush the batched ack
+		time.Sleep(2 * ackFlushInterval)
+		if _, err := sub.Pull(ctx, 1); err != c.expectErr {
+			t.Errorf("#%d: want error %v, got %v", i, c.expectErr, err)
+		}
+	}
+
+	// not received message
+	notReceived := []func(msg *Message) error{
+		func(msg *Message) error { return msg.Ack() },
+		func(msg *Message) error { return msg.Nack() },
+		func(msg *Message) error { return msg.ModifyDeadline(time.Second) },
+	}
+	for i, fn := range notReceived {
+		if err := fn(&Message{}); err != ErrNotReceivedMessage {
+			t.Errorf("#%d: want error %v, got %v", i, ErrNotReceivedMessage, err)
+		}
+	}
+}
+
+func TestReceiveWithMessageAck(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	createDummySubscriptions(t, ts, client.Topic("topic1"))
+	msgIDs := publishDummyMessage(t, client.Topic("topic1"))
+
+	sub := client.Subscription("sub1")
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	received := 0
+	err = sub.Receive(cctx, func(ctx context.Context, msg *Message) {
+		msg.Ack()
+
+		mu.Lock()
+		defer mu.Unlock()
+		received++
+		if received == len(msgIDs) {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+
+	// expect flushed acks at the end of the Receive
+	if _, err := sub.Pull(ctx, 1); err != ErrNotFoundMessage {
+		t.Errorf("want error %v, got %v", ErrNotFoundMessage, err)
+	}
+}
+
+func TestReceiveWithMaxOutstanding(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	createDummySubscriptions(t, ts, client.Topic("topic1"))
+	msgIDs := publishDummyMessage(t, client.Topic("topic1"))
+
+	sub := client.Subscription("sub1")
+	sub.ReceiveSettings = ReceiveSettings{
+		MaxOutstandingMessages: 1,
+	}
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	received := []string{}
+	err = sub.Receive(cctx, func(ctx context.Context, msg *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, msg.ID)
+		// next message is pulled after the ack, because of MaxOutstandingMessages
+		if err := sub.Ack(ctx, []string{msg.AckID}); err != nil {
+			t.Errorf("want non-error, got %v", err)
+		}
+		if len(received) == len(msgIDs) {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	sort.Strings(received)
+	sort.Strings(msgIDs)
+	if !reflect.DeepEqual(msgIDs, received) {
+		t.Errorf("want received messages %v, got %v", msgIDs, received)
+	}
+}
+
+func TestReceiveWithModifyDeadline(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	createDummySubscriptions(t, ts, client.Topic("topic1"))
+	msgIDs := publishDummyMessage(t, client.Topic("topic1"))
+
+	sub := client.Subscription("sub1")
+	sub.ReceiveSettings = ReceiveSettings{
+		MaxOutstandingMessages: 1,
+	}
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	received := []string{}
+	err = sub.Receive(cctx, func(ctx context.Context, msg *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, msg.ID)
+		// next message is pulled without the ack, because the message is released from the Receive
+		if err := msg.ModifyDeadline(time.Minute); err != nil {
+			t.Errorf("want non-error, got %v", err)
+		}
+		if len(received) == len(msgIDs) {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	sort.Strings(received)
+	sort.Strings(msgIDs)
+	if !reflect.DeepEqual(msgIDs, received) {
+		t.Errorf("want received messages %v, got %v", msgIDs, received)
+	}
+
+	// expect not nacked at the end of the Receive
+	_, err = sub.Pull(ctx, 1)
+	if err != ErrNotFoundMessage {
+		t.Errorf("want error %v, got %v", ErrNotFoundMessage, err)
+	}
+}
+
+func TestReceiveStreaming(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	createDummySubscriptions(t, ts, client.Topic("topic1"))
+	msgIDs := publishDummyMessage(t, client.Topic("topic1"))
+
+	sub := client.Subscription("sub1")
+	sub.ReceiveSettings = ReceiveSettings{
+		Streaming:              true,
+		MaxOutstandingMessages: 1,
+	}
+	cctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	received := []string{}
+	err = sub.Receive(cctx, func(ctx context.Context, msg *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, msg.ID)
+		// next message is not arrived until the ack, because of MaxOutstandingMessages
+		if err := sub.Ack(ctx, []string{msg.AckID}); err != nil {
+			t.Errorf("want non-error, got %v", err)
+		}
+		// the failure of the second ack is returned from the stream
+		if err := sub.Ack(ctx, []string{msg.AckID}); err == nil {
+			t.Errorf("want *AckError, got nil")
+		} else if _, ok := err.(*AckError); !ok {
+			t.Errorf("want *AckError, got %v", err)
+		}
+		if len(received) == len(msgIDs) {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	sort.Strings(received)
+	sort.Strings(msgIDs)
+	if !reflect.DeepEqual(msgIDs, received) {
+		t.Errorf("want received messages %v, got %v", msgIDs, received)
+	}
+
+	// expect can't pull message after the Ack
+	_, err = sub.Pull(ctx, 1)
+	if err != ErrNotFoundMessage {
+		t.Errorf("want error %v, got %v", ErrNotFoundMessage, err)
+	}
+}
+
+func TestStreamingPullCanceled(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	client, err := NewClient(context.Background(), ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
 
-		c.fn(sub, ackIDs)
+	// the dial is aborted by ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.s.StreamingPull(ctx, "sub1", 1); err == nil {
+		t.Errorf("want error, got nil")
 	}
 }
 
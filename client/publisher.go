@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// publish errors
+var (
+	ErrOverflow     = errors.New("exceeded buffered byte limit of the publish")
+	ErrTopicStopped = errors.New("topic already stopped")
+)
+
+// PublishSettings represent parameter of the batching publish.
+// If the parameter less than or equal to 0, used DefaultPublishSettings.
+type PublishSettings struct {
+	// DelayThreshold is maximum waiting time until send the batch
+	DelayThreshold time.Duration
+
+	// CountThreshold is number of the messages to send the batch
+	CountThreshold int
+
+	// ByteThreshold is bytes of the messages to send the batch
+	ByteThreshold int
+
+	// NumGoroutines is number of the goroutines sends the batch concurrently
+	NumGoroutines int
+
+	// BufferedByteLimit is maximum bytes of the messages waiting for send.
+	// Publish returns ErrOverflow when exceeded.
+	BufferedByteLimit int
+}
+
+// DefaultPublishSettings is default parameter of the Publish
+var DefaultPublishSettings = PublishSettings{
+	DelayThreshold:    10 * time.Millisecond,
+	CountThreshold:    100,
+	ByteThreshold:     1e6,
+	NumGoroutines:     10,
+	BufferedByteLimit: 1e8,
+}
+
+// publishSettings returns PublishSettings filled default parameter
+func (t *Topic) publishSettings() PublishSettings {
+	ps := t.PublishSettings
+	if ps.DelayThreshold <= 0 {
+		ps.DelayThreshold = DefaultPublishSettings.DelayThreshold
+	}
+	if ps.CountThreshold <= 0 {
+		ps.CountThreshold = DefaultPublishSettings.CountThreshold
+	}
+	if ps.ByteThreshold <= 0 {
+		ps.ByteThreshold = DefaultPublishSettings.ByteThreshold
+	}
+	if ps.NumGoroutines <= 0 {
+		ps.NumGoroutines = DefaultPublishSettings.NumGoroutines
+	}
+	if ps.BufferedByteLimit <= 0 {
+		ps.BufferedByteLimit = DefaultPublishSettings.BufferedByteLimit
+	}
+	return ps
+}
+
+// publishItem is pair of the message and the result
+type publishItem struct {
+	ctx    context.Context
+	msg    *Message
+	result *PublishResult
+	size   int
+}
+
+// publisher is batching the messages, and send them on a threshold
+type publisher struct {
+	topicID  string
+	s        Service
+	settings PublishSettings
+	// ordered is whether send the batches one by one in publish order
+	ordered bool
+
+	pending      []*publishItem
+	pendingBytes int
+	// bufferedBytes is bytes of the pending and sending messages
+	bufferedBytes int
+	timer         *time.Timer
+	stopped       bool
+	sem           chan struct{}
+	// lastSent is closed when the last batch is sent, used when ordered
+	lastSent chan struct{}
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+}
+
+func newPublisher(topicID string, s Service, settings PublishSettings, ordered bool) *publisher {
+	return &publisher{
+		topicID:  topicID,
+		s:        s,
+		settings: settings,
+		ordered:  ordered,
+		sem:      make(chan struct{}, settings.NumGoroutines),
+	}
+}
+
+// messageSize returns approximate bytes of the message
+func messageSize(msg *Message) int {
+	size := len(msg.Data)
+	for k, v := range msg.Attributes {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// add append the message to the batch
+func (p *publisher) add(ctx context.Context, msg *Message, pr *PublishResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		pr.set("", ErrTopicStopped)
+		return
+	}
+	size := messageSize(msg)
+	if p.bufferedBytes+size > p.settings.BufferedByteLimit {
+		pr.set("", ErrOverflow)
+		return
+	}
+	if len(p.pending) > 0 && p.pendingBytes+size > p.settings.ByteThreshold {
+		p.flushLocked()
+	}
+
+	p.pending = append(p.pending, &publishItem{ctx: ctx, msg: msg, result: pr, size: size})
+	p.pendingBytes += size
+	p.bufferedBytes += size
+	if len(p.pending) >= p.settings.CountThreshold || p.pendingBytes >= p.settings.ByteThreshold {
+		p.flushLocked()
+		return
+	}
+	if p.timer == nil {
+		p.timer = time.AfterFunc(p.settings.DelayThreshold, p.flush)
+	}
+}
+
+// flush send the pending batch
+func (p *publisher) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flushLocked()
+}
+
+// flushLocked require locked mutex
+func (p *publisher) flushLocked() {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if len(p.pending) == 0 {
+		return
+	}
+	items := p.pending
+	p.pending = nil
+	p.pendingBytes = 0
+
+	// wait for the previous batch when ordered
+	var prev, sent chan struct{}
+	if p.ordered {
+		prev, sent = p.lastSent, make(chan struct{})
+		p.lastSent = sent
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		if sent != nil {
+			defer close(sent)
+		}
+		if prev != nil {
+			<-prev
+		}
+		p.sem <- struct{}{}
+		defer func() { <-p.sem }()
+		p.send(items)
+	}()
+}
+
+// send publish the batch, and resolve the results.
+// the messages of the done ctx are not sent, and the batch is sent by ctx of the first message.
+func (p *publisher) send(items []*publishItem) {
+	size := 0
+	sending := make([]*publishItem, 0, len(items))
+	for _, item := range items {
+		size += item.size
+		if err := item.ctx.Err(); err != nil {
+			item.result.set("", err)
+			continue
+		}
+		sending = append(sending, item)
+	}
+	defer func() {
+		p.mu.Lock()
+		p.bufferedBytes -= size
+		p.mu.Unlock()
+	}()
+	if len(sending) == 0 {
+		return
+	}
+
+	msgs := make([]*Message, 0, len(sending))
+	for _, item := range sending {
+		msgs = append(msgs, item.msg)
+	}
+	ids, err := p.s.PublishMessages(sending[0].ctx, p.topicID, msgs)
+	for i, item := range sending {
+		if err != nil {
+			item.result.set("", err)
+			continue
+		}
+		item.result.set(ids[i], nil)
+	}
+}
+
+// stop send all pending messages, and wait for done
+func (p *publisher) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.flushLocked()
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
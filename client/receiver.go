@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// receivePullWait is waiting time of the Pull API in the Receive
+const receivePullWait = 10 * time.Second
+
+// defaultAckDeadline is used when unknown ack deadline of the Subscription
+const defaultAckDeadline = 10 * time.Second
+
+// receiver is holds the received but not yet acked messages in the Receive
+type receiver struct {
+	sub         *Subscription
+	settings    ReceiveSettings
+	ackDeadline time.Duration
+
+	// inflight is pairs of the AckID and the received time
+	inflight map[string]time.Time
+	// reserved is number of the messages being fetched
+	reserved int
+	released chan struct{}
+	mu       sync.Mutex
+}
+
+func newReceiver(sub *Subscription, settings ReceiveSettings, ackDeadline time.Duration) *receiver {
+	if ackDeadline <= 0 {
+		ackDeadline = defaultAckDeadline
+	}
+	return &receiver{
+		sub:         sub,
+		settings:    settings,
+		ackDeadline: ackDeadline,
+		inflight:    make(map[string]time.Time),
+		released:    make(chan struct{}, 1),
+	}
+}
+
+// acquire waits until the message can be received, and returns number of the receivable messages
+func (r *receiver) acquire(ctx context.Context) (int, error) {
+	for {
+		r.mu.Lock()
+		n := r.settings.MaxOutstandingMessages - len(r.inflight) - r.reserved
+		if n > 0 {
+			r.reserved += n
+			r.mu.Unlock()
+			return n, nil
+		}
+		r.mu.Unlock()
+
+		select {
+		case <-r.released:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// release returns reserved number by the acquire
+func (r *receiver) release(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reserved -= n
+}
+
+// add mark messages as inflight
+func (r *receiver) add(msgs []*Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, msg := range msgs {
+		r.inflight[msg.AckID] = now
+	}
+}
+
+// done remove messages from inflight
+func (r *receiver) done(ackIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range ackIDs {
+		delete(r.inflight, id)
+	}
+	r.notifyReleased()
+}
+
+// pending returns AckIDs of the inflight messages
+func (r *receiver) pending() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.inflight))
+	for id := range r.inflight {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// notifyReleased require locked mutex
+func (r *receiver) notifyReleased() {
+	select {
+	case r.released <- struct{}{}:
+	default:
+	}
+}
+
+// keepAlive periodically extends the ack deadline of the inflight messages until ctx is done.
+// the messages exceeded MaxExtension are no longer extended.
+func (r *receiver) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(r.ackDeadline / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ackIDs := r.extendable()
+		if len(ackIDs) == 0 {
+			continue
+		}
+		r.sub.modifyAckDeadline(ctx, r.ackDeadline, ackIDs)
+	}
+}
+
+// extendable returns AckIDs to be extended the ack deadline, and drop the messages exceeded MaxExtension
+func (r *receiver) extendable() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := []string{}
+	expired := false
+	for id, received := range r.inflight {
+		if time.Since(received) > r.settings.MaxExtension {
+			delete(r.inflight, id)
+			expired = true
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if expired {
+		r.notifyReleased()
+	}
+	return ids
+}
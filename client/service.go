@@ -8,45 +8,67 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 )
 
-// service is an accessor to server API used by this package
-type service interface {
+// Service is an accessor to server API used by the Client,
+// the Client on the other transport is created by NewClientWithService
+type Service interface {
 	// handle topic
-	createTopic(ctx context.Context, id string) error
-	deleteTopic(ctx context.Context, id string) error
-	topicExists(ctx context.Context, id string) (bool, error)
-	listTopics(ctx context.Context) ([]string, error)
-	listTopicSubscriptions(ctx context.Context, id string) ([]string, error)
+	CreateTopic(ctx context.Context, id string, cfg TopicConfig) error
+	DeleteTopic(ctx context.Context, id string) error
+	TopicExists(ctx context.Context, id string) (bool, error)
+	ListTopics(ctx context.Context) ([]string, error)
+	ListTopicSubscriptions(ctx context.Context, id string) ([]string, error)
 
 	// handle subscription
-	createSubscription(ctx context.Context, id string, cfg SubscriptionConfig) error
-	getSubscriptionConfig(ctx context.Context, id string) (*SubscriptionConfig, error)
-	listSubscriptions(ctx context.Context) ([]string, error)
-	deleteSubscription(ctx context.Context, id string) error
-	subscriptionExists(ctx context.Context, id string) (bool, error)
-	modifyPushConfig(ctx context.Context, id string, cfg *PushConfig) error
+	CreateSubscription(ctx context.Context, id string, cfg SubscriptionConfig) error
+	GetSubscriptionConfig(ctx context.Context, id string) (*SubscriptionConfig, error)
+	ListSubscriptions(ctx context.Context) ([]string, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	SubscriptionExists(ctx context.Context, id string) (bool, error)
+	ModifyPushConfig(ctx context.Context, id string, cfg *PushConfig) error
+	Seek(ctx context.Context, id string, t time.Time) error
+	RestoreSnapshot(ctx context.Context, id, snapshotID string) error
+
+	// handle snapshot
+	CreateSnapshot(ctx context.Context, id string, cfg SnapshotConfig) error
+	GetSnapshotConfig(ctx context.Context, id string) (*SnapshotConfig, error)
+	ListSnapshots(ctx context.Context) ([]string, error)
+	DeleteSnapshot(ctx context.Context, id string) error
 
 	// handle message
-	modifyAckDeadline(ctx context.Context, subID string, deadline time.Duration, ackIDs []string) error
-	pullMessages(ctx context.Context, subID string, maxMessages int) ([]*Message, error)
-	publishMessages(ctx context.Context, topicID string, msg *Message) (string, error)
-	ack(ctx context.Context, subID string, ackIDs []string) error
+	ModifyAckDeadline(ctx context.Context, subID string, deadline time.Duration, ackIDs []string) error
+	PullMessages(ctx context.Context, subID string, maxMessages int, maxWait time.Duration) ([]*Message, error)
+	PublishMessages(ctx context.Context, topicID string, msgs []*Message) ([]string, error)
+	Ack(ctx context.Context, subID string, ackIDs []string) error
+	StreamingPull(ctx context.Context, subID string, maxOutstanding int) (MessageStream, error)
 
 	// monitoring
-	statsSummary(ctx context.Context) ([]byte, error)
-	statsTopicDetail(ctx context.Context, id string) ([]byte, error)
-	statsSubscriptionDetail(ctx context.Context, id string) ([]byte, error)
+	StatsSummary(ctx context.Context) ([]byte, error)
+	StatsTopicDetail(ctx context.Context, id string) ([]byte, error)
+	StatsSubscriptionDetail(ctx context.Context, id string) ([]byte, error)
 }
 
-// restService implemnet service interface for HTTP protocol
+// MessageStream is a bidirectional stream of the streaming pull,
+// Ack and ModifyAckDeadline are called concurrently with Recv
+type MessageStream interface {
+	Recv() ([]*Message, error)
+	Ack(ackIDs []string) error
+	ModifyAckDeadline(deadline time.Duration, ackIDs []string) error
+	Close() error
+}
+
+// restService implemnet Service interface for HTTP protocol
 type restService struct {
-	publisher  *restPublisher
-	subscriber *restSubscriber
-	monitoring *restMonitoring
+	publisher   *restPublisher
+	subscriber  *restSubscriber
+	snapshotter *restSnapshotter
+	monitoring  *restMonitoring
 }
 
 type restPublisher struct {
@@ -59,6 +81,11 @@ type restSubscriber struct {
 	httpClient http.Client
 }
 
+type restSnapshotter struct {
+	serverURL  string
+	httpClient http.Client
+}
+
 type restMonitoring struct {
 	serverURL  string
 	httpClient http.Client
@@ -72,6 +99,10 @@ func (s *restSubscriber) sendRequest(ctx context.Context, method, url string, bo
 	return sendRequest(ctx, s.httpClient, method, s.serverURL+url, body)
 }
 
+func (s *restSnapshotter) sendRequest(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	return sendRequest(ctx, s.httpClient, method, s.serverURL+url, body)
+}
+
 func (s *restMonitoring) sendRequest(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
 	return sendRequest(ctx, s.httpClient, method, s.serverURL+url, body)
 }
@@ -86,8 +117,24 @@ func sendRequest(ctx context.Context, client http.Client, method, url string, bo
 	return client.Do(req)
 }
 
-func (s *restService) createTopic(ctx context.Context, id string) error {
-	res, err := s.publisher.sendRequest(ctx, "PUT", id, nil)
+// ResourceTopic represent body of request/response the Topic parameter
+type ResourceTopic struct {
+	Name                     string `json:"name"`
+	MessageRetentionDuration int64  `json:"message_retention_duration_seconds,omitempty"`
+}
+
+func (s *restService) CreateTopic(ctx context.Context, id string, cfg TopicConfig) error {
+	rt := &ResourceTopic{
+		Name:                     id,
+		MessageRetentionDuration: int64(cfg.MessageRetentionDuration.Seconds()),
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(rt)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.publisher.sendRequest(ctx, "PUT", id, &buf)
 	if err != nil {
 		return err
 	}
@@ -96,7 +143,7 @@ func (s *restService) createTopic(ctx context.Context, id string) error {
 	return verifyHTTPStatusCode(http.StatusCreated, res)
 }
 
-func (s *restService) deleteTopic(ctx context.Context, id string) error {
+func (s *restService) DeleteTopic(ctx context.Context, id string) error {
 	res, err := s.publisher.sendRequest(ctx, "DELETE", id, nil)
 	if err != nil {
 		return err
@@ -106,7 +153,7 @@ func (s *restService) deleteTopic(ctx context.Context, id string) error {
 	return verifyHTTPStatusCode(http.StatusNoContent, res)
 }
 
-func (s *restService) topicExists(ctx context.Context, id string) (bool, error) {
+func (s *restService) TopicExists(ctx context.Context, id string) (bool, error) {
 	res, err := s.publisher.sendRequest(ctx, "GET", id, nil)
 	if err != nil {
 		return false, err
@@ -116,7 +163,7 @@ func (s *restService) topicExists(ctx context.Context, id string) (bool, error)
 	return http.StatusOK == res.StatusCode, nil
 }
 
-func (s *restService) listTopics(ctx context.Context) ([]string, error) {
+func (s *restService) ListTopics(ctx context.Context) ([]string, error) {
 	res, err := s.publisher.sendRequest(ctx, "GET", "", nil)
 	if err != nil {
 		return nil, err
@@ -139,7 +186,7 @@ func (s *restService) listTopics(ctx context.Context) ([]string, error) {
 	return ret, nil
 }
 
-func (s *restService) listTopicSubscriptions(ctx context.Context, id string) ([]string, error) {
+func (s *restService) ListTopicSubscriptions(ctx context.Context, id string) ([]string, error) {
 	res, err := s.publisher.sendRequest(ctx, "GET", id+"/subscriptions", nil)
 	if err != nil {
 		return nil, err
@@ -168,28 +215,34 @@ type ResourcePublishResponse struct {
 	MessageIDs []string `json:"message_ids"`
 }
 
-func (s *restService) publishMessages(ctx context.Context, id string, msg *Message) (string, error) {
-	// TODO: acceptable the Message slice in args
-	b := &ResourcePublishRequest{Messages: []PublishMessage{msg.toPublish()}}
+func (s *restService) PublishMessages(ctx context.Context, id string, msgs []*Message) ([]string, error) {
+	b := &ResourcePublishRequest{Messages: make([]PublishMessage, 0, len(msgs))}
+	for _, msg := range msgs {
+		b.Messages = append(b.Messages, msg.toPublish())
+	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(b)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	res, err := s.publisher.sendRequest(ctx, "POST", id+"/publish", &buf)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer res.Body.Close()
 
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return nil, err
+	}
 	msgIDs := ResourcePublishResponse{}
 	err = json.NewDecoder(res.Body).Decode(&msgIDs)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	// NOTE: expect sent a one message only
-	return msgIDs.MessageIDs[0], nil
+	if len(msgIDs.MessageIDs) != len(msgs) {
+		return nil, errors.Errorf("mismatch number of the published messages: sent %d, received %d", len(msgs), len(msgIDs.MessageIDs))
+	}
+	return msgIDs.MessageIDs, nil
 }
 
 // ResourceSusbscription represent body of request/response the Subscription parameter
@@ -198,9 +251,71 @@ type ResourceSusbscription struct {
 	Topic      string      `json:"topic"`
 	PushConfig *PushConfig `json:"push_config"`
 	AckTimeout int64       `json:"ack_deadline_seconds"`
+	Filter     string      `json:"filter,omitempty"`
+
+	DeadLetterPolicy *DeadLetterPolicy         `json:"dead_letter_policy,omitempty"`
+	RetryPolicy      *ResourceRetryPolicy      `json:"retry_policy,omitempty"`
+	ExpirationPolicy *ResourceExpirationPolicy `json:"expiration_policy,omitempty"`
+
+	EnableMessageOrdering     bool `json:"enable_message_ordering,omitempty"`
+	EnableExactlyOnceDelivery bool `json:"enable_exactly_once_delivery,omitempty"`
+
+	MessageRetentionDuration int64 `json:"message_retention_duration_seconds,omitempty"`
+	RetainAckedMessages      bool  `json:"retain_acked_messages,omitempty"`
+
+	LastActivityTime *time.Time `json:"last_activity_time,omitempty"`
 }
 
-func (s *restService) createSubscription(ctx context.Context, id string, cfg SubscriptionConfig) error {
+// ResourceRetryPolicy represent body of request/response the RetryPolicy parameter
+type ResourceRetryPolicy struct {
+	MinimumBackoff int64 `json:"minimum_backoff_seconds"`
+	MaximumBackoff int64 `json:"maximum_backoff_seconds"`
+}
+
+func retryPolicyToResource(p *RetryPolicy) *ResourceRetryPolicy {
+	if p == nil {
+		return nil
+	}
+	return &ResourceRetryPolicy{
+		MinimumBackoff: int64(p.MinimumBackoff.Seconds()),
+		MaximumBackoff: int64(p.MaximumBackoff.Seconds()),
+	}
+}
+
+func resourceToRetryPolicy(rp *ResourceRetryPolicy) *RetryPolicy {
+	if rp == nil {
+		return nil
+	}
+	return &RetryPolicy{
+		MinimumBackoff: time.Duration(rp.MinimumBackoff) * time.Second,
+		MaximumBackoff: time.Duration(rp.MaximumBackoff) * time.Second,
+	}
+}
+
+// ResourceExpirationPolicy represent body of request/response the ExpirationPolicy parameter
+type ResourceExpirationPolicy struct {
+	TTL int64 `json:"ttl_seconds"`
+}
+
+func expirationPolicyToResource(p *ExpirationPolicy) *ResourceExpirationPolicy {
+	if p == nil {
+		return nil
+	}
+	return &ResourceExpirationPolicy{
+		TTL: int64(p.TTL.Seconds()),
+	}
+}
+
+func resourceToExpirationPolicy(rp *ResourceExpirationPolicy) *ExpirationPolicy {
+	if rp == nil {
+		return nil
+	}
+	return &ExpirationPolicy{
+		TTL: time.Duration(rp.TTL) * time.Second,
+	}
+}
+
+func (s *restService) CreateSubscription(ctx context.Context, id string, cfg SubscriptionConfig) error {
 	if cfg.Topic == nil {
 		return errors.New("require non-nil topic")
 	}
@@ -209,10 +324,20 @@ func (s *restService) createSubscription(ctx context.Context, id string, cfg Sub
 	}
 
 	rs := &ResourceSusbscription{
-		Name:       id,
-		Topic:      cfg.Topic.ID,
-		PushConfig: cfg.PushConfig,
-		AckTimeout: int64(cfg.AckTimeout.Seconds()),
+		Name:             id,
+		Topic:            cfg.Topic.ID,
+		PushConfig:       cfg.PushConfig,
+		AckTimeout:       int64(cfg.AckTimeout.Seconds()),
+		Filter:           cfg.Filter,
+		DeadLetterPolicy: cfg.DeadLetterPolicy,
+		RetryPolicy:      retryPolicyToResource(cfg.RetryPolicy),
+		ExpirationPolicy: expirationPolicyToResource(cfg.ExpirationPolicy),
+
+		EnableMessageOrdering:     cfg.EnableMessageOrdering,
+		EnableExactlyOnceDelivery: cfg.EnableExactlyOnceDelivery,
+
+		MessageRetentionDuration: int64(cfg.MessageRetentionDuration.Seconds()),
+		RetainAckedMessages:      cfg.RetainAckedMessages,
 	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(rs)
@@ -229,7 +354,7 @@ func (s *restService) createSubscription(ctx context.Context, id string, cfg Sub
 	return verifyHTTPStatusCode(http.StatusCreated, res)
 }
 
-func (s *restService) getSubscriptionConfig(ctx context.Context, id string) (*SubscriptionConfig, error) {
+func (s *restService) GetSubscriptionConfig(ctx context.Context, id string) (*SubscriptionConfig, error) {
 	res, err := s.subscriber.sendRequest(ctx, "GET", id, nil)
 	if err != nil {
 		return nil, err
@@ -242,15 +367,28 @@ func (s *restService) getSubscriptionConfig(ctx context.Context, id string) (*Su
 		return nil, err
 	}
 	cfg := &SubscriptionConfig{
-		Topic:      newTopic(rs.Topic, s),
-		PushConfig: rs.PushConfig,
-		AckTimeout: time.Duration(rs.AckTimeout),
+		Topic:            newTopic(rs.Topic, s),
+		PushConfig:       rs.PushConfig,
+		AckTimeout:       time.Duration(rs.AckTimeout) * time.Second,
+		Filter:           rs.Filter,
+		DeadLetterPolicy: rs.DeadLetterPolicy,
+		RetryPolicy:      resourceToRetryPolicy(rs.RetryPolicy),
+		ExpirationPolicy: resourceToExpirationPolicy(rs.ExpirationPolicy),
+
+		EnableMessageOrdering:     rs.EnableMessageOrdering,
+		EnableExactlyOnceDelivery: rs.EnableExactlyOnceDelivery,
+
+		MessageRetentionDuration: time.Duration(rs.MessageRetentionDuration) * time.Second,
+		RetainAckedMessages:      rs.RetainAckedMessages,
+	}
+	if rs.LastActivityTime != nil {
+		cfg.LastActivityTime = *rs.LastActivityTime
 	}
 
 	return cfg, nil
 }
 
-func (s *restService) listSubscriptions(ctx context.Context) ([]string, error) {
+func (s *restService) ListSubscriptions(ctx context.Context) ([]string, error) {
 	res, err := s.subscriber.sendRequest(ctx, "GET", "", nil)
 	if err != nil {
 		return nil, err
@@ -270,7 +408,7 @@ func (s *restService) listSubscriptions(ctx context.Context) ([]string, error) {
 	return ret, nil
 }
 
-func (s *restService) deleteSubscription(ctx context.Context, id string) error {
+func (s *restService) DeleteSubscription(ctx context.Context, id string) error {
 	res, err := s.subscriber.sendRequest(ctx, "DELETE", id, nil)
 	if err != nil {
 		return err
@@ -280,7 +418,7 @@ func (s *restService) deleteSubscription(ctx context.Context, id string) error {
 	return verifyHTTPStatusCode(http.StatusNoContent, res)
 }
 
-func (s *restService) subscriptionExists(ctx context.Context, id string) (bool, error) {
+func (s *restService) SubscriptionExists(ctx context.Context, id string) (bool, error) {
 	res, err := s.subscriber.sendRequest(ctx, "GET", id, nil)
 	if err != nil {
 		return false, err
@@ -295,7 +433,7 @@ type ResourceModifyPush struct {
 	PushConfig *PushConfig `json:"push_config"`
 }
 
-func (s *restService) modifyPushConfig(ctx context.Context, id string, cfg *PushConfig) error {
+func (s *restService) ModifyPushConfig(ctx context.Context, id string, cfg *PushConfig) error {
 	payload := &ResourceModifyPush{
 		PushConfig: cfg,
 	}
@@ -314,13 +452,150 @@ func (s *restService) modifyPushConfig(ctx context.Context, id string, cfg *Push
 	return verifyHTTPStatusCode(http.StatusOK, res)
 }
 
+// ResourceSeek represent the payload of the Seek API
+type ResourceSeek struct {
+	Time time.Time `json:"time"`
+}
+
+func (s *restService) Seek(ctx context.Context, id string, t time.Time) error {
+	payload := &ResourceSeek{
+		Time: t,
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(payload)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.subscriber.sendRequest(ctx, "POST", id+"/seek", &buf)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return verifyHTTPStatusCode(http.StatusOK, res)
+}
+
+// ResourceRestore represent the payload of the Restore API
+type ResourceRestore struct {
+	Snapshot string `json:"snapshot"`
+}
+
+func (s *restService) RestoreSnapshot(ctx context.Context, id, snapshotID string) error {
+	payload := &ResourceRestore{
+		Snapshot: snapshotID,
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(payload)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.subscriber.sendRequest(ctx, "POST", id+"/restore", &buf)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return verifyHTTPStatusCode(http.StatusOK, res)
+}
+
+// ResourceCreateSnapshot represent the payload of the create Snapshot API
+type ResourceCreateSnapshot struct {
+	Subscription      string `json:"subscription"`
+	ExpirationSeconds int64  `json:"expiration_seconds"`
+}
+
+// ResourceSnapshot represent body of response the Snapshot parameter
+type ResourceSnapshot struct {
+	Name         string    `json:"name"`
+	Topic        string    `json:"topic"`
+	Subscription string    `json:"subscription"`
+	ExpireTime   time.Time `json:"expire_time"`
+}
+
+func (s *restService) CreateSnapshot(ctx context.Context, id string, cfg SnapshotConfig) error {
+	if cfg.Subscription == nil {
+		return errors.New("require non-nil subscription")
+	}
+	payload := &ResourceCreateSnapshot{
+		Subscription:      cfg.Subscription.ID,
+		ExpirationSeconds: int64(cfg.Expiration.Seconds()),
+	}
+	var buf bytes.Buffer
+	err := json.NewEncoder(&buf).Encode(payload)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.snapshotter.sendRequest(ctx, "PUT", id, &buf)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return verifyHTTPStatusCode(http.StatusCreated, res)
+}
+
+func (s *restService) GetSnapshotConfig(ctx context.Context, id string) (*SnapshotConfig, error) {
+	res, err := s.snapshotter.sendRequest(ctx, "GET", id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return nil, err
+	}
+	rs := &ResourceSnapshot{}
+	err = json.NewDecoder(res.Body).Decode(rs)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotConfig{
+		Topic:        newTopic(rs.Topic, s),
+		Subscription: newSubscription(rs.Subscription, s),
+		ExpireTime:   rs.ExpireTime,
+	}, nil
+}
+
+func (s *restService) ListSnapshots(ctx context.Context) ([]string, error) {
+	res, err := s.snapshotter.sendRequest(ctx, "GET", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	snaps := []*ResourceSnapshot{}
+	err = json.NewDecoder(res.Body).Decode(&snaps)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, v := range snaps {
+		ret = append(ret, v.Name)
+	}
+	return ret, nil
+}
+
+func (s *restService) DeleteSnapshot(ctx context.Context, id string) error {
+	res, err := s.snapshotter.sendRequest(ctx, "DELETE", id, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return verifyHTTPStatusCode(http.StatusNoContent, res)
+}
+
 // ResourceModifyAck represent the payload of the ModifyAck API
 type ResourceModifyAck struct {
 	AckIDs             []string `json:"ack_ids"`
 	AckDeadlineSeconds int64    `json:"ack_deadline_seconds"`
 }
 
-func (s *restService) modifyAckDeadline(ctx context.Context, subID string, deadline time.Duration, ackIDs []string) error {
+func (s *restService) ModifyAckDeadline(ctx context.Context, subID string, deadline time.Duration, ackIDs []string) error {
 	payload := &ResourceModifyAck{
 		AckIDs:             ackIDs,
 		AckDeadlineSeconds: int64(deadline.Seconds()),
@@ -342,27 +617,32 @@ func (s *restService) modifyAckDeadline(ctx context.Context, subID string, deadl
 
 // ResourcePullRequest represent the payload of the request Pull API
 type ResourcePullRequest struct {
-	MaxMessages int `json:"max_messages"`
+	ReturnImmediately bool  `json:"return_immediately"`
+	MaxMessages       int   `json:"max_messages"`
+	MaxWaitSeconds    int64 `json:"max_wait_seconds"`
 }
 
 // ResourcePullResponse represent the payload of the response Pull API
 type ResourcePullResponse struct {
 	Messages []struct {
-		AckID   string   `json:"ack_id"`
-		Message *Message `json:"message"`
+		AckID           string   `json:"ack_id"`
+		Message         *Message `json:"message"`
+		DeliveryAttempt int      `json:"delivery_attempt"`
 	} `json:"receive_messages"`
 }
 
 // ErrNotFoundMessage represent currently not exist message on the subscription server
 var ErrNotFoundMessage = errors.New("not found message")
 
-func (s *restService) pullMessages(ctx context.Context, subID string, maxMessages int) ([]*Message, error) {
+func (s *restService) PullMessages(ctx context.Context, subID string, maxMessages int, maxWait time.Duration) ([]*Message, error) {
 	if maxMessages <= 0 {
 		maxMessages = 1
 	}
 
 	payload := &ResourcePullRequest{
-		MaxMessages: maxMessages,
+		ReturnImmediately: maxWait <= 0,
+		MaxMessages:       maxMessages,
+		MaxWaitSeconds:    int64(maxWait.Seconds()),
 	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(payload)
@@ -393,6 +673,7 @@ func (s *restService) pullMessages(ctx context.Context, subID string, maxMessage
 	msgs := []*Message{}
 	for _, raw := range rawMsgs.Messages {
 		raw.Message.AckID = raw.AckID
+		raw.Message.DeliveryAttempt = raw.DeliveryAttempt
 		msgs = append(msgs, raw.Message)
 	}
 
@@ -404,7 +685,7 @@ type ResourceAck struct {
 	AckIDs []string `json:"ack_ids"`
 }
 
-func (s *restService) ack(ctx context.Context, subID string, ackIDs []string) error {
+func (s *restService) Ack(ctx context.Context, subID string, ackIDs []string) error {
 	payload := &ResourceAck{
 		AckIDs: ackIDs,
 	}
@@ -420,10 +701,239 @@ func (s *restService) ack(ctx context.Context, subID string, ackIDs []string) er
 	}
 	defer res.Body.Close()
 
-	return verifyHTTPStatusCode(http.StatusOK, res)
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return err
+	}
+	// the results are returned only from the exactly once delivery Subscription
+	var results ResourceAckResponse
+	if err := json.NewDecoder(res.Body).Decode(&results); err != nil {
+		return nil
+	}
+	failed := []string{}
+	for _, r := range results.AckResults {
+		if !r.Success {
+			failed = append(failed, r.AckID)
+		}
+	}
+	if len(failed) > 0 {
+		return &AckError{AckIDs: failed}
+	}
+	return nil
+}
+
+// ResourceAckResponse represent the payload of the response Ack API
+type ResourceAckResponse struct {
+	AckResults []struct {
+		AckID   string `json:"ack_id"`
+		Success bool   `json:"success"`
+	} `json:"ack_results"`
+}
+
+// AckError represent failed AckIDs in the exactly once delivery Subscription or on the streaming pull,
+// the messages were already acked or exceeded the ack deadline.
+type AckError struct {
+	AckIDs []string
+}
+
+func (e *AckError) Error() string {
+	return "failed to ack, ack_ids=" + strings.Join(e.AckIDs, ",")
+}
+
+// ResourceStreamRequest represent the payload sent to the Stream API
+type ResourceStreamRequest struct {
+	MaxOutstandingMessages int      `json:"max_outstanding_messages"`
+	AckIDs                 []string `json:"ack_ids"`
+	ModifyDeadlineAckIDs   []string `json:"modify_deadline_ack_ids"`
+	ModifyDeadlineSeconds  int64    `json:"modify_deadline_seconds"`
+}
+
+func (s *restService) StreamingPull(ctx context.Context, subID string, maxOutstanding int) (MessageStream, error) {
+	url := s.subscriber.serverURL + subID + "/stream"
+	url = "ws" + strings.TrimPrefix(url, "http")
+	conn, res, err := s.subscriber.streamDialer().DialContext(ctx, url, nil)
+	if err != nil {
+		if res != nil {
+			return nil, errors.Wrapf(err, "HTTP response error: received status code %d", res.StatusCode)
+		}
+		return nil, err
+	}
+
+	st := &restStream{
+		conn:   conn,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	if err := st.send(&ResourceStreamRequest{MaxOutstandingMessages: maxOutstanding}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go st.readLoop()
+	return st, nil
+}
+
+// streamDialer return the websocket dialer with the proxy, the TLS config and the cookies of the HTTP client
+func (s *restSubscriber) streamDialer() *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	d.Jar = s.httpClient.Jar
+	t, ok := s.httpClient.Transport.(*http.Transport)
+	if !ok {
+		t, ok = http.DefaultTransport.(*http.Transport)
+	}
+	if ok {
+		d.Proxy = t.Proxy
+		d.TLSClientConfig = t.TLSClientConfig
+		d.NetDialContext = t.DialContext
+	}
+	return &d
+}
+
+// ResourceStreamResponse represent the payload received from the Stream API,
+// the messages or the results of the ack request
+type ResourceStreamResponse struct {
+	ResourcePullResponse
+	ResourceAckResponse
+}
+
+// restStream implement MessageStream interface for the websocket.
+// the read loop queues the messages for Recv, and pass the ack results to the waiting Ack
+type restStream struct {
+	conn      *websocket.Conn
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+
+	// received is the messages not yet returned by Recv, limited by the max outstanding messages
+	received [][]*Message
+	// acks is the failed AckIDs receivers of the waiting Ack in the request order
+	acks   []chan []string
+	err    error
+	notify chan struct{}
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+func (st *restStream) send(payload *ResourceStreamRequest) error {
+	st.writeMu.Lock()
+	defer st.writeMu.Unlock()
+	return st.conn.WriteJSON(payload)
+}
+
+// readLoop keeps reading the messages and the ack results until the connection is closed
+func (st *restStream) readLoop() {
+	for {
+		res := &ResourceStreamResponse{}
+		if err := st.conn.ReadJSON(res); err != nil {
+			st.mu.Lock()
+			st.err = err
+			st.mu.Unlock()
+			close(st.done)
+			return
+		}
+
+		if len(res.AckResults) > 0 {
+			failed := []string{}
+			for _, r := range res.AckResults {
+				if !r.Success {
+					failed = append(failed, r.AckID)
+				}
+			}
+			st.mu.Lock()
+			if len(st.acks) > 0 {
+				st.acks[0] <- failed
+				st.acks = st.acks[1:]
+			}
+			st.mu.Unlock()
+			continue
+		}
+
+		msgs := []*Message{}
+		for _, raw := range res.Messages {
+			raw.Message.AckID = raw.AckID
+			raw.Message.DeliveryAttempt = raw.DeliveryAttempt
+			msgs = append(msgs, raw.Message)
+		}
+		st.mu.Lock()
+		st.received = append(st.received, msgs)
+		st.mu.Unlock()
+		select {
+		case st.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (st *restStream) Recv() ([]*Message, error) {
+	for {
+		st.mu.Lock()
+		if len(st.received) > 0 {
+			msgs := st.received[0]
+			st.received = st.received[1:]
+			st.mu.Unlock()
+			return msgs, nil
+		}
+		err := st.err
+		st.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case <-st.notify:
+		case <-st.done:
+		}
+	}
+}
+
+// Ack send ack on the connection, and wait for the results.
+// returns AckError when any AckID is failed, same as the Ack API of the exactly once delivery Subscription
+func (st *restStream) Ack(ackIDs []string) error {
+	if len(ackIDs) == 0 {
+		return nil
+	}
+	result := make(chan []string, 1)
+	st.writeMu.Lock()
+	st.mu.Lock()
+	st.acks = append(st.acks, result)
+	st.mu.Unlock()
+	err := st.conn.WriteJSON(&ResourceStreamRequest{AckIDs: ackIDs})
+	st.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	select {
+	case failed = <-result:
+	case <-st.done:
+		select {
+		case failed = <-result:
+		default:
+			st.mu.Lock()
+			defer st.mu.Unlock()
+			return st.err
+		}
+	}
+	if len(failed) > 0 {
+		return &AckError{AckIDs: failed}
+	}
+	return nil
+}
+
+func (st *restStream) ModifyAckDeadline(deadline time.Duration, ackIDs []string) error {
+	return st.send(&ResourceStreamRequest{
+		ModifyDeadlineAckIDs:  ackIDs,
+		ModifyDeadlineSeconds: int64(deadline.Seconds()),
+	})
+}
+
+func (st *restStream) Close() error {
+	var err error
+	st.closeOnce.Do(func() {
+		err = st.conn.Close()
+	})
+	return err
 }
 
-func (s *restService) statsSummary(ctx context.Context) ([]byte, error) {
+func (s *restService) StatsSummary(ctx context.Context) ([]byte, error) {
 	res, err := s.monitoring.sendRequest(ctx, "GET", "", nil)
 	if err != nil {
 		return nil, err
@@ -438,7 +948,7 @@ func (s *restService) statsSummary(ctx context.Context) ([]byte, error) {
 	return ioutil.ReadAll(res.Body)
 }
 
-func (s *restService) statsTopicDetail(ctx context.Context, id string) ([]byte, error) {
+func (s *restService) StatsTopicDetail(ctx context.Context, id string) ([]byte, error) {
 	res, err := s.monitoring.sendRequest(ctx, "GET", "topic/"+id, nil)
 	if err != nil {
 		return nil, err
@@ -453,7 +963,7 @@ func (s *restService) statsTopicDetail(ctx context.Context, id string) ([]byte,
 	return ioutil.ReadAll(res.Body)
 }
 
-func (s *restService) statsSubscriptionDetail(ctx context.Context, id string) ([]byte, error) {
+func (s *restService) StatsSubscriptionDetail(ctx context.Context, id string) ([]byte, error) {
 	res, err := s.monitoring.sendRequest(ctx, "GET", "subscription/"+id, nil)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Snapshot is a accessor to a server snapshot
+type Snapshot struct {
+	ID string
+	s  Service
+}
+
+// SnapshotConfig represent parameter of the Snapshot
+type SnapshotConfig struct {
+	// Subscription is source of the captured unacked messages, required to create
+	Subscription *Subscription
+
+	// Expiration is lifetime of the Snapshot, 0 is used the server default
+	Expiration time.Duration
+
+	// Topic and ExpireTime are set by the server
+	Topic      *Topic
+	ExpireTime time.Time
+}
+
+func newSnapshot(id string, s Service) *Snapshot {
+	return &Snapshot{
+		ID: id,
+		s:  s,
+	}
+}
+
+// Config returns SnapshotConfig
+func (s *Snapshot) Config(ctx context.Context) (*SnapshotConfig, error) {
+	cfg, err := s.s.GetSnapshotConfig(ctx, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	// bind the Topic and the Subscription to the Service of the Snapshot
+	if cfg.Topic != nil {
+		cfg.Topic = newTopic(cfg.Topic.ID, s.s)
+	}
+	if cfg.Subscription != nil {
+		cfg.Subscription = newSubscription(cfg.Subscription.ID, s.s)
+	}
+	return cfg, nil
+}
+
+// Delete deletes the Snapshot
+func (s *Snapshot) Delete(ctx context.Context) error {
+	return s.s.DeleteSnapshot(ctx, s.ID)
+}
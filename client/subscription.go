@@ -2,15 +2,61 @@ package client
 
 import (
 	"context"
+	"sync"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // Subscription is a accessor to a server subscription
 type Subscription struct {
 	ID string
-	s  service
+	s  Service
+
+	// ReceiveSettings is used to configure Receive
+	ReceiveSettings ReceiveSettings
+
+	stream   MessageStream
+	receiver *receiver
+	acker    *acker
+	mu       sync.RWMutex
+}
+
+// ReceiveSettings represent parameter of the Receive.
+// If the parameter less than or equal to 0, used DefaultReceiveSettings.
+type ReceiveSettings struct {
+	// MaxExtension is maximum period for which extend the ack deadline of the received message
+	MaxExtension time.Duration
+
+	// MaxOutstandingMessages is maximum number of the received but not yet acked messages
+	MaxOutstandingMessages int
+
+	// NumGoroutines is number of the goroutines calls the Receive callback
+	NumGoroutines int
+
+	// Streaming is whether receive messages via the streaming pull connection
+	Streaming bool
+}
+
+// DefaultReceiveSettings is default parameter of the Receive
+var DefaultReceiveSettings = ReceiveSettings{
+	MaxExtension:           10 * time.Minute,
+	MaxOutstandingMessages: 1000,
+	NumGoroutines:          10,
+	Streaming:              false,
+}
+
+// receiveSettings returns ReceiveSettings filled default parameter
+func (s *Subscription) receiveSettings() ReceiveSettings {
+	rs := s.ReceiveSettings
+	if rs.MaxExtension <= 0 {
+		rs.MaxExtension = DefaultReceiveSettings.MaxExtension
+	}
+	if rs.MaxOutstandingMessages <= 0 {
+		rs.MaxOutstandingMessages = DefaultReceiveSettings.MaxOutstandingMessages
+	}
+	if rs.NumGoroutines <= 0 {
+		rs.NumGoroutines = DefaultReceiveSettings.NumGoroutines
+	}
+	return rs
 }
 
 // SubscriptionConfig represent parameter of the Subscription
@@ -18,6 +64,34 @@ type SubscriptionConfig struct {
 	Topic      *Topic
 	PushConfig *PushConfig
 	AckTimeout time.Duration
+
+	// Filter is expression of the message attributes to receive, e.g. `attributes.type = "order"`
+	Filter string
+
+	// DeadLetterPolicy is forwarding the messages exceeded max delivery attempts to another topic
+	DeadLetterPolicy *DeadLetterPolicy
+
+	// RetryPolicy is delay of the redelivery for the nacked or expired messages
+	RetryPolicy *RetryPolicy
+
+	// EnableMessageOrdering is receive the messages with the same OrderingKey in publish order
+	EnableMessageOrdering bool
+
+	// EnableExactlyOnceDelivery is guarantee no redelivery after the successful Ack,
+	// Ack returns *AckError for the expired or redelivered messages
+	EnableExactlyOnceDelivery bool
+
+	// MessageRetentionDuration is retention duration of the unacked messages, 0 is used the Topic setting
+	MessageRetentionDuration time.Duration
+
+	// RetainAckedMessages is keep the acked messages to enable the redelivery by SeekToTime
+	RetainAckedMessages bool
+
+	// ExpirationPolicy is delete the Subscription after a period with no activity
+	ExpirationPolicy *ExpirationPolicy
+
+	// LastActivityTime is set by the server, time of the last pull, ack or modify ack deadline
+	LastActivityTime time.Time
 }
 
 // SubscriptionConfigToUpdate is updatable parameter for the existed Subscription
@@ -25,13 +99,31 @@ type SubscriptionConfigToUpdate struct {
 	PushConfig *PushConfig
 }
 
+// DeadLetterPolicy represent parameter of the dead letter topic in Subscription
+type DeadLetterPolicy struct {
+	DeadLetterTopic     string `json:"dead_letter_topic"`
+	MaxDeliveryAttempts int    `json:"max_delivery_attempts"`
+}
+
+// RetryPolicy represent parameter of the exponential backoff in Subscription.
+// the delay is doubled for each delivery attempt, from MinimumBackoff up to MaximumBackoff. MinimumBackoff must be positive.
+type RetryPolicy struct {
+	MinimumBackoff time.Duration
+	MaximumBackoff time.Duration
+}
+
+// ExpirationPolicy represent parameter of the Subscription deleted after TTL with no activity
+type ExpirationPolicy struct {
+	TTL time.Duration
+}
+
 // PushConfig represent parameter of the push mode in Subscription
 type PushConfig struct {
 	Endpoint   string
 	Attributes map[string]string
 }
 
-func newSubscription(id string, s service) *Subscription {
+func newSubscription(id string, s Service) *Subscription {
 	return &Subscription{
 		ID: id,
 		s:  s,
@@ -47,62 +139,251 @@ func (a BySubscriptionID) Less(i, j int) bool { return a[i].ID < a[j].ID }
 
 // Exists return whether the subscription exists on the server.
 func (s *Subscription) Exists(ctx context.Context) (bool, error) {
-	return s.s.subscriptionExists(ctx, s.ID)
+	return s.s.SubscriptionExists(ctx, s.ID)
 }
 
 // Config returns the current configuration for the Subscription
 func (s *Subscription) Config(ctx context.Context) (*SubscriptionConfig, error) {
-	return s.s.getSubscriptionConfig(ctx, s.ID)
+	cfg, err := s.s.GetSubscriptionConfig(ctx, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	// bind the Topic to the Service of the Subscription
+	if cfg.Topic != nil {
+		cfg.Topic = newTopic(cfg.Topic.ID, s.s)
+	}
+	return cfg, nil
 }
 
 // Delete deletes the Subscription
 func (s *Subscription) Delete(ctx context.Context) error {
-	return s.s.deleteSubscription(ctx, s.ID)
+	return s.s.DeleteSubscription(ctx, s.ID)
 }
 
-// Receive calls fn for the fetched messages from the Subscription.
-// send a nack requests when an error occurs via the Pull API.
+// Receive calls fn for the received messages from the Subscription, keeps running until ctx is done.
+// fn is called concurrently by ReceiveSettings.NumGoroutines goroutines,
+// and the ack deadline of the messages are extended until Ack, Nack or ModifyDeadline is called, up to ReceiveSettings.MaxExtension.
 func (s *Subscription) Receive(ctx context.Context, fn func(ctx context.Context, msg *Message)) error {
-	// TODO: number of receive message extract to ReceiveConfig
-	msgs, err := s.s.pullMessages(ctx, s.ID, 1)
+	cfg, err := s.Config(ctx)
 	if err != nil {
-		// send nack request to the pulled messages
-		if msgs != nil {
-			ackIDs := []string{}
-			for _, msg := range msgs {
-				ackIDs = append(ackIDs, msg.AckID)
+		return err
+	}
+	settings := s.receiveSettings()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := newReceiver(s, settings, cfg.AckTimeout)
+	s.setReceiver(r)
+	defer s.setReceiver(nil)
+	go r.keepAlive(ctx)
+
+	// worker pool
+	msgCh := make(chan *Message)
+	var wg sync.WaitGroup
+	for i := 0; i < settings.NumGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgCh {
+				fn(ctx, msg)
 			}
-			if nackErr := s.Nack(ctx, ackIDs); nackErr != nil {
-				errors.Wrapf(err, "failed to nack messages: %s", nackErr.Error())
+		}()
+	}
+	defer func() {
+		close(msgCh)
+		wg.Wait()
+		s.getAcker().flush()
+		// release messages not yet acked, to redeliver immediately
+		if ackIDs := r.pending(); len(ackIDs) > 0 {
+			s.Nack(context.Background(), ackIDs)
+		}
+	}()
+
+	dispatch := func(msgs []*Message) {
+		s.bindMessages(msgs)
+		r.add(msgs)
+		for _, msg := range msgs {
+			select {
+			case msgCh <- msg:
+			case <-ctx.Done():
+				return
 			}
 		}
+	}
+	if settings.Streaming {
+		err = s.receiveStream(ctx, settings, dispatch)
+	} else {
+		err = s.receivePull(ctx, r, dispatch)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// receivePull keeps fetching messages via the Pull API until ctx is done
+func (s *Subscription) receivePull(ctx context.Context, r *receiver, dispatch func([]*Message)) error {
+	for {
+		n, err := r.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		msgs, err := s.s.PullMessages(ctx, s.ID, n, receivePullWait)
+		if err != nil && err != ErrNotFoundMessage {
+			r.release(n)
+			return err
+		}
+		// the dispatched messages are counted as inflight instead of reserved
+		dispatch(msgs)
+		r.release(n)
+	}
+}
+
+// receiveStream keeps receiving messages from the streaming pull connection until ctx is done
+func (s *Subscription) receiveStream(ctx context.Context, settings ReceiveSettings, dispatch func([]*Message)) error {
+	st, err := s.s.StreamingPull(ctx, s.ID, settings.MaxOutstandingMessages)
+	if err != nil {
 		return err
 	}
+	s.setStream(st)
+	defer s.setStream(nil)
+	defer st.Close()
+
+	// unblock recv when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			st.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		msgs, err := st.Recv()
+		if err != nil {
+			return err
+		}
+		dispatch(msgs)
+	}
+}
+
+// Pull fetches messages once via the Pull API.
+// returns ErrNotFoundMessage when not exist readable messages.
+func (s *Subscription) Pull(ctx context.Context, maxMessages int) ([]*Message, error) {
+	msgs, err := s.s.PullMessages(ctx, s.ID, maxMessages, 0)
+	if err != nil {
+		return nil, err
+	}
+	s.bindMessages(msgs)
+	return msgs, nil
+}
 
+// bindMessages associate the messages to the Subscription, enable to the Message.Ack and Nack
+func (s *Subscription) bindMessages(msgs []*Message) {
 	for _, msg := range msgs {
-		fn(ctx, msg)
+		msg.sub = s
+	}
+}
+
+func (s *Subscription) getAcker() *acker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.acker == nil {
+		s.acker = newAcker(s)
+	}
+	return s.acker
+}
+
+// ackAsync add ack to the batch, and release the message from the Receive
+func (s *Subscription) ackAsync(ackID string) {
+	if r := s.getReceiver(); r != nil {
+		r.done([]string{ackID})
+	}
+	s.getAcker().ack(ackID)
+}
+
+// nackAsync add nack to the batch, and release the message from the Receive
+func (s *Subscription) nackAsync(ackID string) {
+	if r := s.getReceiver(); r != nil {
+		r.done([]string{ackID})
 	}
-	return nil
+	s.getAcker().nack(ackID)
+}
+
+func (s *Subscription) getStream() MessageStream {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.stream
+}
+
+func (s *Subscription) setStream(st MessageStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stream = st
+}
+
+func (s *Subscription) getReceiver() *receiver {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.receiver
+}
+
+func (s *Subscription) setReceiver(r *receiver) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.receiver = r
 }
 
-// Ack calls Ack API for the ackIDs
+// Ack calls Ack API for the ackIDs.
+// During the streaming Receive, send ack on the streaming pull connection.
 func (s *Subscription) Ack(ctx context.Context, ackIDs []string) error {
-	return s.s.ack(ctx, s.ID, ackIDs)
+	if r := s.getReceiver(); r != nil {
+		defer r.done(ackIDs)
+	}
+	if st := s.getStream(); st != nil {
+		return st.Ack(ackIDs)
+	}
+	return s.s.Ack(ctx, s.ID, ackIDs)
 }
 
 // Nack releases messages from the Subscription.
 // As a result, another subscriber can pull message.
 func (s *Subscription) Nack(ctx context.Context, ackIDs []string) error {
+	if r := s.getReceiver(); r != nil {
+		defer r.done(ackIDs)
+	}
 	// nack is represented by setting AckDeadline to zero
-	return s.s.modifyAckDeadline(ctx, s.ID, 0, ackIDs)
+	return s.modifyAckDeadline(ctx, 0, ackIDs)
+}
+
+// modifyAckDeadline calls ModifyAck API, or send on the streaming pull connection during the streaming Receive
+func (s *Subscription) modifyAckDeadline(ctx context.Context, deadline time.Duration, ackIDs []string) error {
+	if st := s.getStream(); st != nil {
+		return st.ModifyAckDeadline(deadline, ackIDs)
+	}
+	return s.s.ModifyAckDeadline(ctx, s.ID, deadline, ackIDs)
 }
 
 // Update updates an existing Subscription
 func (s *Subscription) Update(ctx context.Context, cfg *SubscriptionConfigToUpdate) error {
-	return s.s.modifyPushConfig(ctx, s.ID, cfg.PushConfig)
+	return s.s.ModifyPushConfig(ctx, s.ID, cfg.PushConfig)
+}
+
+// SeekToTime marks the messages published before t as acked,
+// and the messages published after t as unacked.
+// the acked messages are redelivered only when enabled RetainAckedMessages.
+func (s *Subscription) SeekToTime(ctx context.Context, t time.Time) error {
+	return s.s.Seek(ctx, s.ID, t)
+}
+
+// RestoreSnapshot marks the messages captured in the Snapshot as unacked, and other messages as acked
+func (s *Subscription) RestoreSnapshot(ctx context.Context, snap *Snapshot) error {
+	return s.s.RestoreSnapshot(ctx, s.ID, snap.ID)
 }
 
 // StatsDetail returns stats detail of the Subscription
 func (s *Subscription) StatsDetail(ctx context.Context) ([]byte, error) {
-	return s.s.statsSubscriptionDetail(ctx, s.ID)
+	return s.s.StatsSubscriptionDetail(ctx, s.ID)
 }
@@ -1,14 +1,34 @@
 package client
 
-import "context"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 // Topic is a accessor to a server topic
 type Topic struct {
 	ID string
-	s  service
+	s  Service
+
+	// PublishSettings is used to configure Publish, must be set before the first Publish
+	PublishSettings PublishSettings
+
+	// EnableMessageOrdering is send the batches in publish order, for the messages has OrderingKey.
+	// must be set before the first Publish
+	EnableMessageOrdering bool
+
+	publisher *publisher
+	mu        sync.Mutex
 }
 
-func newTopic(id string, s service) *Topic {
+// TopicConfig represent parameter of the Topic
+type TopicConfig struct {
+	// MessageRetentionDuration is retention duration of the unacked messages, 0 is unlimited
+	MessageRetentionDuration time.Duration
+}
+
+func newTopic(id string, s Service) *Topic {
 	return &Topic{
 		ID: id,
 		s:  s,
@@ -47,19 +67,26 @@ func (p *PublishResult) Get(ctx context.Context) (string, error) {
 	}
 }
 
+// set resolve the result
+func (p *PublishResult) set(msgID string, err error) {
+	p.msgID = msgID
+	p.err = err
+	close(p.done)
+}
+
 // Exists return whether the topic exists on the server.
 func (t *Topic) Exists(ctx context.Context) (bool, error) {
-	return t.s.topicExists(ctx, t.ID)
+	return t.s.TopicExists(ctx, t.ID)
 }
 
 // Delete deletes the topic
 func (t *Topic) Delete(ctx context.Context) error {
-	return t.s.deleteTopic(ctx, t.ID)
+	return t.s.DeleteTopic(ctx, t.ID)
 }
 
 // Subscriptions returns subscription list matched topic
 func (t *Topic) Subscriptions(ctx context.Context) ([]*Subscription, error) {
-	subIDs, err := t.s.listTopicSubscriptions(ctx, t.ID)
+	subIDs, err := t.s.ListTopicSubscriptions(ctx, t.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -71,23 +98,32 @@ func (t *Topic) Subscriptions(ctx context.Context) ([]*Subscription, error) {
 	return subs, nil
 }
 
-// Publish asynchronously send message, and return immediate PublishResult
+// Publish asynchronously send message in batches, and return immediate PublishResult.
+// the message is not sent when ctx is done before the batch is sent.
 func (t *Topic) Publish(ctx context.Context, msg *Message) *PublishResult {
 	pr := &PublishResult{
 		done: make(chan struct{}),
 	}
+	t.getPublisher().add(ctx, msg, pr)
+	return pr
+}
 
-	go func() {
-		msgID, err := t.s.publishMessages(ctx, t.ID, msg)
-		pr.msgID = msgID
-		pr.err = err
-		close(pr.done)
-	}()
+// Stop sends all remaining messages, and waits for done.
+// Publish after the Stop returns ErrTopicStopped.
+func (t *Topic) Stop() {
+	t.getPublisher().stop()
+}
 
-	return pr
+func (t *Topic) getPublisher() *publisher {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.publisher == nil {
+		t.publisher = newPublisher(t.ID, t.s, t.publishSettings(), t.EnableMessageOrdering)
+	}
+	return t.publisher
 }
 
 // StatsDetail returns stats detail of the Topic
 func (t *Topic) StatsDetail(ctx context.Context) ([]byte, error) {
-	return t.s.statsTopicDetail(ctx, t.ID)
+	return t.s.StatsTopicDetail(ctx, t.ID)
 }
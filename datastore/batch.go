@@ -0,0 +1,161 @@
+package datastore
+
+import (
+	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// Batch is the write operations applied all-or-nothing by Commit
+type Batch interface {
+	Set(key, value interface{})
+	Delete(key interface{})
+
+	// the write operations of the Index
+	SetUniqueIndex(index, field, key string)
+	DeleteUniqueIndex(index, field string)
+	AddSortedIndex(index, field, key string, score float64)
+	RemoveSortedIndex(index, field, key string)
+
+	Commit() error
+}
+
+// batchOpKind is the kind of the write operation
+type batchOpKind int
+
+const (
+	opSet batchOpKind = iota
+	opDelete
+	opSetUniqueIndex
+	opDeleteUniqueIndex
+	opAddSortedIndex
+	opRemoveSortedIndex
+)
+
+// batchOp is a write operation of the Batch, the index fields are used only in the index operations
+type batchOp struct {
+	kind  batchOpKind
+	key   interface{}
+	value interface{}
+
+	index string
+	field string
+	score float64
+}
+
+// batchOps is accumulate operations in order
+type batchOps []batchOp
+
+func (b *batchOps) Set(key, value interface{}) {
+	*b = append(*b, batchOp{kind: opSet, key: key, value: value})
+}
+
+func (b *batchOps) Delete(key interface{}) {
+	*b = append(*b, batchOp{kind: opDelete, key: key})
+}
+
+func (b *batchOps) SetUniqueIndex(index, field, key string) {
+	*b = append(*b, batchOp{kind: opSetUniqueIndex, index: index, field: field, key: key})
+}
+
+func (b *batchOps) DeleteUniqueIndex(index, field string) {
+	*b = append(*b, batchOp{kind: opDeleteUniqueIndex, index: index, field: field})
+}
+
+func (b *batchOps) AddSortedIndex(index, field, key string, score float64) {
+	*b = append(*b, batchOp{kind: opAddSortedIndex, index: index, field: field, key: key, score: score})
+}
+
+func (b *batchOps) RemoveSortedIndex(index, field, key string) {
+	*b = append(*b, batchOp{kind: opRemoveSortedIndex, index: index, field: field, key: key})
+}
+
+// memoryBatch apply operations while holding the lock of the Memory
+type memoryBatch struct {
+	batchOps
+	m *Memory
+}
+
+// Batch return Batch for the Memory
+func (m *Memory) Batch() Batch {
+	return &memoryBatch{m: m}
+}
+
+// Commit apply all operations
+func (b *memoryBatch) Commit() error {
+	b.m.mu.Lock()
+	defer b.m.mu.Unlock()
+
+	for _, op := range b.batchOps {
+		switch op.kind {
+		case opSet:
+			b.m.Store[op.key] = rowValue(op.value)
+		case opDelete:
+			delete(b.m.Store, op.key)
+		case opSetUniqueIndex:
+			b.m.setUniqueIndex(op.index, op.field, op.key.(string))
+		case opDeleteUniqueIndex:
+			b.m.deleteUniqueIndex(op.index, op.field)
+		case opAddSortedIndex:
+			b.m.addSortedIndex(op.index, op.field, op.key.(string), op.score)
+		case opRemoveSortedIndex:
+			b.m.removeSortedIndex(op.index, op.field, op.key.(string))
+		}
+	}
+	return nil
+}
+
+// redisBatch apply operations by MULTI/EXEC
+type redisBatch struct {
+	batchOps
+	r *Redis
+}
+
+// Batch return Batch for the Redis
+func (r *Redis) Batch() Batch {
+	return &redisBatch{r: r}
+}
+
+// Commit apply all operations in the MULTI/EXEC transaction
+func (b *redisBatch) Commit() error {
+	if len(b.batchOps) == 0 {
+		return nil
+	}
+	conn := b.r.Pool.Get()
+	defer conn.Close()
+
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+	for _, op := range b.batchOps {
+		var err error
+		switch op.kind {
+		case opSet:
+			err = conn.Send("SET", b.r.key(op.key), rowValue(op.value))
+		case opDelete:
+			err = conn.Send("DEL", b.r.key(op.key))
+		case opSetUniqueIndex:
+			err = conn.Send("HSET", b.r.key(redisUniqueIndexKey(op.index)), op.field, op.key)
+		case opDeleteUniqueIndex:
+			err = conn.Send("HDEL", b.r.key(redisUniqueIndexKey(op.index)), op.field)
+		case opAddSortedIndex:
+			err = conn.Send("ZADD", b.r.key(redisSortedIndexKey(op.index, op.field)), op.score, op.key)
+		case opRemoveSortedIndex:
+			err = conn.Send("ZREM", b.r.key(redisSortedIndexKey(op.index, op.field)), op.key)
+		}
+		if err != nil {
+			conn.Do("DISCARD")
+			return err
+		}
+	}
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return errors.Wrap(err, "failed to exec transaction")
+	}
+	// the errors of the commands in the transaction are returned as the elements of the reply
+	for _, r := range replies {
+		if err, ok := r.(redis.Error); ok {
+			return errors.Wrap(err, "failed to exec transaction")
+		}
+	}
+	return nil
+}
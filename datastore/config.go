@@ -1,34 +1,122 @@
 package datastore
 
-// GlobalConfig keep config
-// TODO: abort global variables
-var GlobalConfig *Config
-
-// SetGlobalConfig set global config
-func SetGlobalConfig(cfg *Config) {
-	GlobalConfig = cfg
-}
+import "time"
 
 // Config is specific datastore config, written under "datastore"
 type Config struct {
-	Redis *RedisConfig `yaml:"redis"`
-	MySQL *MySQLConfig `yaml:"mysql"`
+	Redis    *RedisConfig    `yaml:"redis"`
+	MySQL    *MySQLConfig    `yaml:"mysql"`
+	Postgres *PostgresConfig `yaml:"postgres"`
+	File     *FileConfig     `yaml:"file"`
 }
 
-// RedisConfig represent config for the Redis
+// RedisConfig represent config for the Redis.
+// the address is Addr, or Host and Port when Addr is empty, default "localhost:6379"
 type RedisConfig struct {
 	Addr     string `yaml:"addr"`
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	DB       int    `yaml:"db"`
 	Password string `yaml:"password"`
+	// Mode is "stream" to deliver the messages by the Redis Streams, default is the key-value
+	Mode string `yaml:"mode"`
+
+	// MaxIdle is the max idle connections of the pool, default 3
+	MaxIdle int `yaml:"max_idle"`
+	// MaxActive is the max connections of the pool, default 10
+	MaxActive int `yaml:"max_active"`
+	// IdleTimeout is the duration to close the idle connection, default 240s
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+
+	// the timeouts of the connection, 0 is no timeout
+	DialTimeout  time.Duration `yaml:"dial_timeout"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	// TLS is connect by the TLS when not nil
+	TLS *TLSConfig `yaml:"tls"`
+
+	// Sentinel is connect to the master discovered by the Sentinels, the address is not used
+	Sentinel *RedisSentinelConfig `yaml:"sentinel"`
+	// SingleSlotCluster is connect to the Redis Cluster storing all keys in a single slot, the address is not used
+	SingleSlotCluster *RedisSingleSlotClusterConfig `yaml:"single_slot_cluster"`
+}
+
+// RedisSentinelConfig represent config for the Redis Sentinel
+type RedisSentinelConfig struct {
+	MasterName string   `yaml:"master_name"`
+	Addrs      []string `yaml:"addrs"`
+	// Password is the password of the Sentinels, the master use RedisConfig.Password
+	Password string `yaml:"password"`
 }
 
-// MySQLConfig represent config for the MySQL
+// RedisSingleSlotClusterConfig represent config for the single-slot Cluster compatibility.
+// all keys are stored in the single slot of the HashTag, the cluster gives the failover but not the sharding
+type RedisSingleSlotClusterConfig struct {
+	// Addrs is the nodes to discover the cluster slots
+	Addrs []string `yaml:"addrs"`
+	// HashTag is the hash tag of all keys, to keep the keys in the same slot
+	// for the transaction and the multi keys commands, default "pubsub".
+	// the keys are not tagged per Topic or Subscription, because the publish writes the Message
+	// and the MessageStatus of all Subscriptions in a transaction.
+	// the servers with the different HashTag are distributed to the other slots
+	HashTag string `yaml:"hash_tag"`
+}
+
+// TLSConfig represent config for the TLS connection
+type TLSConfig struct {
+	// CAFile is the PEM file of the CA certificates to verify the server, the system roots when empty
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the PEM files of the client certificate
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ServerName is the name to verify the server certificate, the host of the address when empty
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// MySQLConfig represent config for the MySQL.
+// the address is Addr, or Host and Port when Addr is empty, default "localhost:3306"
 type MySQLConfig struct {
 	Addr     string `yaml:"addr"`
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
+	// Database is the database name, default "pubsub"
+	Database string `yaml:"database"`
+	// Params are the DSN parameters like charset, parseTime and tls
+	Params map[string]string `yaml:"params"`
+
+	// TLS is connect by the TLS when not nil, used instead of the tls param
+	TLS *TLSConfig `yaml:"tls"`
+
+	// the timeouts of the connection, 0 is no timeout
+	DialTimeout  time.Duration `yaml:"dial_timeout"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+
+	// MaxOpenConns is the max connections, 0 is unlimited
+	MaxOpenConns int `yaml:"max_open_conns"`
+	// MaxIdleConns is the max idle connections, 0 is the default of the database/sql
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// ConnMaxLifetime is the max duration to reuse the connection, 0 is unlimited
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+}
+
+// PostgresConfig represent config for the PostgreSQL
+type PostgresConfig struct {
+	Addr     string `yaml:"addr"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// Database is the database name, default "pubsub"
+	Database string `yaml:"database"`
+	// SSLMode is the sslmode parameter, default "disable"
+	SSLMode string `yaml:"sslmode"`
+}
+
+// FileConfig represent config for the embedded File
+type FileConfig struct {
+	// Path is the database file, created when not exist
+	Path string `yaml:"path"`
 }
@@ -2,15 +2,9 @@ package datastore
 
 import (
 	"bytes"
-	"database/sql"
 	"encoding/gob"
-	"fmt"
+	"strings"
 	"sync"
-	"time"
-
-	"github.com/garyburd/redigo/redis"
-	_ "github.com/go-sql-driver/mysql" // mysql driver
-	"github.com/pkg/errors"
 )
 
 // Datastore is behavior like Key-Value store
@@ -19,21 +13,55 @@ type Datastore interface {
 	Get(key interface{}) (interface{}, error)
 	Delete(key interface{}) error
 	Dump() (map[interface{}]interface{}, error)
+
+	// Index is the secondary index to find the entries without Dump
+	Index
+
+	// Batch return Batch applied the write operations all-or-nothing
+	Batch() Batch
+
+	// Close release the connections, the Datastore is no longer available
+	Close() error
 }
 
 // LoadDatastore load backend datastore from cnofiguration json file.
+// each call return the new connection or the new Memory, the caller shares it to write the entries of any type in a Batch.
 func LoadDatastore(cfg *Config) (Datastore, error) {
 	if cfg == nil {
 		return NewMemory(nil), nil
 	}
 
 	if cfg.Redis != nil {
+		if cfg.Redis.Mode == RedisStreamMode {
+			return NewRedisStream(cfg)
+		}
 		return NewRedis(cfg)
 	}
 	if cfg.MySQL != nil {
 		return NewMySQL(cfg)
 	}
-	return NewMemory(nil), nil
+	if cfg.Postgres != nil {
+		return NewPostgres(cfg)
+	}
+	if cfg.File != nil {
+		return NewFile(cfg)
+	}
+	return NewMemory(cfg), nil
+}
+
+// Row is the value with the searchable columns, used by the driver stored the entries in the table.
+// the other drivers store only the Value
+type Row struct {
+	Value   []byte
+	Columns map[string]interface{}
+}
+
+// rowValue return the Value when the Row, otherwise return as is
+func rowValue(v interface{}) interface{} {
+	if r, ok := v.(*Row); ok {
+		return r.Value
+	}
+	return v
 }
 
 // EncodeGob return encoeded bytes by gob
@@ -45,37 +73,27 @@ func EncodeGob(s interface{}) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// SpecifyDump return Dump entries, each Datastore type
+// prefixDumper is the Datastore able to dump only the entries matched the prefix
+type prefixDumper interface {
+	DumpPrefix(p string) (map[interface{}]interface{}, error)
+}
+
+// SpecifyDump return Dump entries matched the prefix key, all entries when the Datastore can not dump by the prefix
 func SpecifyDump(d Datastore, key string) (map[interface{}]interface{}, error) {
-	// TODO: SpecifyDump is used to acquire entries for each type, but it is more efficient to divide the DB/Table.
-	var res map[interface{}]interface{}
-	switch a := d.(type) {
-	case *Redis:
-		v, err := a.DumpPrefix(key)
-		if err != nil {
-			return nil, err
-		}
-		res = v
-	case *MySQL:
-		v, err := a.DumpPrefix(key)
-		if err != nil {
-			return nil, err
-		}
-		res = v
-	default:
-		v, err := a.Dump()
-		if err != nil {
-			return nil, err
-		}
-		res = v
+	if a, ok := d.(prefixDumper); ok {
+		return a.DumpPrefix(key)
 	}
-	return res, nil
+	return d.Dump()
 }
 
 // Memory is datastore driver for "in memory"
 type Memory struct {
 	Store map[interface{}]interface{}
 	mu    sync.RWMutex
+
+	// unique and sorted are the Index, initialized at first write
+	unique map[string]map[string]string
+	sorted map[string]map[string]float64
 }
 
 // NewMemory create memory object
@@ -85,12 +103,17 @@ func NewMemory(_ *Config) *Memory {
 	}
 }
 
+// Close do nothing, the entries are released with the Memory
+func (m *Memory) Close() error {
+	return nil
+}
+
 // Set save item
 func (m *Memory) Set(key, value interface{}) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.Store[key] = value
+	m.Store[key] = rowValue(value)
 	return nil
 }
 
@@ -120,218 +143,24 @@ func (m *Memory) Dump() (map[interface{}]interface{}, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return m.Store, nil
-}
-
-// Redis is datastore driver for redis
-type Redis struct {
-	Pool *redis.Pool
-}
-
-// NewRedis return redis client
-func NewRedis(cfg *Config) (*Redis, error) {
-	c := cfg.Redis
-	pool := newPool(c.Addr)
-	_, err := pool.Dial()
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to connect redis")
-	}
-	return &Redis{
-		Pool: pool,
-	}, nil
-}
-
-// newPool return redis connection pool
-func newPool(addr string) *redis.Pool {
-	return &redis.Pool{
-		MaxIdle:     3,
-		MaxActive:   1,
-		Wait:        true,
-		IdleTimeout: 240 * time.Second,
-		Dial: func() (redis.Conn, error) {
-			return redis.Dial("tcp", addr)
-		},
-		TestOnBorrow: func(c redis.Conn, t time.Time) error {
-			_, err := c.Do("PING")
-			return err
-		},
-	}
-}
-
-// Set save item
-func (r *Redis) Set(key, value interface{}) error {
-	conn := r.Pool.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("SET", key, value)
-	return err
-}
-
-// Get get item
-func (r *Redis) Get(key interface{}) (interface{}, error) {
-	conn := r.Pool.Get()
-	defer conn.Close()
-
-	v, err := redis.Bytes(conn.Do("GET", key))
-	if err != nil {
-		return nil, errors.Wrapf(ErrNotFoundEntry, fmt.Sprintf("detail %v", err))
-	}
-	return v, nil
-}
-
-// Delete delete item
-func (r *Redis) Delete(key interface{}) error {
-	conn := r.Pool.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
-
-// Dump return stored items
-func (r *Redis) Dump() (map[interface{}]interface{}, error) {
-	return r.DumpPrefix("")
-}
-
-// DumpPrefix return stored items when match prefix key
-func (r *Redis) DumpPrefix(p string) (map[interface{}]interface{}, error) {
-	conn := r.Pool.Get()
-	defer conn.Close()
-
-	// get keys
-	keys, err := redis.Strings(conn.Do("KEYS", p+"*"))
-	if err != nil {
-		return nil, err
-	}
-	if len(keys) == 0 {
-		return make(map[interface{}]interface{}), nil
-	}
-
-	args := make([]interface{}, 0)
-	for _, k := range keys {
-		args = append(args, k)
-	}
-
-	// get values
-	values, err := redis.ByteSlices(conn.Do("MGET", args...))
-	if err != nil {
-		return nil, err
-	}
-
-	// key-valus to map
-	res := make(map[interface{}]interface{}, len(keys))
-	for i, k := range keys {
-		res[k] = values[i]
+	// copy, not to share the map with the caller
+	res := make(map[interface{}]interface{}, len(m.Store))
+	for k, v := range m.Store {
+		res[k] = v
 	}
 	return res, nil
 }
 
-// MySQL is MySQL datastore driver
-type MySQL struct {
-	Conn *sql.DB
-}
-
-type generalSchema struct {
-	id    string
-	value []byte
-}
-
-// NewMySQL return MySQL client
-func NewMySQL(cfg *Config) (*MySQL, error) {
-	c := cfg.MySQL
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/pubsub", c.User, c.Password, c.Addr))
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to connect mysql")
-	}
-	if err := db.Ping(); err != nil {
-		return nil, err
-	}
-
-	return &MySQL{
-		Conn: db,
-	}, nil
-}
-
-// Set save item
-func (m *MySQL) Set(key, value interface{}) error {
-	stmt, err := m.Conn.Prepare(`INSERT INTO pubsub (id, value) VALUES (?, ?) 
-		ON DUPLICATE KEY UPDATE value=?`)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	if _, err := stmt.Exec(key, value, value); err != nil {
-		return err
-	}
-	return nil
-}
-
-// Get get item
-func (m *MySQL) Get(key interface{}) (interface{}, error) {
-	stmt, err := m.Conn.Prepare("SELECT value FROM pubsub WHERE id=?")
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
-
-	var s generalSchema
-	if err := stmt.QueryRow(key).Scan(&s.value); err != nil {
-		return nil, errors.Wrapf(ErrNotFoundEntry, fmt.Sprintf("detail %v", err))
-	}
-	return s.value, nil
-}
-
-// Delete delete item
-func (m *MySQL) Delete(key interface{}) error {
-	stmt, err := m.Conn.Prepare("DELETE FROM pubsub WHERE id=?")
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	if _, err := stmt.Exec(key); err != nil {
-		return err
-	}
-	return nil
-}
-
-// Dump return stored items
-func (m *MySQL) Dump() (map[interface{}]interface{}, error) {
-	rows, err := m.Conn.Query("SELECT id, value FROM pubsub")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	return m.convertRowsToMap(rows)
-}
-
 // DumpPrefix return stored items when match prefix key
-func (m *MySQL) DumpPrefix(p string) (map[interface{}]interface{}, error) {
-	stmt, err := m.Conn.Prepare("SELECT id, value FROM pubsub WHERE id like ?")
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
-
-	rows, err := stmt.Query(p + "%")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	return m.convertRowsToMap(rows)
-}
+func (m *Memory) DumpPrefix(p string) (map[interface{}]interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 
-func (m *MySQL) convertRowsToMap(rows *sql.Rows) (map[interface{}]interface{}, error) {
-	res := make(map[interface{}]interface{}, 0)
-	for rows.Next() {
-		var s generalSchema
-		if err := rows.Scan(&s.id, &s.value); err != nil {
-			return nil, err
+	res := make(map[interface{}]interface{})
+	for k, v := range m.Store {
+		if s, ok := k.(string); ok && strings.HasPrefix(s, p) {
+			res[k] = v
 		}
-		res[s.id] = s.value
 	}
 	return res, nil
 }
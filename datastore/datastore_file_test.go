@@ -0,0 +1,157 @@
+package datastore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func dummyFile(t *testing.T) (*File, func()) {
+	dir, err := ioutil.TempDir("", "pubsub")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	f, err := NewFile(&Config{
+		File: &FileConfig{
+			Path: filepath.Join(dir, "pubsub.db"),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to open file, got err %v", err)
+	}
+	return f, func() {
+		f.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFileSetAndGet(t *testing.T) {
+	cases := []struct {
+		inputSet    map[string]string
+		inputDelete []string
+		input       string
+		expect      []byte
+		expectErr   error
+	}{
+		{map[string]string{"a": "A"}, nil, "a", []byte("A"), nil},
+		{map[string]string{"a": "A"}, []string{"a"}, "a", nil, ErrNotFoundEntry},
+		{nil, nil, "a", nil, ErrNotFoundEntry},
+	}
+	for i, c := range cases {
+		f, cleanup := dummyFile(t)
+		for k, v := range c.inputSet {
+			if err := f.Set(k, []byte(v)); err != nil {
+				t.Fatalf("#%d: failed to set, got err %v", i, err)
+			}
+		}
+		for _, k := range c.inputDelete {
+			if err := f.Delete(k); err != nil {
+				t.Fatalf("#%d: failed to delete, got err %v", i, err)
+			}
+		}
+		got, err := f.Get(c.input)
+		if errors.Cause(err) != c.expectErr {
+			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+		if c.expect != nil && !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+		cleanup()
+	}
+}
+
+func TestFileDumpPrefix(t *testing.T) {
+	f, cleanup := dummyFile(t)
+	defer cleanup()
+	for _, k := range []string{"message_a", "message_status_b", "topic_c"} {
+		if err := f.Set(k, &Row{Value: []byte(k)}); err != nil {
+			t.Fatalf("failed to set, got err %v", err)
+		}
+	}
+
+	cases := []struct {
+		input  string
+		expect map[interface{}]interface{}
+	}{
+		{"message_status_", map[interface{}]interface{}{"message_status_b": []byte("message_status_b")}},
+		{"topic_", map[interface{}]interface{}{"topic_c": []byte("topic_c")}},
+		{"snapshot_", map[interface{}]interface{}{}},
+	}
+	for i, c := range cases {
+		got, err := f.DumpPrefix(c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestFileSortedIndex(t *testing.T) {
+	f, cleanup := dummyFile(t)
+	defer cleanup()
+	b := f.Batch()
+	b.AddSortedIndex("sub", "A", "c", -1)
+	b.AddSortedIndex("sub", "A", "b", 2)
+	b.AddSortedIndex("sub", "A", "a", 2)
+	b.AddSortedIndex("sub", "A", "d", 1.5)
+	b.AddSortedIndex("sub", "B", "e", 0)
+	if err := b.Commit(); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	// update the score and remove
+	f.AddSortedIndex("sub", "A", "d", 3)
+	f.RemoveSortedIndex("sub", "A", "b")
+
+	cases := []struct {
+		input  string
+		expect []string
+	}{
+		{"A", []string{"c", "a", "d"}},
+		{"B", []string{"e"}},
+		{"C", []string{}},
+	}
+	for i, c := range cases {
+		got, err := f.RangeSortedIndex("sub", c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestFilePersist(t *testing.T) {
+	f, cleanup := dummyFile(t)
+	defer cleanup()
+	cfg := &Config{File: &FileConfig{Path: f.DB.Path()}}
+	if err := f.Set("a", []byte("A")); err != nil {
+		t.Fatalf("failed to set, got err %v", err)
+	}
+	if err := f.SetUniqueIndex("ack", "x", "a"); err != nil {
+		t.Fatalf("failed to set index, got err %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("failed to close, got err %v", err)
+	}
+
+	// reopen
+	f, err := NewFile(cfg)
+	if err != nil {
+		t.Fatalf("failed to open file, got err %v", err)
+	}
+	got, err := f.Get("a")
+	if err != nil || !reflect.DeepEqual(got, []byte("A")) {
+		t.Errorf("want A, got %v and err %v", got, err)
+	}
+	key, err := f.GetUniqueIndex("ack", "x")
+	if err != nil || key != "a" {
+		t.Errorf("want a, got %s and err %v", key, err)
+	}
+}
@@ -134,3 +134,125 @@ func TestMemoryDelete(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadDatastoreNewMemory(t *testing.T) {
+	cfg := &Config{}
+	a, err := LoadDatastore(cfg)
+	if err != nil {
+		t.Fatalf("failed to load datastore, got err %v", err)
+	}
+	b, err := LoadDatastore(cfg)
+	if err != nil {
+		t.Fatalf("failed to load datastore, got err %v", err)
+	}
+	if a == b {
+		t.Errorf("want new memory for each load, got shared %p", a)
+	}
+}
+
+func TestMemoryBatch(t *testing.T) {
+	msgA := dummy{ID: "a"}
+	msgB := dummy{ID: "b"}
+
+	cases := []struct {
+		inputSet    []dummy
+		inputDelete []string
+		expectStore map[interface{}]interface{}
+	}{
+		{
+			[]dummy{msgA, msgB},
+			nil,
+			map[interface{}]interface{}{"a": msgA, "b": msgB},
+		},
+		{
+			[]dummy{msgA, msgB},
+			[]string{"a"},
+			map[interface{}]interface{}{"b": msgB},
+		},
+		{
+			nil,
+			nil,
+			map[interface{}]interface{}{},
+		},
+	}
+	for i, c := range cases {
+		m := NewMemory(nil)
+		b := m.Batch()
+		for _, v := range c.inputSet {
+			b.Set(v.ID, v)
+		}
+		for _, k := range c.inputDelete {
+			b.Delete(k)
+		}
+		if len(m.Store) != 0 {
+			t.Fatalf("#%d: want not applied before commit, got %v", i, m.Store)
+		}
+		if err := b.Commit(); err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if !reflect.DeepEqual(m.Store, c.expectStore) {
+			t.Errorf("#%d: want %v, got %v", i, c.expectStore, m.Store)
+		}
+	}
+}
+
+func TestMemoryUniqueIndex(t *testing.T) {
+	cases := []struct {
+		set       map[string]string
+		delete    []string
+		input     string
+		expectKey string
+		expectErr error
+	}{
+		{map[string]string{"ack1": "a"}, nil, "ack1", "a", nil},
+		{map[string]string{"ack1": "a"}, []string{"ack1"}, "ack1", "", ErrNotFoundEntry},
+		{nil, nil, "ack1", "", ErrNotFoundEntry},
+	}
+	for i, c := range cases {
+		m := NewMemory(nil)
+		for f, k := range c.set {
+			m.SetUniqueIndex("ack", f, k)
+		}
+		for _, f := range c.delete {
+			m.DeleteUniqueIndex("ack", f)
+		}
+		got, err := m.GetUniqueIndex("ack", c.input)
+		if errors.Cause(err) != c.expectErr {
+			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+		if got != c.expectKey {
+			t.Errorf("#%d: want %s, got %s", i, c.expectKey, got)
+		}
+	}
+}
+
+func TestMemorySortedIndex(t *testing.T) {
+	m := NewMemory(nil)
+	b := m.Batch()
+	b.AddSortedIndex("sub", "A", "c", 1)
+	b.AddSortedIndex("sub", "A", "b", 2)
+	b.AddSortedIndex("sub", "A", "a", 2)
+	b.AddSortedIndex("sub", "B", "d", 0)
+	if err := b.Commit(); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	m.RemoveSortedIndex("sub", "A", "b")
+
+	cases := []struct {
+		input  string
+		expect []string
+	}{
+		{"A", []string{"c", "a"}},
+		{"B", []string{"d"}},
+		{"C", []string{}},
+	}
+	for i, c := range cases {
+		got, err := m.RangeSortedIndex("sub", c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
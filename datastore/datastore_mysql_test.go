@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 	fixture "github.com/takashabe/go-fixture"
 	_ "github.com/takashabe/go-fixture/mysql"
@@ -174,3 +175,110 @@ func TestMySQLDump(t *testing.T) {
 		}
 	}
 }
+
+func TestMySQLMigrateFromVersion1(t *testing.T) {
+	client := dummyMySQL(t)
+	clearTable(t, client.Conn)
+
+	// back to the version 1, the entries are stored in the key-value table with the key prefix
+	stmts := []string{
+		"DROP TABLE topics, subscriptions, messages, message_statuses, snapshots",
+		"DELETE FROM schema_migrations WHERE version > 1",
+	}
+	for _, stmt := range stmts {
+		if _, err := client.Conn.Exec(stmt); err != nil {
+			t.Fatalf("failed to exec %s, got err %v", stmt, err)
+		}
+	}
+	keys := []string{"topic_A", "subscription_a", "message_m", "message_status_a-m", "snapshot_s", "other"}
+	for _, k := range keys {
+		if _, err := client.Conn.Exec("INSERT INTO pubsub (id, value) VALUES (?, ?)", k, []byte(k)); err != nil {
+			t.Fatalf("failed to insert %s, got err %v", k, err)
+		}
+	}
+
+	if err := migrateMySQL(client.Conn); err != nil {
+		t.Fatalf("failed to migrate, got err %v", err)
+	}
+	for i, k := range keys {
+		v, err := client.Get(k)
+		if err != nil {
+			t.Fatalf("#%d: failed to get %s, got err %v", i, k, err)
+		}
+		if got := string(v.([]byte)); got != k {
+			t.Errorf("#%d: want %s, got %s", i, k, got)
+		}
+	}
+	var count int
+	if err := client.Conn.QueryRow("SELECT COUNT(*) FROM pubsub").Scan(&count); err != nil {
+		t.Fatalf("failed to count, got err %v", err)
+	}
+	if count != 1 {
+		t.Errorf("want only the entry without the prefix left in pubsub, got %d entries", count)
+	}
+}
+
+func TestLookupMySQLTable(t *testing.T) {
+	cases := []struct {
+		input       string
+		expectTable string
+		expectID    string
+	}{
+		{"topic_a", "topics", "a"},
+		{"subscription_a", "subscriptions", "a"},
+		{"message_a", "messages", "a"},
+		{"message_status_a-b", "message_statuses", "a-b"},
+		{"snapshot_a", "snapshots", "a"},
+		{"a", "pubsub", "a"},
+	}
+	for i, c := range cases {
+		table, id := lookupMySQLTable(c.input)
+		if table.name != c.expectTable || id != c.expectID {
+			t.Errorf("#%d: want %s and %s, got %s and %s", i, c.expectTable, c.expectID, table.name, id)
+		}
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	cases := []struct {
+		input        *MySQLConfig
+		expectAddr   string
+		expectDBName string
+		expectParams map[string]string
+		expectTLS    string
+	}{
+		{
+			&MySQLConfig{Addr: "db:3307", Host: "ignored", User: "pubsub"},
+			"db:3307", "pubsub", nil, "",
+		},
+		{
+			&MySQLConfig{Host: "db", Port: 3307, Database: "other"},
+			"db:3307", "other", nil, "",
+		},
+		{
+			&MySQLConfig{Params: map[string]string{"charset": "utf8mb4", "tls": "skip-verify"}},
+			"localhost:3306", "pubsub", map[string]string{"charset": "utf8mb4"}, "skip-verify",
+		},
+		{
+			&MySQLConfig{Params: map[string]string{"tls": "skip-verify"}, TLS: &TLSConfig{}},
+			"localhost:3306", "pubsub", nil, "pubsub-localhost:3306",
+		},
+	}
+	for i, c := range cases {
+		dsn, err := mysqlDSN(c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		got, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			t.Fatalf("#%d: failed to parse dsn %s, got err %v", i, dsn, err)
+		}
+		if got.Addr != c.expectAddr || got.DBName != c.expectDBName || got.TLSConfig != c.expectTLS {
+			t.Errorf("#%d: want %s/%s tls=%s, got %s/%s tls=%s",
+				i, c.expectAddr, c.expectDBName, c.expectTLS, got.Addr, got.DBName, got.TLSConfig)
+		}
+		if !reflect.DeepEqual(got.Params, c.expectParams) {
+			t.Errorf("#%d: want params %v, got %v", i, c.expectParams, got.Params)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func dummyPostgres(t *testing.T) *Postgres {
+	c, err := NewPostgres(&Config{
+		Postgres: &PostgresConfig{
+			Addr:     "localhost:5432",
+			User:     getEnvWithDefault("PG_USER", "pubsub"),
+			Password: getEnvWithDefault("PG_PASSWORD", ""),
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to connect postgres, got err %v", err)
+	}
+	if _, err := c.Conn.Exec(`TRUNCATE pubsub, pubsub_unique_index, pubsub_sorted_index,
+		topics, subscriptions, messages, message_statuses, snapshots`); err != nil {
+		t.Fatalf("failed to truncate tables, got err %v", err)
+	}
+	return c
+}
+
+func TestPostgresDSN(t *testing.T) {
+	cases := []struct {
+		input  *PostgresConfig
+		expect string
+	}{
+		{
+			&PostgresConfig{Addr: "localhost:5432", User: "pubsub"},
+			"postgres://pubsub:@localhost:5432/pubsub?sslmode=disable",
+		},
+		{
+			&PostgresConfig{Addr: "db:5432", User: "u", Password: "p@ss", Database: "d", SSLMode: "require"},
+			"postgres://u:p%40ss@db:5432/d?sslmode=require",
+		},
+	}
+	for i, c := range cases {
+		if got := postgresDSN(c.input); got != c.expect {
+			t.Errorf("#%d: want %s, got %s", i, c.expect, got)
+		}
+	}
+}
+
+func TestPostgresSetAndDump(t *testing.T) {
+	type kv struct {
+		id    string
+		value *dummy
+	}
+	cases := []struct {
+		inputEntries []kv
+		inputPrefix  string
+		expect       map[interface{}]interface{}
+	}{
+		{
+			[]kv{
+				{id: "a", value: &dummy{ID: "a"}},
+				{id: "topic_b", value: &dummy{ID: "b"}},
+			},
+			"",
+			map[interface{}]interface{}{
+				"a":       &dummy{ID: "a"},
+				"topic_b": &dummy{ID: "b"},
+			},
+		},
+		{
+			[]kv{
+				{id: "message_a", value: &dummy{ID: "a"}},
+				{id: "message_status_b", value: &dummy{ID: "b"}},
+			},
+			"message_status_",
+			map[interface{}]interface{}{
+				"message_status_b": &dummy{ID: "b"},
+			},
+		},
+	}
+	for i, c := range cases {
+		client := dummyPostgres(t)
+		for _, e := range c.inputEntries {
+			encode, err := EncodeGob(e.value)
+			if err != nil {
+				t.Fatalf("#%d: failed to encode data, got err %v", i, err)
+			}
+			if err := client.Set(e.id, encode); err != nil {
+				t.Fatalf("#%d: failed to set, key=%v, got err %v", i, e.id, err)
+			}
+		}
+
+		dump, err := client.DumpPrefix(c.inputPrefix)
+		if err != nil {
+			t.Fatalf("#%d: failed to dump, got err %v", i, err)
+		}
+		replaces := make(map[interface{}]interface{}, len(dump))
+		for k, v := range dump {
+			m, err := decodeDummy(v.([]byte))
+			if err != nil {
+				t.Fatalf("#%d: failed to decode data, got err %v", i, err)
+			}
+			replaces[k] = m
+		}
+		if !reflect.DeepEqual(c.expect, replaces) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, replaces)
+		}
+	}
+}
+
+func TestPostgresLockSortedIndex(t *testing.T) {
+	client := dummyPostgres(t)
+	now := time.Now()
+	for i, id := range []string{"a", "b", "c"} {
+		err := client.Set("message_status_"+id, &Row{
+			Value: []byte(id),
+			Columns: map[string]interface{}{
+				"subscription_id": "sub",
+				"published_at":    now.Add(time.Duration(i) * time.Second),
+				"publish_order":   int64(i + 1),
+				"visible_at":      now.Add(-time.Second),
+			},
+		})
+		if err != nil {
+			t.Fatalf("failed to set, got err %v", err)
+		}
+	}
+
+	// the other process skip the locked entries
+	var locked, other []string
+	err := client.LockSortedIndex("message_status_subscription", "sub", 2, now, func(values [][]byte, b Batch) error {
+		for _, v := range values {
+			locked = append(locked, string(v))
+		}
+		return client.LockSortedIndex("message_status_subscription", "sub", 2, now, func(values [][]byte, b Batch) error {
+			for _, v := range values {
+				other = append(other, string(v))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if !reflect.DeepEqual(locked, []string{"a", "b"}) {
+		t.Errorf("want [a b], got %v", locked)
+	}
+	if !reflect.DeepEqual(other, []string{"c"}) {
+		t.Errorf("want [c], got %v", other)
+	}
+}
+
+func TestPostgresLock(t *testing.T) {
+	client := dummyPostgres(t)
+
+	// the other process wait until fn return
+	var order []string
+	done := make(chan error)
+	err := client.Lock("ordering_sub", func() error {
+		go func() {
+			done <- client.Lock("ordering_sub", func() error {
+				order = append(order, "other")
+				return nil
+			})
+		}()
+		time.Sleep(100 * time.Millisecond)
+		order = append(order, "locked")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if !reflect.DeepEqual(order, []string{"locked", "other"}) {
+		t.Errorf("want [locked other], got %v", order)
+	}
+}
@@ -1,7 +1,14 @@
 package datastore
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/garyburd/redigo/redis"
@@ -54,3 +61,355 @@ func TestRedisSetAndGet(t *testing.T) {
 		}
 	}
 }
+
+// fakeRedisStatus is the simple string reply of the fakeRedis
+type fakeRedisStatus string
+
+// fakeRedis is the RESP server replied by the handler, to test the connection without the Redis server
+type fakeRedis struct {
+	ln      net.Listener
+	handler func(args []string) interface{}
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, handler func(args []string) interface{}) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen, got err %v", err)
+	}
+	f := &fakeRedis{ln: ln, handler: handler}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) addr() string { return f.ln.Addr().String() }
+
+func (f *fakeRedis) close() { f.ln.Close() }
+
+// received return the received command names
+func (f *fakeRedis) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.commands...)
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.ToUpper(args[0]))
+		f.mu.Unlock()
+		writeFakeRedisReply(conn, f.handler(args))
+	}
+}
+
+// readFakeRedisCommand read the command sent as the array of the bulk strings
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func writeFakeRedisReply(w io.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		fmt.Fprint(w, "$-1\r\n")
+	case fakeRedisStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case redis.Error:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeFakeRedisReply(w, e)
+		}
+	}
+}
+
+// fakeRedisMaster return the handler of the master node stored the entries to the map
+func fakeRedisMaster(role string) func(args []string) interface{} {
+	var mu sync.Mutex
+	store := make(map[string]string)
+	return func(args []string) interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "ROLE":
+			return []interface{}{role}
+		case "SET":
+			store[args[1]] = args[2]
+			return fakeRedisStatus("OK")
+		case "GET":
+			if v, ok := store[args[1]]; ok {
+				return v
+			}
+			return nil
+		default:
+			return fakeRedisStatus("OK")
+		}
+	}
+}
+
+func TestRedisConfigAddr(t *testing.T) {
+	cases := []struct {
+		input  *RedisConfig
+		expect string
+	}{
+		{&RedisConfig{Addr: "redis:6380", Host: "ignored"}, "redis:6380"},
+		{&RedisConfig{Host: "redis", Port: 6380}, "redis:6380"},
+		{&RedisConfig{Host: "redis"}, "redis:6379"},
+		{&RedisConfig{}, "localhost:6379"},
+	}
+	for i, c := range cases {
+		if got := c.input.addr(); got != c.expect {
+			t.Errorf("#%d: want %s, got %s", i, c.expect, got)
+		}
+	}
+}
+
+func TestNewRedisPool(t *testing.T) {
+	cases := []struct {
+		input           *RedisConfig
+		expectMaxActive int
+		expectErr       bool
+	}{
+		{&RedisConfig{}, defaultRedisMaxActive, false},
+		{&RedisConfig{MaxActive: 50}, 50, false},
+		{&RedisConfig{Sentinel: &RedisSentinelConfig{}}, 0, true},
+		{&RedisConfig{SingleSlotCluster: &RedisSingleSlotClusterConfig{}}, 0, true},
+		{&RedisConfig{SingleSlotCluster: &RedisSingleSlotClusterConfig{Addrs: []string{"a:7000"}}, DB: 1}, 0, true},
+		{&RedisConfig{TLS: &TLSConfig{CAFile: "not_exist.pem"}}, 0, true},
+	}
+	for i, c := range cases {
+		pool, err := newRedisPool(c.input)
+		if got := err != nil; got != c.expectErr {
+			t.Fatalf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+		if err == nil && pool.MaxActive != c.expectMaxActive {
+			t.Errorf("#%d: want max active %d, got %d", i, c.expectMaxActive, pool.MaxActive)
+		}
+	}
+}
+
+func TestRedisAuthAndSelect(t *testing.T) {
+	master := newFakeRedis(t, fakeRedisMaster("master"))
+	defer master.close()
+
+	_, err := NewRedis(&Config{
+		Redis: &RedisConfig{Addr: master.addr(), Password: "secret", DB: 2},
+	})
+	if err != nil {
+		t.Fatalf("failed to connect redis, got err %v", err)
+	}
+	expect := []string{"AUTH", "SELECT"}
+	if got := master.received(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("want commands %v, got %v", expect, got)
+	}
+}
+
+func TestRedisSentinel(t *testing.T) {
+	cases := []struct {
+		role      string
+		expectErr bool
+	}{
+		{"master", false},
+		// the demoted master during the failover
+		{"slave", true},
+	}
+	for i, c := range cases {
+		master := newFakeRedis(t, fakeRedisMaster(c.role))
+		host, port, _ := net.SplitHostPort(master.addr())
+		sentinel := newFakeRedis(t, func(args []string) interface{} {
+			if strings.ToUpper(args[0]) == "SENTINEL" && args[2] == "mymaster" {
+				return []interface{}{host, port}
+			}
+			return nil
+		})
+
+		r, err := NewRedis(&Config{
+			Redis: &RedisConfig{
+				Sentinel: &RedisSentinelConfig{
+					MasterName: "mymaster",
+					// the first sentinel is down
+					Addrs: []string{"127.0.0.1:1", sentinel.addr()},
+				},
+			},
+		})
+		if got := err != nil; got != c.expectErr {
+			t.Fatalf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+		if err == nil {
+			if err := r.Set("a", []byte("A")); err != nil {
+				t.Fatalf("#%d: failed to set, got err %v", i, err)
+			}
+			if got, err := r.Get("a"); err != nil || string(got.([]byte)) != "A" {
+				t.Errorf("#%d: want A, got %v, err %v", i, got, err)
+			}
+		}
+		master.close()
+		sentinel.close()
+	}
+}
+
+func TestRedisCluster(t *testing.T) {
+	node := newFakeRedis(t, fakeRedisMaster("master"))
+	defer node.close()
+	moved := newFakeRedis(t, func(args []string) interface{} {
+		if strings.ToUpper(args[0]) == "GET" {
+			return redis.Error("MOVED 1 " + node.addr())
+		}
+		return fakeRedisStatus("OK")
+	})
+	defer moved.close()
+	_, port, _ := net.SplitHostPort(moved.addr())
+	seed := newFakeRedis(t, func(args []string) interface{} {
+		// the empty host is the seed itself
+		p, _ := strconv.Atoi(port)
+		return []interface{}{
+			[]interface{}{0, redisClusterSlots - 1, []interface{}{"", p, "id"}},
+		}
+	})
+	defer seed.close()
+
+	r, err := NewRedis(&Config{
+		Redis: &RedisConfig{
+			SingleSlotCluster: &RedisSingleSlotClusterConfig{Addrs: []string{seed.addr()}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to connect redis cluster, got err %v", err)
+	}
+	if r.key("a") != "{pubsub}a" {
+		t.Errorf("want the key with the hash tag, got %s", r.key("a"))
+	}
+
+	// the connection to the moved node is discarded, and the next connection is the new node
+	if _, err := r.Get("a"); err == nil {
+		t.Fatalf("want error by MOVED")
+	}
+	if err := r.Set("a", []byte("A")); err != nil {
+		t.Fatalf("failed to set, got err %v", err)
+	}
+	if got, err := r.Get("a"); err != nil || string(got.([]byte)) != "A" {
+		t.Errorf("want A, got %v, err %v", got, err)
+	}
+}
+
+func TestRedisSlot(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect int
+	}{
+		{"123456789", 12739},
+		{"foo", 12182},
+		{"{foo}bar", 12182},
+		{"{pubsub}topic_a", redisSlot("pubsub")},
+	}
+	for i, c := range cases {
+		if got := redisSlot(c.input); got != c.expect {
+			t.Errorf("#%d: want %d, got %d", i, c.expect, got)
+		}
+	}
+}
+
+func TestParseRedisClusterSlots(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{int64(0), int64(5460), []interface{}{[]byte("10.0.0.1"), int64(7000), []byte("a")}},
+		[]interface{}{int64(5461), int64(16383), []interface{}{[]byte(""), int64(7001), []byte("b")}},
+	}
+	cases := []struct {
+		slot      int
+		expect    string
+		expectErr bool
+	}{
+		{0, "10.0.0.1:7000", false},
+		{5461, "seed:7001", false},
+		{16384, "", true},
+	}
+	for i, c := range cases {
+		got, err := parseRedisClusterSlots(reply, c.slot, "seed:7000")
+		if gotErr := err != nil; gotErr != c.expectErr {
+			t.Fatalf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+		if got != c.expect {
+			t.Errorf("#%d: want %s, got %s", i, c.expect, got)
+		}
+	}
+}
+
+func TestRedisBatchCommit(t *testing.T) {
+	cases := []struct {
+		execReply interface{}
+		expectErr bool
+	}{
+		{[]interface{}{fakeRedisStatus("OK"), 1}, false},
+		// the failed command in the transaction
+		{[]interface{}{fakeRedisStatus("OK"), redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")}, true},
+		{redis.Error("EXECABORT Transaction discarded because of previous errors."), true},
+	}
+	for i, c := range cases {
+		master := newFakeRedis(t, func(args []string) interface{} {
+			switch strings.ToUpper(args[0]) {
+			case "EXEC":
+				return c.execReply
+			case "MULTI":
+				return fakeRedisStatus("OK")
+			default:
+				return fakeRedisStatus("QUEUED")
+			}
+		})
+		r, err := NewRedis(&Config{Redis: &RedisConfig{Addr: master.addr()}})
+		if err != nil {
+			t.Fatalf("#%d: failed to connect redis, got err %v", i, err)
+		}
+		b := r.Batch()
+		b.Set("key", &Row{Value: []byte("value")})
+		b.AddSortedIndex("index", "field", "key", 1)
+		err = b.Commit()
+		if got := err != nil; got != c.expectErr {
+			t.Errorf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+		master.close()
+	}
+}
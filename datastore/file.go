@@ -0,0 +1,326 @@
+package datastore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// the buckets of the File
+var (
+	fileEntryBucket       = []byte("entries")
+	fileUniqueIndexBucket = []byte("unique_index")
+	// fileSortedIndexBucket hold the keys "index\x00field\x00score+key", iterated in the order of the score
+	fileSortedIndexBucket = []byte("sorted_index")
+	// fileSortedScoreBucket hold the score of "index\x00field\x00key" to remove from the sorted index
+	fileSortedScoreBucket = []byte("sorted_score")
+)
+
+// fileOpenTimeout is timeout to get the file lock, the file is locked by the other process
+const fileOpenTimeout = 3 * time.Second
+
+// fileStores is File shared for each path, the file is able to open once
+var (
+	fileStores   = make(map[string]*File)
+	fileStoresMu sync.Mutex
+)
+
+// File is datastore driver for the single file embedded database by the bbolt
+type File struct {
+	DB *bolt.DB
+
+	// refs is number of the NewFile not yet closed, guarded by the fileStoresMu
+	refs int
+}
+
+// NewFile return File opened the path, the File of the same path is shared until all of them are closed
+func NewFile(cfg *Config) (*File, error) {
+	path := cfg.File.Path
+	if path == "" {
+		return nil, errors.New("require file path")
+	}
+
+	fileStoresMu.Lock()
+	defer fileStoresMu.Unlock()
+	if f, ok := fileStores[path]; ok {
+		f.refs++
+		return f, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: fileOpenTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open file, path=%s", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{fileEntryBucket, fileUniqueIndexBucket, fileSortedIndexBucket, fileSortedScoreBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to create buckets")
+	}
+
+	f := &File{DB: db, refs: 1}
+	fileStores[path] = f
+	return f, nil
+}
+
+// Close close the file when all NewFile of the path are closed, and the file is opened again by NewFile
+func (f *File) Close() error {
+	fileStoresMu.Lock()
+	defer fileStoresMu.Unlock()
+
+	if f.refs--; f.refs > 0 {
+		return nil
+	}
+	delete(fileStores, f.DB.Path())
+	return f.DB.Close()
+}
+
+// fileKey return the key bytes
+func fileKey(key interface{}) []byte {
+	return []byte(fmt.Sprint(key))
+}
+
+// fileValue return the value bytes, the File store only []byte
+func fileValue(value interface{}) ([]byte, error) {
+	switch v := rowValue(value).(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	default:
+		return nil, errors.Errorf("not supported value type %T", v)
+	}
+}
+
+// copyBytes return copied bytes, the bytes of the bbolt is valid only in the transaction
+func copyBytes(b []byte) []byte {
+	res := make([]byte, len(b))
+	copy(res, b)
+	return res
+}
+
+// Set save item
+func (f *File) Set(key, value interface{}) error {
+	b := f.Batch()
+	b.Set(key, value)
+	return b.Commit()
+}
+
+// Get get item
+func (f *File) Get(key interface{}) (interface{}, error) {
+	var res []byte
+	err := f.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(fileEntryBucket).Get(fileKey(key))
+		if v == nil {
+			return ErrNotFoundEntry
+		}
+		res = copyBytes(v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Delete delete item
+func (f *File) Delete(key interface{}) error {
+	b := f.Batch()
+	b.Delete(key)
+	return b.Commit()
+}
+
+// Dump return stored items
+func (f *File) Dump() (map[interface{}]interface{}, error) {
+	return f.DumpPrefix("")
+}
+
+// DumpPrefix return stored items when match prefix key, iterate only the matched keys
+func (f *File) DumpPrefix(p string) (map[interface{}]interface{}, error) {
+	res := make(map[interface{}]interface{})
+	err := f.DB.View(func(tx *bolt.Tx) error {
+		prefix := []byte(p)
+		c := tx.Bucket(fileEntryBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			res[string(k)] = copyBytes(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// File index, stored in the buckets
+
+func fileUniqueIndexKey(index, field string) []byte {
+	return []byte(index + "\x00" + field)
+}
+
+func fileSortedIndexPrefix(index, field string) []byte {
+	return []byte(index + "\x00" + field + "\x00")
+}
+
+// encodeScore return the bytes ordered same as the score
+func encodeScore(score float64) []byte {
+	bits := math.Float64bits(score)
+	if score >= 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	res := make([]byte, 8)
+	binary.BigEndian.PutUint64(res, bits)
+	return res
+}
+
+func fileSetUniqueIndex(tx *bolt.Tx, index, field, key string) error {
+	return tx.Bucket(fileUniqueIndexBucket).Put(fileUniqueIndexKey(index, field), []byte(key))
+}
+
+func fileDeleteUniqueIndex(tx *bolt.Tx, index, field string) error {
+	return tx.Bucket(fileUniqueIndexBucket).Delete(fileUniqueIndexKey(index, field))
+}
+
+func fileAddSortedIndex(tx *bolt.Tx, index, field, key string, score float64) error {
+	if err := fileRemoveSortedIndex(tx, index, field, key); err != nil {
+		return err
+	}
+	prefix := fileSortedIndexPrefix(index, field)
+	scoreKey := append(append(copyBytes(prefix), encodeScore(score)...), key...)
+	if err := tx.Bucket(fileSortedIndexBucket).Put(scoreKey, []byte(key)); err != nil {
+		return err
+	}
+	return tx.Bucket(fileSortedScoreBucket).Put(append(prefix, key...), encodeScore(score))
+}
+
+func fileRemoveSortedIndex(tx *bolt.Tx, index, field, key string) error {
+	prefix := fileSortedIndexPrefix(index, field)
+	scores := tx.Bucket(fileSortedScoreBucket)
+	score := scores.Get(append(copyBytes(prefix), key...))
+	if score == nil {
+		return nil
+	}
+	scoreKey := append(append(copyBytes(prefix), score...), key...)
+	if err := tx.Bucket(fileSortedIndexBucket).Delete(scoreKey); err != nil {
+		return err
+	}
+	return scores.Delete(append(prefix, key...))
+}
+
+// SetUniqueIndex save the key of the field
+func (f *File) SetUniqueIndex(index, field, key string) error {
+	return f.DB.Update(func(tx *bolt.Tx) error {
+		return fileSetUniqueIndex(tx, index, field, key)
+	})
+}
+
+// GetUniqueIndex get the key of the field
+func (f *File) GetUniqueIndex(index, field string) (string, error) {
+	var res string
+	err := f.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(fileUniqueIndexBucket).Get(fileUniqueIndexKey(index, field))
+		if v == nil {
+			return ErrNotFoundEntry
+		}
+		res = string(v)
+		return nil
+	})
+	return res, err
+}
+
+// DeleteUniqueIndex delete the key of the field
+func (f *File) DeleteUniqueIndex(index, field string) error {
+	return f.DB.Update(func(tx *bolt.Tx) error {
+		return fileDeleteUniqueIndex(tx, index, field)
+	})
+}
+
+// AddSortedIndex add the key to the field with score
+func (f *File) AddSortedIndex(index, field, key string, score float64) error {
+	return f.DB.Update(func(tx *bolt.Tx) error {
+		return fileAddSortedIndex(tx, index, field, key, score)
+	})
+}
+
+// RemoveSortedIndex remove the key from the field
+func (f *File) RemoveSortedIndex(index, field, key string) error {
+	return f.DB.Update(func(tx *bolt.Tx) error {
+		return fileRemoveSortedIndex(tx, index, field, key)
+	})
+}
+
+// RangeSortedIndex return the keys of the field ordered by score, and the key when same score
+func (f *File) RangeSortedIndex(index, field string) ([]string, error) {
+	res := make([]string, 0)
+	err := f.DB.View(func(tx *bolt.Tx) error {
+		prefix := fileSortedIndexPrefix(index, field)
+		c := tx.Bucket(fileSortedIndexBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			res = append(res, string(v))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// fileBatch apply operations in the bbolt transaction
+type fileBatch struct {
+	batchOps
+	f *File
+}
+
+// Batch return Batch for the File
+func (f *File) Batch() Batch {
+	return &fileBatch{f: f}
+}
+
+// Commit apply all operations in the transaction, rollback when any operation failed
+func (b *fileBatch) Commit() error {
+	if len(b.batchOps) == 0 {
+		return nil
+	}
+	return b.f.DB.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(fileEntryBucket)
+		for _, op := range b.batchOps {
+			var err error
+			switch op.kind {
+			case opSet:
+				var v []byte
+				if v, err = fileValue(op.value); err == nil {
+					err = entries.Put(fileKey(op.key), v)
+				}
+			case opDelete:
+				err = entries.Delete(fileKey(op.key))
+			case opSetUniqueIndex:
+				err = fileSetUniqueIndex(tx, op.index, op.field, op.key.(string))
+			case opDeleteUniqueIndex:
+				err = fileDeleteUniqueIndex(tx, op.index, op.field)
+			case opAddSortedIndex:
+				err = fileAddSortedIndex(tx, op.index, op.field, op.key.(string), op.score)
+			case opRemoveSortedIndex:
+				err = fileRemoveSortedIndex(tx, op.index, op.field, op.key.(string))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
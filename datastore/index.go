@@ -0,0 +1,206 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// Index is the secondary index of the stored entries, maintained by the caller.
+// the unique index map a field to the key, the sorted index hold the keys of a field ordered by score.
+type Index interface {
+	SetUniqueIndex(index, field, key string) error
+	GetUniqueIndex(index, field string) (string, error)
+	DeleteUniqueIndex(index, field string) error
+
+	AddSortedIndex(index, field, key string, score float64) error
+	RemoveSortedIndex(index, field, key string) error
+	// RangeSortedIndex return the keys in ascending order of the score
+	RangeSortedIndex(index, field string) ([]string, error)
+}
+
+// Locker is the Datastore able to lock the entries of the sorted index between the server processes
+type Locker interface {
+	// LockSortedIndex lock up to limit entries of the sorted index field visible at now in the order,
+	// skipping the entries locked by the others. fn receive the locked values and add the updates to the Batch,
+	// the updates are committed with releasing the locks, nothing is committed when fn return error.
+	LockSortedIndex(index, field string, limit int, now time.Time, fn func(values [][]byte, b Batch) error) error
+	// Lock run fn holding the lock of the name, the other server processes wait for the same name until fn return
+	Lock(name string, fn func() error) error
+}
+
+// sortedIndexName return the name of the sorted index for each field
+func sortedIndexName(index, field string) string {
+	return index + "_" + field
+}
+
+// Memory index, the caller holds the lock
+
+func (m *Memory) setUniqueIndex(index, field, key string) {
+	if m.unique == nil {
+		m.unique = make(map[string]map[string]string)
+	}
+	if m.unique[index] == nil {
+		m.unique[index] = make(map[string]string)
+	}
+	m.unique[index][field] = key
+}
+
+func (m *Memory) deleteUniqueIndex(index, field string) {
+	delete(m.unique[index], field)
+}
+
+func (m *Memory) addSortedIndex(index, field, key string, score float64) {
+	if m.sorted == nil {
+		m.sorted = make(map[string]map[string]float64)
+	}
+	name := sortedIndexName(index, field)
+	if m.sorted[name] == nil {
+		m.sorted[name] = make(map[string]float64)
+	}
+	m.sorted[name][key] = score
+}
+
+func (m *Memory) removeSortedIndex(index, field, key string) {
+	name := sortedIndexName(index, field)
+	delete(m.sorted[name], key)
+	if len(m.sorted[name]) == 0 {
+		delete(m.sorted, name)
+	}
+}
+
+// SetUniqueIndex save the key of the field
+func (m *Memory) SetUniqueIndex(index, field, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.setUniqueIndex(index, field, key)
+	return nil
+}
+
+// GetUniqueIndex get the key of the field
+func (m *Memory) GetUniqueIndex(index, field string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.unique[index][field]
+	if !ok {
+		return "", ErrNotFoundEntry
+	}
+	return key, nil
+}
+
+// DeleteUniqueIndex delete the key of the field
+func (m *Memory) DeleteUniqueIndex(index, field string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteUniqueIndex(index, field)
+	return nil
+}
+
+// AddSortedIndex add the key to the field with score
+func (m *Memory) AddSortedIndex(index, field, key string, score float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.addSortedIndex(index, field, key, score)
+	return nil
+}
+
+// RemoveSortedIndex remove the key from the field
+func (m *Memory) RemoveSortedIndex(index, field, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeSortedIndex(index, field, key)
+	return nil
+}
+
+// RangeSortedIndex return the keys of the field ordered by score, and the key when same score
+func (m *Memory) RangeSortedIndex(index, field string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	scores := m.sorted[sortedIndexName(index, field)]
+	res := make([]string, 0, len(scores))
+	for k := range scores {
+		res = append(res, k)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if scores[res[i]] != scores[res[j]] {
+			return scores[res[i]] < scores[res[j]]
+		}
+		return res[i] < res[j]
+	})
+	return res, nil
+}
+
+// Redis index, the unique index is a hash and the sorted index is a sorted set
+
+func redisUniqueIndexKey(index string) string {
+	return "index_" + index
+}
+
+func redisSortedIndexKey(index, field string) string {
+	return "index_" + sortedIndexName(index, field)
+}
+
+// SetUniqueIndex save the key of the field
+func (r *Redis) SetUniqueIndex(index, field, key string) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HSET", r.key(redisUniqueIndexKey(index)), field, key)
+	return err
+}
+
+// GetUniqueIndex get the key of the field
+func (r *Redis) GetUniqueIndex(index, field string) (string, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	v, err := redis.String(conn.Do("HGET", r.key(redisUniqueIndexKey(index)), field))
+	if err != nil {
+		return "", errors.Wrapf(ErrNotFoundEntry, fmt.Sprintf("detail %v", err))
+	}
+	return v, nil
+}
+
+// DeleteUniqueIndex delete the key of the field
+func (r *Redis) DeleteUniqueIndex(index, field string) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HDEL", r.key(redisUniqueIndexKey(index)), field)
+	return err
+}
+
+// AddSortedIndex add the key to the field with score
+func (r *Redis) AddSortedIndex(index, field, key string, score float64) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("ZADD", r.key(redisSortedIndexKey(index, field)), score, key)
+	return err
+}
+
+// RemoveSortedIndex remove the key from the field
+func (r *Redis) RemoveSortedIndex(index, field, key string) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("ZREM", r.key(redisSortedIndexKey(index, field)), key)
+	return err
+}
+
+// RangeSortedIndex return the keys of the field ordered by score
+func (r *Redis) RangeSortedIndex(index, field string) ([]string, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	return redis.Strings(conn.Do("ZRANGE", r.key(redisSortedIndexKey(index, field)), 0, -1))
+}
@@ -0,0 +1,433 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// MySQL is MySQL datastore driver, the entries are stored in the table of each key prefix
+type MySQL struct {
+	Conn *sql.DB
+
+	// stmts are the prepared statements reused by the queries
+	stmts *stmtCache
+}
+
+type generalSchema struct {
+	id    string
+	value []byte
+}
+
+// sqlTable is the table stored the entries of the key prefix, the id column hold the key without prefix
+type sqlTable struct {
+	name   string
+	prefix string
+	// columns are the searchable columns, set by the Row
+	columns []string
+}
+
+// mysqlTables are the tables of each entity, the longer prefix is first
+var mysqlTables = []sqlTable{
+	{
+		name:    "message_statuses",
+		prefix:  "message_status_",
+		columns: []string{"subscription_id", "message_id", "ack_id", "state", "delivered_at", "published_at", "publish_order"},
+	},
+	{name: "messages", prefix: "message_"},
+	{
+		name:    "subscriptions",
+		prefix:  "subscription_",
+		columns: []string{"topic_id"},
+	},
+	{name: "snapshots", prefix: "snapshot_"},
+	{name: "topics", prefix: "topic_"},
+}
+
+// mysqlGeneralTable store the entries not matched any prefix
+var mysqlGeneralTable = sqlTable{name: "pubsub"}
+
+// sqlColumnIndex is the Index served by the column of the table instead of the index tables
+type sqlColumnIndex struct {
+	table  string
+	column string
+	// order is the column of the score, used only the sorted index
+	order string
+	// visible is the column of the time to be able to lock the entry, used only the Locker
+	visible string
+}
+
+// the Index of the models served by the columns
+var (
+	mysqlUniqueColumnIndexes = map[string]sqlColumnIndex{
+		"message_status_ack_id": {table: "message_statuses", column: "ack_id"},
+	}
+	mysqlSortedColumnIndexes = map[string]sqlColumnIndex{
+		"message_status_subscription": {table: "message_statuses", column: "subscription_id", order: "publish_order"},
+	}
+)
+
+// lookupMySQLTable return the table and the id of the key
+func lookupMySQLTable(key interface{}) (sqlTable, string) {
+	return lookupSQLTable(mysqlTables, mysqlGeneralTable, key)
+}
+
+// lookupSQLTable return the table matched the prefix of the key and the id, or the general table
+func lookupSQLTable(tables []sqlTable, general sqlTable, key interface{}) (sqlTable, string) {
+	k := fmt.Sprint(key)
+	for _, t := range tables {
+		if strings.HasPrefix(k, t.prefix) {
+			return t, strings.TrimPrefix(k, t.prefix)
+		}
+	}
+	return general, k
+}
+
+// default params of the MySQL connection
+const (
+	defaultMySQLAddr     = "localhost:3306"
+	defaultMySQLPort     = 3306
+	defaultMySQLDatabase = "pubsub"
+)
+
+// NewMySQL return MySQL client, and migrate the schema to the latest
+func NewMySQL(cfg *Config) (*MySQL, error) {
+	c := cfg.MySQL
+	dsn, err := mysqlDSN(c)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect mysql")
+	}
+	db.SetMaxOpenConns(c.MaxOpenConns)
+	if c.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	if err := migrateMySQL(db); err != nil {
+		return nil, errors.Wrap(err, "failed to migrate mysql schema")
+	}
+
+	return &MySQL{
+		Conn:  db,
+		stmts: newStmtCache(db),
+	}, nil
+}
+
+// addr return the address of the MySQL
+func (c *MySQLConfig) addr() string {
+	if c.Addr != "" {
+		return c.Addr
+	}
+	if c.Host == "" {
+		return defaultMySQLAddr
+	}
+	port := c.Port
+	if port == 0 {
+		port = defaultMySQLPort
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// mysqlDSN return the DSN of the config, the TLS is registered to the driver by the name of the address
+func mysqlDSN(c *MySQLConfig) (string, error) {
+	dc := &mysql.Config{
+		User:         c.User,
+		Passwd:       c.Password,
+		Net:          "tcp",
+		Addr:         c.addr(),
+		DBName:       c.Database,
+		Timeout:      c.DialTimeout,
+		ReadTimeout:  c.ReadTimeout,
+		WriteTimeout: c.WriteTimeout,
+		Params:       make(map[string]string),
+	}
+	if dc.DBName == "" {
+		dc.DBName = defaultMySQLDatabase
+	}
+	for k, v := range c.Params {
+		dc.Params[k] = v
+	}
+	if c.TLS != nil {
+		t, err := c.TLS.build()
+		if err != nil {
+			return "", err
+		}
+		if t.ServerName == "" {
+			t.ServerName, _, _ = net.SplitHostPort(dc.Addr)
+		}
+		name := "pubsub-" + dc.Addr
+		if err := mysql.RegisterTLSConfig(name, t); err != nil {
+			return "", errors.Wrap(err, "failed to register tls config")
+		}
+		delete(dc.Params, "tls")
+		dc.TLSConfig = name
+	}
+	return dc.FormatDSN(), nil
+}
+
+// Close close the prepared statements and the connections
+func (m *MySQL) Close() error {
+	if err := m.stmts.Close(); err != nil {
+		return err
+	}
+	return m.Conn.Close()
+}
+
+// execer is the common behavior of sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// mysqlExecSet insert or update the entry and the columns
+func mysqlExecSet(e execer, key, value interface{}) error {
+	t, id := lookupMySQLTable(key)
+	var cols map[string]interface{}
+	if r, ok := value.(*Row); ok {
+		cols = r.Columns
+	}
+
+	names := append([]string{"id", "value"}, t.columns...)
+	args := []interface{}{id, rowValue(value)}
+	updates := []string{"value=VALUES(value)"}
+	for _, c := range t.columns {
+		args = append(args, cols[c])
+		updates = append(updates, fmt.Sprintf("%s=VALUES(%s)", c, c))
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON DUPLICATE KEY UPDATE %s",
+		t.name, strings.Join(names, ", "), placeholders, strings.Join(updates, ", "))
+	_, err := e.Exec(query, args...)
+	return err
+}
+
+func mysqlExecDelete(e execer, key interface{}) error {
+	t, id := lookupMySQLTable(key)
+	_, err := e.Exec(fmt.Sprintf("DELETE FROM %s WHERE id=?", t.name), id)
+	return err
+}
+
+// Set save item
+func (m *MySQL) Set(key, value interface{}) error {
+	return mysqlExecSet(m.stmts, key, value)
+}
+
+// Get get item
+func (m *MySQL) Get(key interface{}) (interface{}, error) {
+	t, id := lookupMySQLTable(key)
+
+	row, err := m.stmts.QueryRow(fmt.Sprintf("SELECT value FROM %s WHERE id=?", t.name), id)
+	if err != nil {
+		return nil, err
+	}
+	var s generalSchema
+	if err := row.Scan(&s.value); err != nil {
+		return nil, errors.Wrapf(ErrNotFoundEntry, fmt.Sprintf("detail %v", err))
+	}
+	return s.value, nil
+}
+
+// Delete delete item
+func (m *MySQL) Delete(key interface{}) error {
+	return mysqlExecDelete(m.stmts, key)
+}
+
+// Dump return stored items
+func (m *MySQL) Dump() (map[interface{}]interface{}, error) {
+	return m.DumpPrefix("")
+}
+
+// DumpPrefix return stored items when match prefix key, read only the tables possibly match
+func (m *MySQL) DumpPrefix(p string) (map[interface{}]interface{}, error) {
+	res := make(map[interface{}]interface{}, 0)
+	for _, t := range append(mysqlTables, mysqlGeneralTable) {
+		var (
+			rows *sql.Rows
+			err  error
+		)
+		switch {
+		case strings.HasPrefix(t.prefix, p):
+			rows, err = m.stmts.Query(fmt.Sprintf("SELECT id, value FROM %s", t.name))
+		case strings.HasPrefix(p, t.prefix):
+			rows, err = m.stmts.Query(fmt.Sprintf("SELECT id, value FROM %s WHERE id like ?", t.name),
+				strings.TrimPrefix(p, t.prefix)+"%")
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = scanSQLRows(rows, t.prefix, res)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// scanSQLRows add the rows to the map with the prefix key
+func scanSQLRows(rows *sql.Rows, prefix string, res map[interface{}]interface{}) error {
+	for rows.Next() {
+		var s generalSchema
+		if err := rows.Scan(&s.id, &s.value); err != nil {
+			return err
+		}
+		res[prefix+s.id] = s.value
+	}
+	return rows.Err()
+}
+
+// MySQL index, served by the columns or stored in the pubsub_unique_index and pubsub_sorted_index tables.
+// the writes of the column index are no-op, the columns are written with the entry.
+
+func mysqlExecSetUniqueIndex(e execer, index, field, key string) error {
+	if _, ok := mysqlUniqueColumnIndexes[index]; ok {
+		return nil
+	}
+	_, err := e.Exec(`INSERT INTO pubsub_unique_index (name, field, id) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE id=?`, index, field, key, key)
+	return err
+}
+
+func mysqlExecDeleteUniqueIndex(e execer, index, field string) error {
+	if _, ok := mysqlUniqueColumnIndexes[index]; ok {
+		return nil
+	}
+	_, err := e.Exec("DELETE FROM pubsub_unique_index WHERE name=? AND field=?", index, field)
+	return err
+}
+
+func mysqlExecAddSortedIndex(e execer, index, field, key string, score float64) error {
+	if _, ok := mysqlSortedColumnIndexes[index]; ok {
+		return nil
+	}
+	_, err := e.Exec(`INSERT INTO pubsub_sorted_index (name, field, id, score) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE score=?`, index, field, key, score, score)
+	return err
+}
+
+func mysqlExecRemoveSortedIndex(e execer, index, field, key string) error {
+	if _, ok := mysqlSortedColumnIndexes[index]; ok {
+		return nil
+	}
+	_, err := e.Exec("DELETE FROM pubsub_sorted_index WHERE name=? AND field=? AND id=?", index, field, key)
+	return err
+}
+
+// SetUniqueIndex save the key of the field
+func (m *MySQL) SetUniqueIndex(index, field, key string) error {
+	return mysqlExecSetUniqueIndex(m.stmts, index, field, key)
+}
+
+// GetUniqueIndex get the key of the field
+func (m *MySQL) GetUniqueIndex(index, field string) (string, error) {
+	query, args := "SELECT id FROM pubsub_unique_index WHERE name=? AND field=?", []interface{}{index, field}
+	if c, ok := mysqlUniqueColumnIndexes[index]; ok {
+		query, args = fmt.Sprintf("SELECT id FROM %s WHERE %s=?", c.table, c.column), []interface{}{field}
+	}
+
+	row, err := m.stmts.QueryRow(query, args...)
+	if err != nil {
+		return "", err
+	}
+	var key string
+	if err := row.Scan(&key); err != nil {
+		return "", errors.Wrapf(ErrNotFoundEntry, fmt.Sprintf("detail %v", err))
+	}
+	return key, nil
+}
+
+// DeleteUniqueIndex delete the key of the field
+func (m *MySQL) DeleteUniqueIndex(index, field string) error {
+	return mysqlExecDeleteUniqueIndex(m.stmts, index, field)
+}
+
+// AddSortedIndex add the key to the field with score
+func (m *MySQL) AddSortedIndex(index, field, key string, score float64) error {
+	return mysqlExecAddSortedIndex(m.stmts, index, field, key, score)
+}
+
+// RemoveSortedIndex remove the key from the field
+func (m *MySQL) RemoveSortedIndex(index, field, key string) error {
+	return mysqlExecRemoveSortedIndex(m.stmts, index, field, key)
+}
+
+// RangeSortedIndex return the keys of the field ordered by score
+func (m *MySQL) RangeSortedIndex(index, field string) ([]string, error) {
+	query, args := "SELECT id FROM pubsub_sorted_index WHERE name=? AND field=? ORDER BY score, id", []interface{}{index, field}
+	if c, ok := mysqlSortedColumnIndexes[index]; ok {
+		query, args = fmt.Sprintf("SELECT id FROM %s WHERE %s=? ORDER BY %s, id", c.table, c.column, c.order), []interface{}{field}
+	}
+
+	rows, err := m.stmts.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		res = append(res, key)
+	}
+	return res, rows.Err()
+}
+
+// mysqlBatch apply operations in the sql.Tx
+type mysqlBatch struct {
+	batchOps
+	m *MySQL
+}
+
+// Batch return Batch for the MySQL
+func (m *MySQL) Batch() Batch {
+	return &mysqlBatch{m: m}
+}
+
+// Commit apply all operations in the transaction, rollback when any operation failed
+func (b *mysqlBatch) Commit() error {
+	if len(b.batchOps) == 0 {
+		return nil
+	}
+	tx, err := b.m.Conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	e := b.m.stmts.tx(tx)
+	for _, op := range b.batchOps {
+		switch op.kind {
+		case opSet:
+			err = mysqlExecSet(e, op.key, op.value)
+		case opDelete:
+			err = mysqlExecDelete(e, op.key)
+		case opSetUniqueIndex:
+			err = mysqlExecSetUniqueIndex(e, op.index, op.field, op.key.(string))
+		case opDeleteUniqueIndex:
+			err = mysqlExecDeleteUniqueIndex(e, op.index, op.field)
+		case opAddSortedIndex:
+			err = mysqlExecAddSortedIndex(e, op.index, op.field, op.key.(string), op.score)
+		case opRemoveSortedIndex:
+			err = mysqlExecRemoveSortedIndex(e, op.index, op.field, op.key.(string))
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
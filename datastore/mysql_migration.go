@@ -0,0 +1,136 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// mysqlMigrations are the schema changes, the version is the index + 1.
+// applied in order at the connect, append the new version and never modify the applied version.
+var mysqlMigrations = [][]string{
+	// 1: key-value table and the index tables
+	{
+		"CREATE TABLE IF NOT EXISTS `pubsub` (" +
+			"`id` varchar(255) NOT NULL," +
+			"`value` blob NOT NULL," +
+			"PRIMARY KEY (`id`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		"CREATE TABLE IF NOT EXISTS `pubsub_unique_index` (" +
+			"`name` varchar(64) NOT NULL," +
+			"`field` varchar(255) NOT NULL," +
+			"`id` varchar(255) NOT NULL," +
+			"PRIMARY KEY (`name`, `field`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		"CREATE TABLE IF NOT EXISTS `pubsub_sorted_index` (" +
+			"`name` varchar(64) NOT NULL," +
+			"`field` varchar(255) NOT NULL," +
+			"`id` varchar(255) NOT NULL," +
+			"`score` double NOT NULL," +
+			"PRIMARY KEY (`name`, `field`, `id`)," +
+			"KEY `idx_score` (`name`, `field`, `score`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+	},
+	// 2: tables of each entity, move the entries of the key-value table to the tables without the key prefix.
+	// the columns of the moved entries are filled by the models at the first start
+	{
+		"CREATE TABLE IF NOT EXISTS `topics` (" +
+			"`id` varchar(255) NOT NULL," +
+			"`value` blob NOT NULL," +
+			"PRIMARY KEY (`id`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		"CREATE TABLE IF NOT EXISTS `subscriptions` (" +
+			"`id` varchar(255) NOT NULL," +
+			"`topic_id` varchar(255) DEFAULT NULL," +
+			"`value` blob NOT NULL," +
+			"PRIMARY KEY (`id`)," +
+			"KEY `idx_topic_id` (`topic_id`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		"CREATE TABLE IF NOT EXISTS `messages` (" +
+			"`id` varchar(255) NOT NULL," +
+			"`value` mediumblob NOT NULL," +
+			"PRIMARY KEY (`id`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		"CREATE TABLE IF NOT EXISTS `message_statuses` (" +
+			"`id` varchar(255) NOT NULL," +
+			"`subscription_id` varchar(255) DEFAULT NULL," +
+			"`message_id` varchar(255) DEFAULT NULL," +
+			"`ack_id` varchar(255) DEFAULT NULL," +
+			"`state` int DEFAULT NULL," +
+			"`delivered_at` datetime(6) DEFAULT NULL," +
+			"`published_at` datetime(6) DEFAULT NULL," +
+			"`publish_order` bigint DEFAULT NULL," +
+			"`value` blob NOT NULL," +
+			"PRIMARY KEY (`id`)," +
+			"KEY `idx_subscription_publish_order` (`subscription_id`, `publish_order`)," +
+			"KEY `idx_ack_id` (`ack_id`)," +
+			"KEY `idx_state_delivered_at` (`state`, `delivered_at`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		"CREATE TABLE IF NOT EXISTS `snapshots` (" +
+			"`id` varchar(255) NOT NULL," +
+			"`value` mediumblob NOT NULL," +
+			"PRIMARY KEY (`id`)" +
+			") ENGINE=InnoDB DEFAULT CHARSET=utf8",
+		"INSERT IGNORE INTO `message_statuses` (`id`, `value`) " +
+			"SELECT SUBSTRING(`id`, 16), `value` FROM `pubsub` WHERE LEFT(`id`, 15) = 'message_status_'",
+		"INSERT IGNORE INTO `messages` (`id`, `value`) " +
+			"SELECT SUBSTRING(`id`, 9), `value` FROM `pubsub` WHERE LEFT(`id`, 8) = 'message_' AND LEFT(`id`, 15) <> 'message_status_'",
+		"INSERT IGNORE INTO `subscriptions` (`id`, `value`) " +
+			"SELECT SUBSTRING(`id`, 14), `value` FROM `pubsub` WHERE LEFT(`id`, 13) = 'subscription_'",
+		"INSERT IGNORE INTO `snapshots` (`id`, `value`) " +
+			"SELECT SUBSTRING(`id`, 10), `value` FROM `pubsub` WHERE LEFT(`id`, 9) = 'snapshot_'",
+		"INSERT IGNORE INTO `topics` (`id`, `value`) " +
+			"SELECT SUBSTRING(`id`, 7), `value` FROM `pubsub` WHERE LEFT(`id`, 6) = 'topic_'",
+		// the moved entries are no longer read from the key-value table
+		"DELETE FROM `pubsub` WHERE LEFT(`id`, 8) = 'message_' OR LEFT(`id`, 13) = 'subscription_' " +
+			"OR LEFT(`id`, 9) = 'snapshot_' OR LEFT(`id`, 6) = 'topic_'",
+	},
+}
+
+// mysqlMigrationLock is the name of the lock, not to migrate at the same time by the other servers
+const mysqlMigrationLock = "pubsub_migration"
+
+// migrateMySQL apply the migrations newer than the version recorded in the schema_migrations
+func migrateMySQL(db *sql.DB) error {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 30)", mysqlMigrationLock).Scan(&locked); err != nil {
+		return errors.Wrap(err, "failed to get migration lock")
+	}
+	if locked.Int64 != 1 {
+		return errors.New("timeout to get migration lock")
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", mysqlMigrationLock)
+
+	_, err = conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS `schema_migrations` ("+
+		"`version` int NOT NULL,"+
+		"`applied_at` datetime NOT NULL,"+
+		"PRIMARY KEY (`version`)"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8")
+	if err != nil {
+		return err
+	}
+	var current int
+	if err := conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for v := current + 1; v <= len(mysqlMigrations); v++ {
+		for _, stmt := range mysqlMigrations[v-1] {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return errors.Wrapf(err, "failed to migrate version %d", v)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, NOW())", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
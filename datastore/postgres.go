@@ -0,0 +1,406 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq" // postgres driver
+	"github.com/pkg/errors"
+)
+
+// Postgres is PostgreSQL datastore driver, the entries are stored in the table of each key prefix
+type Postgres struct {
+	Conn *sql.DB
+}
+
+// postgresTables are the tables of each entity, the longer prefix is first
+var postgresTables = []sqlTable{
+	{
+		name:    "message_statuses",
+		prefix:  "message_status_",
+		columns: []string{"subscription_id", "message_id", "ack_id", "state", "delivered_at", "published_at", "visible_at", "publish_order"},
+	},
+	{name: "messages", prefix: "message_"},
+	{
+		name:    "subscriptions",
+		prefix:  "subscription_",
+		columns: []string{"topic_id"},
+	},
+	{name: "snapshots", prefix: "snapshot_"},
+	{name: "topics", prefix: "topic_"},
+}
+
+// postgresGeneralTable store the entries not matched any prefix
+var postgresGeneralTable = sqlTable{name: "pubsub"}
+
+// the Index of the models served by the columns
+var (
+	postgresUniqueColumnIndexes = map[string]sqlColumnIndex{
+		"message_status_ack_id": {table: "message_statuses", column: "ack_id"},
+	}
+	postgresSortedColumnIndexes = map[string]sqlColumnIndex{
+		"message_status_subscription": {
+			table:   "message_statuses",
+			column:  "subscription_id",
+			order:   "publish_order",
+			visible: "visible_at",
+		},
+	}
+)
+
+// lookupPostgresTable return the table and the id of the key
+func lookupPostgresTable(key interface{}) (sqlTable, string) {
+	return lookupSQLTable(postgresTables, postgresGeneralTable, key)
+}
+
+// NewPostgres return PostgreSQL client, and migrate the schema to the latest
+func NewPostgres(cfg *Config) (*Postgres, error) {
+	db, err := sql.Open("postgres", postgresDSN(cfg.Postgres))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect postgres")
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	if err := migratePostgres(db); err != nil {
+		return nil, errors.Wrap(err, "failed to migrate postgres schema")
+	}
+
+	return &Postgres{
+		Conn: db,
+	}, nil
+}
+
+// postgresDSN return the connection url of the config
+func postgresDSN(c *PostgresConfig) string {
+	database := c.Database
+	if database == "" {
+		database = "pubsub"
+	}
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     c.Addr,
+		Path:     database,
+		RawQuery: url.Values{"sslmode": []string{sslMode}}.Encode(),
+	}
+	return u.String()
+}
+
+// postgresPlaceholders return "$from, $from+1, ..." of the n parameters
+func postgresPlaceholders(from, n int) string {
+	ps := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ps = append(ps, fmt.Sprintf("$%d", from+i))
+	}
+	return strings.Join(ps, ", ")
+}
+
+// postgresExecSet insert or update the entry and the columns
+func postgresExecSet(e execer, key, value interface{}) error {
+	t, id := lookupPostgresTable(key)
+	var cols map[string]interface{}
+	if r, ok := value.(*Row); ok {
+		cols = r.Columns
+	}
+
+	names := append([]string{"id", "value"}, t.columns...)
+	args := []interface{}{id, rowValue(value)}
+	updates := []string{"value=EXCLUDED.value"}
+	for _, c := range t.columns {
+		args = append(args, cols[c])
+		updates = append(updates, fmt.Sprintf("%s=EXCLUDED.%s", c, c))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (id) DO UPDATE SET %s",
+		t.name, strings.Join(names, ", "), postgresPlaceholders(1, len(names)), strings.Join(updates, ", "))
+	_, err := e.Exec(query, args...)
+	return err
+}
+
+func postgresExecDelete(e execer, key interface{}) error {
+	t, id := lookupPostgresTable(key)
+	_, err := e.Exec(fmt.Sprintf("DELETE FROM %s WHERE id=$1", t.name), id)
+	return err
+}
+
+// Set save item
+func (p *Postgres) Set(key, value interface{}) error {
+	return postgresExecSet(p.Conn, key, value)
+}
+
+// Get get item
+func (p *Postgres) Get(key interface{}) (interface{}, error) {
+	t, id := lookupPostgresTable(key)
+
+	var s generalSchema
+	err := p.Conn.QueryRow(fmt.Sprintf("SELECT value FROM %s WHERE id=$1", t.name), id).Scan(&s.value)
+	if err != nil {
+		return nil, errors.Wrapf(ErrNotFoundEntry, fmt.Sprintf("detail %v", err))
+	}
+	return s.value, nil
+}
+
+// Delete delete item
+func (p *Postgres) Delete(key interface{}) error {
+	return postgresExecDelete(p.Conn, key)
+}
+
+// Close close the connections
+func (p *Postgres) Close() error {
+	return p.Conn.Close()
+}
+
+// Dump return stored items
+func (p *Postgres) Dump() (map[interface{}]interface{}, error) {
+	return p.DumpPrefix("")
+}
+
+// DumpPrefix return stored items when match prefix key, read only the tables possibly match
+func (p *Postgres) DumpPrefix(prefix string) (map[interface{}]interface{}, error) {
+	res := make(map[interface{}]interface{}, 0)
+	for _, t := range append(postgresTables, postgresGeneralTable) {
+		var (
+			rows *sql.Rows
+			err  error
+		)
+		switch {
+		case strings.HasPrefix(t.prefix, prefix):
+			rows, err = p.Conn.Query(fmt.Sprintf("SELECT id, value FROM %s", t.name))
+		case strings.HasPrefix(prefix, t.prefix):
+			rows, err = p.Conn.Query(fmt.Sprintf("SELECT id, value FROM %s WHERE id LIKE $1", t.name),
+				strings.TrimPrefix(prefix, t.prefix)+"%")
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = scanSQLRows(rows, t.prefix, res)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Postgres index, served by the columns or stored in the pubsub_unique_index and pubsub_sorted_index tables.
+// the writes of the column index are no-op, the columns are written with the entry.
+
+func postgresExecSetUniqueIndex(e execer, index, field, key string) error {
+	if _, ok := postgresUniqueColumnIndexes[index]; ok {
+		return nil
+	}
+	_, err := e.Exec(`INSERT INTO pubsub_unique_index (name, field, id) VALUES ($1, $2, $3)
+		ON CONFLICT (name, field) DO UPDATE SET id=EXCLUDED.id`, index, field, key)
+	return err
+}
+
+func postgresExecDeleteUniqueIndex(e execer, index, field string) error {
+	if _, ok := postgresUniqueColumnIndexes[index]; ok {
+		return nil
+	}
+	_, err := e.Exec("DELETE FROM pubsub_unique_index WHERE name=$1 AND field=$2", index, field)
+	return err
+}
+
+func postgresExecAddSortedIndex(e execer, index, field, key string, score float64) error {
+	if _, ok := postgresSortedColumnIndexes[index]; ok {
+		return nil
+	}
+	_, err := e.Exec(`INSERT INTO pubsub_sorted_index (name, field, id, score) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name, field, id) DO UPDATE SET score=EXCLUDED.score`, index, field, key, score)
+	return err
+}
+
+func postgresExecRemoveSortedIndex(e execer, index, field, key string) error {
+	if _, ok := postgresSortedColumnIndexes[index]; ok {
+		return nil
+	}
+	_, err := e.Exec("DELETE FROM pubsub_sorted_index WHERE name=$1 AND field=$2 AND id=$3", index, field, key)
+	return err
+}
+
+// SetUniqueIndex save the key of the field
+func (p *Postgres) SetUniqueIndex(index, field, key string) error {
+	return postgresExecSetUniqueIndex(p.Conn, index, field, key)
+}
+
+// GetUniqueIndex get the key of the field
+func (p *Postgres) GetUniqueIndex(index, field string) (string, error) {
+	query, args := "SELECT id FROM pubsub_unique_index WHERE name=$1 AND field=$2", []interface{}{index, field}
+	if c, ok := postgresUniqueColumnIndexes[index]; ok {
+		query, args = fmt.Sprintf("SELECT id FROM %s WHERE %s=$1", c.table, c.column), []interface{}{field}
+	}
+
+	var key string
+	if err := p.Conn.QueryRow(query, args...).Scan(&key); err != nil {
+		return "", errors.Wrapf(ErrNotFoundEntry, fmt.Sprintf("detail %v", err))
+	}
+	return key, nil
+}
+
+// DeleteUniqueIndex delete the key of the field
+func (p *Postgres) DeleteUniqueIndex(index, field string) error {
+	return postgresExecDeleteUniqueIndex(p.Conn, index, field)
+}
+
+// AddSortedIndex add the key to the field with score
+func (p *Postgres) AddSortedIndex(index, field, key string, score float64) error {
+	return postgresExecAddSortedIndex(p.Conn, index, field, key, score)
+}
+
+// RemoveSortedIndex remove the key from the field
+func (p *Postgres) RemoveSortedIndex(index, field, key string) error {
+	return postgresExecRemoveSortedIndex(p.Conn, index, field, key)
+}
+
+// RangeSortedIndex return the keys of the field ordered by score
+func (p *Postgres) RangeSortedIndex(index, field string) ([]string, error) {
+	query, args := "SELECT id FROM pubsub_sorted_index WHERE name=$1 AND field=$2 ORDER BY score, id", []interface{}{index, field}
+	if c, ok := postgresSortedColumnIndexes[index]; ok {
+		query, args = fmt.Sprintf("SELECT id FROM %s WHERE %s=$1 ORDER BY %s, id", c.table, c.column, c.order), []interface{}{field}
+	}
+
+	rows, err := p.Conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		res = append(res, key)
+	}
+	return res, rows.Err()
+}
+
+// LockSortedIndex lock the visible entries by SELECT ... FOR UPDATE SKIP LOCKED,
+// the other server processes skip the locked entries until the transaction is committed.
+// only the sorted index served by the columns is supported.
+func (p *Postgres) LockSortedIndex(index, field string, limit int, now time.Time, fn func(values [][]byte, b Batch) error) error {
+	c, ok := postgresSortedColumnIndexes[index]
+	if !ok || c.visible == "" {
+		return errors.Errorf("not supported lock of the index %s", index)
+	}
+
+	tx, err := p.Conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	query := fmt.Sprintf("SELECT value FROM %s WHERE %s=$1 AND %s <= $2 ORDER BY %s, id LIMIT $3 FOR UPDATE SKIP LOCKED",
+		c.table, c.column, c.visible, c.order)
+	rows, err := tx.Query(query, field, now, limit)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	values := make([][]byte, 0, limit)
+	for rows.Next() {
+		var v []byte
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		values = append(values, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	b := &postgresBatch{p: p}
+	if err := fn(values, b); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := b.apply(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Lock hold the advisory lock of the name by pg_advisory_xact_lock while running fn,
+// the lock is released with the transaction.
+func (p *Postgres) Lock(name string, fn func() error) error {
+	tx, err := p.Conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", name); err != nil {
+		tx.Rollback()
+		return errors.Wrapf(err, "failed to lock %s", name)
+	}
+	if err := fn(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// postgresBatch apply operations in the sql.Tx
+type postgresBatch struct {
+	batchOps
+	p *Postgres
+}
+
+// Batch return Batch for the Postgres
+func (p *Postgres) Batch() Batch {
+	return &postgresBatch{p: p}
+}
+
+// Commit apply all operations in the transaction, rollback when any operation failed
+func (b *postgresBatch) Commit() error {
+	if len(b.batchOps) == 0 {
+		return nil
+	}
+	tx, err := b.p.Conn.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if err := b.apply(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// apply execute all operations in the transaction
+func (b *postgresBatch) apply(tx *sql.Tx) error {
+	for _, op := range b.batchOps {
+		var err error
+		switch op.kind {
+		case opSet:
+			err = postgresExecSet(tx, op.key, op.value)
+		case opDelete:
+			err = postgresExecDelete(tx, op.key)
+		case opSetUniqueIndex:
+			err = postgresExecSetUniqueIndex(tx, op.index, op.field, op.key.(string))
+		case opDeleteUniqueIndex:
+			err = postgresExecDeleteUniqueIndex(tx, op.index, op.field)
+		case opAddSortedIndex:
+			err = postgresExecAddSortedIndex(tx, op.index, op.field, op.key.(string), op.score)
+		case opRemoveSortedIndex:
+			err = postgresExecRemoveSortedIndex(tx, op.index, op.field, op.key.(string))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package datastore
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// postgresMigrations are the schema changes, the version is the index + 1.
+// applied in order at the connect, append the new version and never modify the applied version.
+var postgresMigrations = [][]string{
+	// 1: tables of each entity, the key-value table and the index tables
+	{
+		`CREATE TABLE IF NOT EXISTS pubsub (
+			id varchar(255) PRIMARY KEY,
+			value bytea NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS pubsub_unique_index (
+			name varchar(64) NOT NULL,
+			field varchar(255) NOT NULL,
+			id varchar(255) NOT NULL,
+			PRIMARY KEY (name, field)
+		)`,
+		`CREATE TABLE IF NOT EXISTS pubsub_sorted_index (
+			name varchar(64) NOT NULL,
+			field varchar(255) NOT NULL,
+			id varchar(255) NOT NULL,
+			score double precision NOT NULL,
+			PRIMARY KEY (name, field, id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_pubsub_sorted_index_score ON pubsub_sorted_index (name, field, score)`,
+		`CREATE TABLE IF NOT EXISTS topics (
+			id varchar(255) PRIMARY KEY,
+			value bytea NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS subscriptions (
+			id varchar(255) PRIMARY KEY,
+			topic_id varchar(255),
+			value bytea NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_subscriptions_topic_id ON subscriptions (topic_id)`,
+		`CREATE TABLE IF NOT EXISTS messages (
+			id varchar(255) PRIMARY KEY,
+			value bytea NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS message_statuses (
+			id varchar(255) PRIMARY KEY,
+			subscription_id varchar(255),
+			message_id varchar(255),
+			ack_id varchar(255),
+			state integer,
+			delivered_at timestamptz,
+			published_at timestamptz,
+			publish_order bigint,
+			visible_at timestamptz,
+			value bytea NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_statuses_subscription_publish_order ON message_statuses (subscription_id, publish_order)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_statuses_ack_id ON message_statuses (ack_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_message_statuses_subscription_visible_at ON message_statuses (subscription_id, visible_at)`,
+		`CREATE TABLE IF NOT EXISTS snapshots (
+			id varchar(255) PRIMARY KEY,
+			value bytea NOT NULL
+		)`,
+	},
+}
+
+// postgresMigrationLock is the key of the advisory lock, not to migrate at the same time by the other servers
+const postgresMigrationLock = 7283401
+
+// migratePostgres apply the migrations newer than the version recorded in the schema_migrations in a transaction
+func migratePostgres(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+	if err := applyPostgresMigrations(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func applyPostgresMigrations(tx *sql.Tx) error {
+	// released at the end of the transaction
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+		return errors.Wrap(err, "failed to get migration lock")
+	}
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		applied_at timestamptz NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	var current int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for v := current + 1; v <= len(postgresMigrations); v++ {
+		for _, stmt := range postgresMigrations[v-1] {
+			if _, err := tx.Exec(stmt); err != nil {
+				return errors.Wrapf(err, "failed to migrate version %d", v)
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES ($1, now())", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
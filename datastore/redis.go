@@ -0,0 +1,266 @@
+package datastore
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// default params of the Redis connection pool
+const (
+	defaultRedisAddr        = "localhost:6379"
+	defaultRedisPort        = 6379
+	defaultRedisMaxIdle     = 3
+	defaultRedisMaxActive   = 10
+	defaultRedisIdleTimeout = 240 * time.Second
+)
+
+// Redis is datastore driver for redis
+type Redis struct {
+	Pool *redis.Pool
+
+	// keyPrefix is prepended to all keys, the hash tag on the Redis Cluster
+	keyPrefix string
+}
+
+// NewRedis return redis client
+func NewRedis(cfg *Config) (*Redis, error) {
+	c := cfg.Redis
+	pool, err := newRedisPool(c)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pool.Dial()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect redis")
+	}
+	conn.Close()
+
+	r := &Redis{
+		Pool: pool,
+	}
+	if c.SingleSlotCluster != nil {
+		r.keyPrefix = "{" + c.SingleSlotCluster.hashTag() + "}"
+	}
+	return r, nil
+}
+
+// Close close the connection pool
+func (r *Redis) Close() error {
+	return r.Pool.Close()
+}
+
+// addr return the address of the Redis
+func (c *RedisConfig) addr() string {
+	if c.Addr != "" {
+		return c.Addr
+	}
+	if c.Host == "" {
+		return defaultRedisAddr
+	}
+	port := c.Port
+	if port == 0 {
+		port = defaultRedisPort
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// dialOptions return the options to connect the Redis server
+func (c *RedisConfig) dialOptions() ([]redis.DialOption, error) {
+	opts := []redis.DialOption{
+		redis.DialPassword(c.Password),
+		redis.DialDatabase(c.DB),
+		redis.DialConnectTimeout(c.DialTimeout),
+		redis.DialReadTimeout(c.ReadTimeout),
+		redis.DialWriteTimeout(c.WriteTimeout),
+	}
+	if c.TLS != nil {
+		t, err := c.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, redis.DialUseTLS(true), redis.DialTLSConfig(t))
+	}
+	return opts, nil
+}
+
+// newRedisPool return redis connection pool, the connection is dialed by the Sentinel or the Cluster when configured
+func newRedisPool(c *RedisConfig) (*redis.Pool, error) {
+	opts, err := c.dialOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	var dial func() (redis.Conn, error)
+	switch {
+	case c.Sentinel != nil && c.SingleSlotCluster != nil:
+		return nil, errors.New("sentinel and single_slot_cluster are exclusive")
+	case c.Sentinel != nil:
+		if c.Sentinel.MasterName == "" || len(c.Sentinel.Addrs) == 0 {
+			return nil, errors.New("require sentinel master_name and addrs")
+		}
+		dial = newRedisSentinel(c, opts).dial
+	case c.SingleSlotCluster != nil:
+		if len(c.SingleSlotCluster.Addrs) == 0 {
+			return nil, errors.New("require single_slot_cluster addrs")
+		}
+		if c.DB != 0 {
+			return nil, errors.New("single_slot_cluster support only db 0")
+		}
+		dial = newRedisCluster(c, opts).dial
+	default:
+		addr := c.addr()
+		dial = func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, opts...)
+		}
+	}
+
+	pool := &redis.Pool{
+		MaxIdle:     c.MaxIdle,
+		MaxActive:   c.MaxActive,
+		Wait:        true,
+		IdleTimeout: c.IdleTimeout,
+		Dial:        dial,
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+	if pool.MaxIdle == 0 {
+		pool.MaxIdle = defaultRedisMaxIdle
+	}
+	if pool.MaxActive == 0 {
+		pool.MaxActive = defaultRedisMaxActive
+	}
+	if pool.IdleTimeout == 0 {
+		pool.IdleTimeout = defaultRedisIdleTimeout
+	}
+	return pool, nil
+}
+
+// key return the key prepended the keyPrefix
+func (r *Redis) key(key interface{}) string {
+	return r.keyPrefix + fmt.Sprint(key)
+}
+
+// Set save item
+func (r *Redis) Set(key, value interface{}) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", r.key(key), rowValue(value))
+	return err
+}
+
+// Get get item
+func (r *Redis) Get(key interface{}) (interface{}, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	v, err := redis.Bytes(conn.Do("GET", r.key(key)))
+	if err != nil {
+		return nil, errors.Wrapf(ErrNotFoundEntry, fmt.Sprintf("detail %v", err))
+	}
+	return v, nil
+}
+
+// Delete delete item
+func (r *Redis) Delete(key interface{}) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", r.key(key))
+	return err
+}
+
+// Dump return stored items
+func (r *Redis) Dump() (map[interface{}]interface{}, error) {
+	return r.DumpPrefix("")
+}
+
+// redisScanCount is the COUNT hint of the SCAN
+const redisScanCount = 1000
+
+// DumpPrefix return stored items when match prefix key
+func (r *Redis) DumpPrefix(p string) (map[interface{}]interface{}, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	// get keys by SCAN, not to block the Redis by KEYS on large keyspaces
+	keys := make([]string, 0)
+	cursor := 0
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", r.key(p)+"*", "COUNT", redisScanCount))
+		if err != nil {
+			return nil, err
+		}
+		var part []string
+		if _, err := redis.Scan(reply, &cursor, &part); err != nil {
+			return nil, err
+		}
+		keys = append(keys, part...)
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(keys) == 0 {
+		return make(map[interface{}]interface{}), nil
+	}
+
+	args := make([]interface{}, 0)
+	for _, k := range keys {
+		args = append(args, k)
+	}
+
+	// get values
+	values, err := redis.ByteSlices(conn.Do("MGET", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	// key-valus to map, the keys of the other types are skipped
+	res := make(map[interface{}]interface{}, len(keys))
+	for i, k := range keys {
+		if values[i] == nil {
+			continue
+		}
+		res[strings.TrimPrefix(k, r.keyPrefix)] = values[i]
+	}
+	return res, nil
+}
+
+// redisFailoverConn is the connection closed when the server is no longer the master,
+// the closed connection is discarded by the pool and the next connection is dialed to the new master
+type redisFailoverConn struct {
+	redis.Conn
+
+	// failover is called with the error when the server is no longer the master
+	failover func(err redis.Error)
+}
+
+// isRedisFailoverError return whether the error means the server is no longer the master
+func isRedisFailoverError(err redis.Error) bool {
+	for _, p := range []string{"MOVED ", "READONLY ", "CLUSTERDOWN ", "EXECABORT "} {
+		if strings.HasPrefix(err.Error(), p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Do call Do of the connection, and close the connection at the failover
+func (c *redisFailoverConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(cmd, args...)
+	if e, ok := err.(redis.Error); ok && isRedisFailoverError(e) {
+		if c.failover != nil {
+			c.failover(e)
+		}
+		c.Conn.Close()
+	}
+	return reply, err
+}
@@ -0,0 +1,173 @@
+package datastore
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// redisClusterSlots is number of the hash slots of the Redis Cluster
+const redisClusterSlots = 16384
+
+// defaultRedisHashTag is the hash tag of the keys on the Redis Cluster
+const defaultRedisHashTag = "pubsub"
+
+// hashTag return the hash tag of the keys
+func (c *RedisSingleSlotClusterConfig) hashTag() string {
+	if c.HashTag == "" {
+		return defaultRedisHashTag
+	}
+	return c.HashTag
+}
+
+// redisSlot return the hash slot of the key, only the hash tag is hashed when the key has "{tag}"
+func redisSlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key)) % redisClusterSlots
+}
+
+// crc16 return the CRC16-CCITT (XMODEM) used by the Redis Cluster
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// redisCluster dial the master node serving the slot of the hash tag,
+// all keys have the hash tag to use the transaction and the multi keys commands.
+// the capacity of a server is limited to the single master, the other masters are used only by the other hash tags
+type redisCluster struct {
+	seeds []string
+	slot  int
+	opts  []redis.DialOption
+
+	mu sync.Mutex
+	// addr is the master of the slot, empty when discover at the next dial
+	addr string
+}
+
+func newRedisCluster(c *RedisConfig, opts []redis.DialOption) *redisCluster {
+	return &redisCluster{
+		seeds: c.SingleSlotCluster.Addrs,
+		slot:  redisSlot("{" + c.SingleSlotCluster.hashTag() + "}"),
+		opts:  opts,
+	}
+}
+
+func (c *redisCluster) getAddr() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addr
+}
+
+func (c *redisCluster) setAddr(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addr = addr
+}
+
+// masterAddr return the master of the slot, discovered by CLUSTER SLOTS of the seed nodes when unknown
+func (c *redisCluster) masterAddr() (string, error) {
+	if addr := c.getAddr(); addr != "" {
+		return addr, nil
+	}
+	var lastErr error
+	for _, seed := range c.seeds {
+		conn, err := redis.Dial("tcp", seed, c.opts...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reply, err := conn.Do("CLUSTER", "SLOTS")
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		addr, err := parseRedisClusterSlots(reply, c.slot, seed)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		c.setAddr(addr)
+		return addr, nil
+	}
+	if lastErr == nil {
+		lastErr = ErrNotFoundEntry
+	}
+	return "", errors.Wrapf(lastErr, "failed to discover the node of the slot %d", c.slot)
+}
+
+// parseRedisClusterSlots return the master address of the slot from the CLUSTER SLOTS reply,
+// the reply is [[start, end, [host, port, id], replicas...], ...] and the empty host is the queried seed
+func parseRedisClusterSlots(reply interface{}, slot int, seed string) (string, error) {
+	ranges, err := redis.Values(reply, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, r := range ranges {
+		v, err := redis.Values(r, nil)
+		if err != nil || len(v) < 3 {
+			return "", errors.Errorf("unexpected CLUSTER SLOTS reply %v", r)
+		}
+		start, _ := redis.Int(v[0], nil)
+		end, _ := redis.Int(v[1], nil)
+		if slot < start || end < slot {
+			continue
+		}
+		node, err := redis.Values(v[2], nil)
+		if err != nil || len(node) < 2 {
+			return "", errors.Errorf("unexpected CLUSTER SLOTS node %v", v[2])
+		}
+		host, _ := redis.String(node[0], nil)
+		port, _ := redis.Int(node[1], nil)
+		if host == "" {
+			host, _, _ = net.SplitHostPort(seed)
+		}
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+	return "", errors.Wrapf(ErrNotFoundEntry, "slot %d is not served", slot)
+}
+
+// dial connect to the master of the slot
+func (c *redisCluster) dial() (redis.Conn, error) {
+	addr, err := c.masterAddr()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := redis.Dial("tcp", addr, c.opts...)
+	if err != nil {
+		c.setAddr("")
+		return nil, err
+	}
+	return &redisFailoverConn{Conn: conn, failover: c.failover}, nil
+}
+
+// failover update the master by the MOVED error "MOVED <slot> <host:port>", otherwise discover at the next dial
+func (c *redisCluster) failover(err redis.Error) {
+	f := strings.Fields(err.Error())
+	if len(f) == 3 && f[0] == "MOVED" {
+		if host, _, e := net.SplitHostPort(f[2]); e == nil && host != "" && host != "?" {
+			c.setAddr(f[2])
+			return
+		}
+	}
+	c.setAddr("")
+}
@@ -0,0 +1,80 @@
+package datastore
+
+import (
+	"net"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// redisSentinel dial the master discovered by the Sentinels
+type redisSentinel struct {
+	cfg *RedisSentinelConfig
+	// opts is the options to connect the master
+	opts []redis.DialOption
+	// sentinelOpts is the options to connect the Sentinels
+	sentinelOpts []redis.DialOption
+}
+
+func newRedisSentinel(c *RedisConfig, opts []redis.DialOption) *redisSentinel {
+	return &redisSentinel{
+		cfg:  c.Sentinel,
+		opts: opts,
+		// the Sentinels have the own password and no database
+		sentinelOpts: append(append([]redis.DialOption{}, opts...),
+			redis.DialPassword(c.Sentinel.Password), redis.DialDatabase(0)),
+	}
+}
+
+// masterAddr ask the master address to the Sentinels in order, and return the first answer
+func (s *redisSentinel) masterAddr() (string, error) {
+	var lastErr error
+	for _, addr := range s.cfg.Addrs {
+		conn, err := redis.Dial("tcp", addr, s.sentinelOpts...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		res, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", s.cfg.MasterName))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(res) != 2 {
+			lastErr = errors.Errorf("unexpected master address %v", res)
+			continue
+		}
+		return net.JoinHostPort(res[0], res[1]), nil
+	}
+	if lastErr == nil {
+		lastErr = ErrNotFoundEntry
+	}
+	return "", errors.Wrapf(lastErr, "failed to discover master, name=%s", s.cfg.MasterName)
+}
+
+// dial connect to the current master, and check the role not to connect the demoted master during the failover
+func (s *redisSentinel) dial() (redis.Conn, error) {
+	addr, err := s.masterAddr()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := redis.Dial("tcp", addr, s.opts...)
+	if err != nil {
+		return nil, err
+	}
+	role, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "failed to get role, addr=%s", addr)
+	}
+	if len(role) == 0 {
+		conn.Close()
+		return nil, errors.Errorf("unexpected role reply, addr=%s", addr)
+	}
+	if r, _ := redis.String(role[0], nil); r != "master" {
+		conn.Close()
+		return nil, errors.Errorf("not master, addr=%s, role=%s", addr, r)
+	}
+	return &redisFailoverConn{Conn: conn}, nil
+}
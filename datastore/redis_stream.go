@@ -0,0 +1,395 @@
+package datastore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// RedisStreamMode is the mode of the RedisConfig, the messages are delivered by the Redis Streams
+const RedisStreamMode = "stream"
+
+// redisStreamField is the field name of the entry value
+const redisStreamField = "value"
+
+// redisPendingPage is number of the pending entries inspected by a XPENDING
+const redisPendingPage = 100
+
+// streamDeadlineKey return the hash key of the deadlines set by the Extend, the field is the entry ID
+func streamDeadlineKey(stream, group string) string {
+	return fmt.Sprintf("%s:deadline:%s", stream, group)
+}
+
+// RedisStream is the Redis driver delivering the messages by the Redis Streams,
+// the key-value entries are stored same as the Redis
+type RedisStream struct {
+	*Redis
+}
+
+// NewRedisStream return RedisStream client
+func NewRedisStream(cfg *Config) (*RedisStream, error) {
+	r, err := NewRedis(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStream{Redis: r}, nil
+}
+
+// CreateGroup create the consumer group by XGROUP CREATE, do nothing when already exist
+func (r *RedisStream) CreateGroup(stream, group string) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("XGROUP", "CREATE", r.key(stream), group, "$", "MKSTREAM")
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+	return err
+}
+
+// DestroyGroup delete the consumer group by XGROUP DESTROY
+func (r *RedisStream) DestroyGroup(stream, group string) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("XGROUP", "DESTROY", r.key(stream), group); err != nil {
+		return err
+	}
+	_, err := conn.Do("DEL", r.key(streamDeadlineKey(stream, group)))
+	return err
+}
+
+// DeleteStream delete the stream key
+func (r *RedisStream) DeleteStream(stream string) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", r.key(stream))
+	return err
+}
+
+// Append append the value by XADD
+func (r *RedisStream) Append(stream string, value []byte) (string, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	return redis.String(conn.Do("XADD", r.key(stream), "*", redisStreamField, value))
+}
+
+// Read claim the idle pending entries by XPENDING IDLE and XCLAIM, and read the new entries by XREADGROUP
+func (r *RedisStream) Read(stream, group, consumer string, count int, minIdle time.Duration) ([]*StreamEntry, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	res, err := r.claimIdle(conn, stream, group, consumer, count, minIdle)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to claim pending entries")
+	}
+	if len(res) >= count {
+		return res, nil
+	}
+
+	reply, err := redis.Values(conn.Do("XREADGROUP", "GROUP", group, consumer,
+		"COUNT", count-len(res), "STREAMS", r.key(stream), ">"))
+	if err == redis.ErrNil {
+		return res, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read group")
+	}
+	// reply is [[stream, [[id, [field, value]], ...]]]
+	for _, s := range reply {
+		kv, err := redis.Values(s, nil)
+		if err != nil || len(kv) != 2 {
+			return nil, errors.Errorf("unexpected XREADGROUP reply %v", s)
+		}
+		entries, err := parseRedisStreamEntries(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			e.DeliveryCount = 1
+			res = append(res, e)
+		}
+	}
+	return res, nil
+}
+
+// claimIdle claim the pending entries idle longer than minIdle in the ID order,
+// the pending entries are inspected by the pages of XPENDING IDLE until count entries are claimed
+func (r *RedisStream) claimIdle(conn redis.Conn, stream, group, consumer string, count int, minIdle time.Duration) ([]*StreamEntry, error) {
+	key := r.key(stream)
+	now := unixMillis(time.Now())
+	args := redis.Args{}.Add(key, group, consumer, durationMillis(minIdle))
+	counts := make(map[string]int)
+	start := "-"
+	for len(counts) < count {
+		// reply is [[id, consumer, idle millis, delivery count], ...]
+		pending, err := redis.Values(conn.Do("XPENDING", key, group,
+			"IDLE", durationMillis(minIdle), start, "+", redisPendingPage))
+		if err != nil {
+			return nil, err
+		}
+		if len(pending) == 0 {
+			break
+		}
+		ids := make([]string, 0, len(pending))
+		delivered := make([]int, 0, len(pending))
+		for _, p := range pending {
+			v, err := redis.Values(p, nil)
+			if err != nil || len(v) != 4 {
+				return nil, errors.Errorf("unexpected XPENDING reply %v", p)
+			}
+			id, _ := redis.String(v[0], nil)
+			n, _ := redis.Int(v[3], nil)
+			ids = append(ids, id)
+			delivered = append(delivered, n)
+		}
+
+		// the entries extended by the Extend are not redelivered until the deadline
+		deadlines, err := redis.Values(conn.Do("HMGET", redis.Args{}.Add(r.key(streamDeadlineKey(stream, group))).AddFlat(ids)...))
+		if err != nil {
+			return nil, err
+		}
+		for i, id := range ids {
+			if len(counts) >= count {
+				break
+			}
+			if i < len(deadlines) && deadlines[i] != nil {
+				if d, err := redis.Int64(deadlines[i], nil); err == nil && now < d {
+					continue
+				}
+			}
+			args = args.Add(id)
+			counts[id] = delivered[i] + 1
+		}
+		if len(pending) < redisPendingPage {
+			break
+		}
+		start = "(" + ids[len(ids)-1]
+	}
+	if len(counts) == 0 {
+		return []*StreamEntry{}, nil
+	}
+
+	reply, err := conn.Do("XCLAIM", args...)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseRedisStreamEntries(reply)
+	if err != nil {
+		return nil, err
+	}
+	claimed := make([]string, 0, len(entries))
+	for _, e := range entries {
+		e.DeliveryCount = counts[e.ID]
+		claimed = append(claimed, e.ID)
+	}
+	if err := r.deleteDeadlines(conn, stream, group, claimed...); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// deleteDeadlines delete the deadlines of the entries set by the Extend
+func (r *RedisStream) deleteDeadlines(conn redis.Conn, stream, group string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := conn.Do("HDEL", redis.Args{}.Add(r.key(streamDeadlineKey(stream, group))).AddFlat(ids)...)
+	return err
+}
+
+// Ack ack the entries by XACK
+func (r *RedisStream) Ack(stream, group string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	if _, err := conn.Do("XACK", redis.Args{}.Add(r.key(stream), group).AddFlat(ids)...); err != nil {
+		return err
+	}
+	return r.deleteDeadlines(conn, stream, group, ids...)
+}
+
+// SetIdle set the idle time by XCLAIM with IDLE, not to increment the delivery count
+func (r *RedisStream) SetIdle(stream, group, consumer, id string, idle time.Duration) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	ids, err := redis.Strings(conn.Do("XCLAIM", r.key(stream), group, consumer, 0, id,
+		"IDLE", durationMillis(idle), "JUSTID"))
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return ErrNotFoundEntry
+	}
+	return r.deleteDeadlines(conn, stream, group, id)
+}
+
+// Extend reset the idle time by XCLAIM, and set the deadline to the hash skipped by the claim until it
+func (r *RedisStream) Extend(stream, group, consumer, id string, deadline time.Time) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	ids, err := redis.Strings(conn.Do("XCLAIM", r.key(stream), group, consumer, 0, id,
+		"IDLE", 0, "JUSTID"))
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return ErrNotFoundEntry
+	}
+	_, err = conn.Do("HSET", r.key(streamDeadlineKey(stream, group)), id,
+		unixMillis(deadline))
+	return err
+}
+
+// Trim delete the entries before the oldest entry not delivered or pending in any group by XTRIM MINID
+func (r *RedisStream) Trim(stream string) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	key := r.key(stream)
+	exists, err := redis.Bool(conn.Do("EXISTS", key))
+	if err != nil || !exists {
+		return err
+	}
+	// reply is [[name, group, consumers, n, pending, n, last-delivered-id, id, ...], ...]
+	groups, err := redis.Values(conn.Do("XINFO", "GROUPS", key))
+	if err != nil {
+		return err
+	}
+	if len(groups) == 0 {
+		// no one receive the entries
+		_, err := conn.Do("XTRIM", key, "MAXLEN", 0)
+		return err
+	}
+
+	min := ""
+	for _, g := range groups {
+		name, last, err := parseRedisStreamGroup(g)
+		if err != nil {
+			return err
+		}
+		// reply is [count, min id, max id, consumers]
+		summary, err := redis.Values(conn.Do("XPENDING", key, name))
+		if err != nil || len(summary) != 4 {
+			return errors.Errorf("unexpected XPENDING reply %v, err %v", summary, err)
+		}
+		bound := nextStreamID(last)
+		if n, _ := redis.Int(summary[0], nil); n > 0 {
+			bound, _ = redis.String(summary[1], nil)
+		}
+		if min == "" || compareStreamID(bound, min) < 0 {
+			min = bound
+		}
+	}
+	_, err = conn.Do("XTRIM", key, "MINID", min)
+	return err
+}
+
+// parseRedisStreamGroup return the name and the last delivered ID of the XINFO GROUPS reply
+func parseRedisStreamGroup(reply interface{}) (string, string, error) {
+	kv, err := redis.Values(reply, nil)
+	if err != nil {
+		return "", "", err
+	}
+	var name, last string
+	for i := 0; i+1 < len(kv); i += 2 {
+		k, _ := redis.String(kv[i], nil)
+		switch k {
+		case "name":
+			name, _ = redis.String(kv[i+1], nil)
+		case "last-delivered-id":
+			last, _ = redis.String(kv[i+1], nil)
+		}
+	}
+	if name == "" || last == "" {
+		return "", "", errors.Errorf("unexpected XINFO GROUPS reply %v", reply)
+	}
+	return name, last, nil
+}
+
+// splitStreamID return the milliseconds and the sequence of the entry ID "<millis>-<sequence>"
+func splitStreamID(id string) (uint64, uint64) {
+	parts := strings.SplitN(id, "-", 2)
+	ms, _ := strconv.ParseUint(parts[0], 10, 64)
+	var seq uint64
+	if len(parts) == 2 {
+		seq, _ = strconv.ParseUint(parts[1], 10, 64)
+	}
+	return ms, seq
+}
+
+// nextStreamID return the smallest entry ID greater than the id
+func nextStreamID(id string) string {
+	ms, seq := splitStreamID(id)
+	return fmt.Sprintf("%d-%d", ms, seq+1)
+}
+
+// compareStreamID return -1, 0 or 1 by comparing the entry IDs
+func compareStreamID(a, b string) int {
+	ams, aseq := splitStreamID(a)
+	bms, bseq := splitStreamID(b)
+	switch {
+	case ams < bms || (ams == bms && aseq < bseq):
+		return -1
+	case ams == bms && aseq == bseq:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// parseRedisStreamEntries parse the entries [[id, [field, value, ...]], ...], the deleted entries are skipped
+func parseRedisStreamEntries(reply interface{}) ([]*StreamEntry, error) {
+	values, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*StreamEntry, 0, len(values))
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		kv, err := redis.Values(v, nil)
+		if err != nil || len(kv) != 2 {
+			return nil, errors.Errorf("unexpected stream entry %v", v)
+		}
+		if kv[1] == nil {
+			continue
+		}
+		id, err := redis.String(kv[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := redis.ByteSlices(kv[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		e := &StreamEntry{ID: id}
+		for i := 0; i+1 < len(fields); i += 2 {
+			if string(fields[i]) == redisStreamField {
+				e.Value = fields[i+1]
+			}
+		}
+		res = append(res, e)
+	}
+	return res, nil
+}
+
+func durationMillis(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
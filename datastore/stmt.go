@@ -0,0 +1,105 @@
+package datastore
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// stmtCache hold the prepared statement of each query, prepared at the first use and reused after that
+type stmtCache struct {
+	db *sql.DB
+
+	mu    sync.RWMutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{
+		db:    db,
+		stmts: make(map[string]*sql.Stmt),
+	}
+}
+
+// prepare return the cached statement of the query, or prepare it
+func (c *stmtCache) prepare(query string) (*sql.Stmt, error) {
+	c.mu.RLock()
+	stmt, ok := c.stmts[query]
+	c.mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// Exec execute the cached statement
+func (c *stmtCache) Exec(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+// Query query the cached statement
+func (c *stmtCache) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	stmt, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args...)
+}
+
+// QueryRow query the cached statement, the error is returned by Scan
+func (c *stmtCache) QueryRow(query string, args ...interface{}) (*sql.Row, error) {
+	stmt, err := c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryRow(args...), nil
+}
+
+// tx return execer of the cached statements in the transaction
+func (c *stmtCache) tx(tx *sql.Tx) execer {
+	return &stmtCacheTx{c: c, tx: tx}
+}
+
+// Close close all cached statements
+func (c *stmtCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res error
+	for q, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil && res == nil {
+			res = err
+		}
+		delete(c.stmts, q)
+	}
+	return res
+}
+
+// stmtCacheTx execute the cached statements in the transaction
+type stmtCacheTx struct {
+	c  *stmtCache
+	tx *sql.Tx
+}
+
+// Exec execute the cached statement bound to the transaction
+func (t *stmtCacheTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := t.c.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return t.tx.Stmt(stmt).Exec(args...)
+}
@@ -0,0 +1,281 @@
+package datastore
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StreamEntry is the entry of the Stream delivered to the consumer group
+type StreamEntry struct {
+	ID    string
+	Value []byte
+	// DeliveryCount is number of the delivery to the consumer group, include this delivery
+	DeliveryCount int
+}
+
+// Stream is the Datastore delivering the entries appended to the stream to the each consumer group by itself.
+// the delivered entries are pending until acked, and redelivered after idle longer than minIdle.
+type Stream interface {
+	// CreateGroup create the consumer group received the entries appended after this
+	CreateGroup(stream, group string) error
+	DestroyGroup(stream, group string) error
+	// DeleteStream delete the stream and the consumer groups
+	DeleteStream(stream string) error
+
+	// Append append the value to the stream and return the entry ID
+	Append(stream string, value []byte) (string, error)
+	// Read claim the pending entries idle longer than minIdle to the consumer, and read the new entries up to count
+	Read(stream, group, consumer string, count int, minIdle time.Duration) ([]*StreamEntry, error)
+	Ack(stream, group string, ids ...string) error
+	// SetIdle set the idle time of the pending entry, the entry is redelivered when the idle exceeded minIdle
+	SetIdle(stream, group, consumer, id string, idle time.Duration) error
+	// Extend keep the pending entry from the redelivery until the deadline, even after the idle exceeded minIdle
+	Extend(stream, group, consumer, id string, deadline time.Time) error
+	// Trim delete the entries delivered to all consumer groups and acked
+	Trim(stream string) error
+}
+
+// MemoryStream is the in-process Stream on the Memory, for the single server and the tests
+type MemoryStream struct {
+	*Memory
+
+	mu      sync.Mutex
+	streams map[string]*memoryStreamData
+	lastID  int64
+	lastSeq int64
+}
+
+type memoryStreamData struct {
+	entries []*StreamEntry
+	groups  map[string]*memoryStreamGroup
+}
+
+type memoryStreamGroup struct {
+	// next is the index of the entries delivered next
+	next    int
+	pending map[string]*memoryStreamPending
+}
+
+type memoryStreamPending struct {
+	entry       *StreamEntry
+	consumer    string
+	deliveredAt time.Time
+	count       int
+	// extended is the deadline set by the Extend, not redelivered until it
+	extended time.Time
+}
+
+// NewMemoryStream return the MemoryStream
+func NewMemoryStream(cfg *Config) *MemoryStream {
+	return &MemoryStream{
+		Memory:  NewMemory(cfg),
+		streams: make(map[string]*memoryStreamData),
+	}
+}
+
+func (m *MemoryStream) stream(name string) *memoryStreamData {
+	s, ok := m.streams[name]
+	if !ok {
+		s = &memoryStreamData{groups: make(map[string]*memoryStreamGroup)}
+		m.streams[name] = s
+	}
+	return s
+}
+
+// CreateGroup create the consumer group, do nothing when already exist
+func (m *MemoryStream) CreateGroup(stream, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stream(stream)
+	if _, ok := s.groups[group]; ok {
+		return nil
+	}
+	s.groups[group] = &memoryStreamGroup{
+		next:    len(s.entries),
+		pending: make(map[string]*memoryStreamPending),
+	}
+	return nil
+}
+
+// DestroyGroup delete the consumer group
+func (m *MemoryStream) DestroyGroup(stream, group string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.streams[stream]; ok {
+		delete(s.groups, group)
+	}
+	return nil
+}
+
+// DeleteStream delete the stream
+func (m *MemoryStream) DeleteStream(stream string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.streams, stream)
+	return nil
+}
+
+// Append append the value with the ID like "<unix millis>-<sequence>"
+func (m *MemoryStream) Append(stream string, value []byte) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ms := time.Now().UnixNano() / int64(time.Millisecond)
+	if ms <= m.lastID {
+		ms = m.lastID
+		m.lastSeq++
+	} else {
+		m.lastSeq = 0
+	}
+	m.lastID = ms
+
+	e := &StreamEntry{
+		ID:    fmt.Sprintf("%d-%d", ms, m.lastSeq),
+		Value: value,
+	}
+	s := m.stream(stream)
+	s.entries = append(s.entries, e)
+	return e.ID, nil
+}
+
+// Read claim the idle pending entries in the ID order, and read the new entries
+func (m *MemoryStream) Read(stream, group, consumer string, count int, minIdle time.Duration) ([]*StreamEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, err := m.group(stream, group)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res := make([]*StreamEntry, 0, count)
+
+	ids := make([]string, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if len(res) >= count {
+			break
+		}
+		p := g.pending[id]
+		if now.Sub(p.deliveredAt) < minIdle || now.Before(p.extended) {
+			continue
+		}
+		p.consumer = consumer
+		p.deliveredAt = now
+		p.extended = time.Time{}
+		p.count++
+		res = append(res, &StreamEntry{ID: id, Value: p.entry.Value, DeliveryCount: p.count})
+	}
+
+	entries := m.streams[stream].entries
+	for ; len(res) < count && g.next < len(entries); g.next++ {
+		e := entries[g.next]
+		g.pending[e.ID] = &memoryStreamPending{entry: e, consumer: consumer, deliveredAt: now, count: 1}
+		res = append(res, &StreamEntry{ID: e.ID, Value: e.Value, DeliveryCount: 1})
+	}
+	return res, nil
+}
+
+// Ack remove the entries from the pending
+func (m *MemoryStream) Ack(stream, group string, ids ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, err := m.group(stream, group)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(g.pending, id)
+	}
+	return nil
+}
+
+// SetIdle set the idle time of the pending entry
+func (m *MemoryStream) SetIdle(stream, group, consumer, id string, idle time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, err := m.group(stream, group)
+	if err != nil {
+		return err
+	}
+	p, ok := g.pending[id]
+	if !ok {
+		return ErrNotFoundEntry
+	}
+	p.consumer = consumer
+	p.deliveredAt = time.Now().Add(-idle)
+	p.extended = time.Time{}
+	return nil
+}
+
+// Extend set the deadline of the pending entry
+func (m *MemoryStream) Extend(stream, group, consumer, id string, deadline time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, err := m.group(stream, group)
+	if err != nil {
+		return err
+	}
+	p, ok := g.pending[id]
+	if !ok {
+		return ErrNotFoundEntry
+	}
+	p.consumer = consumer
+	p.deliveredAt = time.Now()
+	p.extended = deadline
+	return nil
+}
+
+// Trim delete the entries before the oldest entry not delivered or pending in any group
+func (m *MemoryStream) Trim(stream string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.streams[stream]
+	if !ok {
+		return nil
+	}
+	min := len(s.entries)
+	for _, g := range s.groups {
+		if g.next < min {
+			min = g.next
+		}
+		for i := 0; i < min; i++ {
+			if _, ok := g.pending[s.entries[i].ID]; ok {
+				min = i
+				break
+			}
+		}
+	}
+	s.entries = s.entries[min:]
+	for _, g := range s.groups {
+		g.next -= min
+	}
+	return nil
+}
+
+// group return the consumer group, the caller holds the lock
+func (m *MemoryStream) group(stream, group string) (*memoryStreamGroup, error) {
+	s, ok := m.streams[stream]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFoundEntry, "stream=%s", stream)
+	}
+	g, ok := s.groups[group]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotFoundEntry, "group=%s", group)
+	}
+	return g, nil
+}
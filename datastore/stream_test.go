@@ -0,0 +1,286 @@
+package datastore
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// streamEntryValues return the values and the delivery counts of the entries
+func streamEntryValues(entries []*StreamEntry) ([]string, []int) {
+	values := make([]string, 0, len(entries))
+	counts := make([]int, 0, len(entries))
+	for _, e := range entries {
+		values = append(values, string(e.Value))
+		counts = append(counts, e.DeliveryCount)
+	}
+	return values, counts
+}
+
+// testStream check the delivery of the Stream
+func testStream(t *testing.T, s Stream) {
+	const stream = "stream_test"
+	s.DeleteStream(stream)
+	defer s.DeleteStream(stream)
+
+	// the entries appended before the group are not delivered
+	if _, err := s.Append(stream, []byte("before")); err != nil {
+		t.Fatalf("failed to append, got err %v", err)
+	}
+	for _, g := range []string{"a", "b"} {
+		if err := s.CreateGroup(stream, g); err != nil {
+			t.Fatalf("failed to create group, got err %v", err)
+		}
+	}
+	if err := s.CreateGroup(stream, "a"); err != nil {
+		t.Fatalf("want no error when already exist group, got err %v", err)
+	}
+	for _, v := range []string{"1", "2", "3"} {
+		if _, err := s.Append(stream, []byte(v)); err != nil {
+			t.Fatalf("failed to append, got err %v", err)
+		}
+	}
+
+	cases := []struct {
+		group        string
+		count        int
+		minIdle      time.Duration
+		expectValues []string
+		expectCounts []int
+		ack          bool
+	}{
+		{"a", 2, time.Hour, []string{"1", "2"}, []int{1, 1}, false},
+		// the pending entries are not idle yet
+		{"a", 2, time.Hour, []string{"3"}, []int{1}, false},
+		{"a", 2, time.Hour, []string{}, []int{}, false},
+		// each group receive all entries
+		{"b", 5, time.Hour, []string{"1", "2", "3"}, []int{1, 1, 1}, true},
+		{"b", 5, 0, []string{}, []int{}, false},
+		// redelivery of the idle entries
+		{"a", 5, 0, []string{"1", "2", "3"}, []int{2, 2, 2}, true},
+		{"a", 5, 0, []string{}, []int{}, false},
+	}
+	for i, c := range cases {
+		entries, err := s.Read(stream, c.group, "consumer", c.count, c.minIdle)
+		if err != nil {
+			t.Fatalf("#%d: failed to read, got err %v", i, err)
+		}
+		values, counts := streamEntryValues(entries)
+		if !reflect.DeepEqual(values, c.expectValues) {
+			t.Errorf("#%d: want values %v, got %v", i, c.expectValues, values)
+		}
+		if !reflect.DeepEqual(counts, c.expectCounts) {
+			t.Errorf("#%d: want delivery counts %v, got %v", i, c.expectCounts, counts)
+		}
+		if c.ack {
+			ids := make([]string, 0, len(entries))
+			for _, e := range entries {
+				ids = append(ids, e.ID)
+			}
+			if err := s.Ack(stream, c.group, ids...); err != nil {
+				t.Fatalf("#%d: failed to ack, got err %v", i, err)
+			}
+		}
+	}
+}
+
+func testStreamSetIdle(t *testing.T, s Stream) {
+	const stream = "stream_test_idle"
+	s.DeleteStream(stream)
+	defer s.DeleteStream(stream)
+
+	if err := s.CreateGroup(stream, "a"); err != nil {
+		t.Fatalf("failed to create group, got err %v", err)
+	}
+	id, err := s.Append(stream, []byte("1"))
+	if err != nil {
+		t.Fatalf("failed to append, got err %v", err)
+	}
+	if _, err := s.Read(stream, "a", "consumer", 1, time.Hour); err != nil {
+		t.Fatalf("failed to read, got err %v", err)
+	}
+	if err := s.SetIdle(stream, "a", "consumer", id, time.Hour); err != nil {
+		t.Fatalf("failed to set idle, got err %v", err)
+	}
+	entries, err := s.Read(stream, "a", "consumer", 1, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to read, got err %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != id || entries[0].DeliveryCount != 2 {
+		t.Errorf("want redelivered entry %s, got %v", id, entries)
+	}
+
+	if err := s.Ack(stream, "a", id); err != nil {
+		t.Fatalf("failed to ack, got err %v", err)
+	}
+	if err := s.SetIdle(stream, "a", "consumer", id, time.Hour); err != ErrNotFoundEntry {
+		t.Errorf("want error %v, got %v", ErrNotFoundEntry, err)
+	}
+}
+
+func testStreamExtend(t *testing.T, s Stream) {
+	const stream = "stream_test_extend"
+	s.DeleteStream(stream)
+	defer s.DeleteStream(stream)
+
+	if err := s.CreateGroup(stream, "a"); err != nil {
+		t.Fatalf("failed to create group, got err %v", err)
+	}
+	id, err := s.Append(stream, []byte("1"))
+	if err != nil {
+		t.Fatalf("failed to append, got err %v", err)
+	}
+	if _, err := s.Read(stream, "a", "consumer", 1, 0); err != nil {
+		t.Fatalf("failed to read, got err %v", err)
+	}
+
+	cases := []struct {
+		extend      time.Duration
+		expectCount int
+	}{
+		// not redelivered until the deadline, even after minIdle
+		{time.Hour, 0},
+		// the deadline is passed
+		{-time.Second, 1},
+	}
+	for i, c := range cases {
+		if err := s.Extend(stream, "a", "consumer", id, time.Now().Add(c.extend)); err != nil {
+			t.Fatalf("#%d: failed to extend, got err %v", i, err)
+		}
+		entries, err := s.Read(stream, "a", "consumer", 1, 0)
+		if err != nil {
+			t.Fatalf("#%d: failed to read, got err %v", i, err)
+		}
+		if len(entries) != c.expectCount {
+			t.Errorf("#%d: want %d entries, got %v", i, c.expectCount, entries)
+		}
+	}
+	if err := s.Extend(stream, "a", "consumer", "0-1", time.Now()); err != ErrNotFoundEntry {
+		t.Errorf("want error %v, got %v", ErrNotFoundEntry, err)
+	}
+}
+
+// testStreamTrim check the entries pending or not delivered in any group are not trimmed
+func testStreamTrim(t *testing.T, s Stream) {
+	const stream = "stream_test_trim"
+	s.DeleteStream(stream)
+	defer s.DeleteStream(stream)
+
+	// not exist stream
+	if err := s.Trim(stream); err != nil {
+		t.Fatalf("failed to trim, got err %v", err)
+	}
+	for _, g := range []string{"a", "b"} {
+		if err := s.CreateGroup(stream, g); err != nil {
+			t.Fatalf("failed to create group, got err %v", err)
+		}
+	}
+	for _, v := range []string{"1", "2", "3"} {
+		if _, err := s.Append(stream, []byte(v)); err != nil {
+			t.Fatalf("failed to append, got err %v", err)
+		}
+	}
+
+	cases := []struct {
+		group       string
+		count       int
+		ack         bool
+		expectValue []string
+	}{
+		{"a", 2, false, []string{"1", "2"}},
+		{"b", 3, true, []string{"1", "2", "3"}},
+		// the pending entries and the not delivered entry are kept
+		{"a", 3, true, []string{"1", "2", "3"}},
+		{"a", 3, false, []string{}},
+	}
+	for i, c := range cases {
+		entries, err := s.Read(stream, c.group, "consumer", c.count, 0)
+		if err != nil {
+			t.Fatalf("#%d: failed to read, got err %v", i, err)
+		}
+		values, _ := streamEntryValues(entries)
+		if !reflect.DeepEqual(values, c.expectValue) {
+			t.Errorf("#%d: want values %v, got %v", i, c.expectValue, values)
+		}
+		if c.ack {
+			for _, e := range entries {
+				if err := s.Ack(stream, c.group, e.ID); err != nil {
+					t.Fatalf("#%d: failed to ack, got err %v", i, err)
+				}
+			}
+		}
+		if err := s.Trim(stream); err != nil {
+			t.Fatalf("#%d: failed to trim, got err %v", i, err)
+		}
+	}
+}
+
+func TestMemoryStream(t *testing.T) {
+	testStream(t, NewMemoryStream(nil))
+	testStreamSetIdle(t, NewMemoryStream(nil))
+	testStreamExtend(t, NewMemoryStream(nil))
+	testStreamTrim(t, NewMemoryStream(nil))
+}
+
+func TestMemoryStreamTrim(t *testing.T) {
+	const stream = "stream_test_trim"
+	s := NewMemoryStream(nil)
+	if err := s.CreateGroup(stream, "a"); err != nil {
+		t.Fatalf("failed to create group, got err %v", err)
+	}
+	for _, v := range []string{"1", "2", "3"} {
+		if _, err := s.Append(stream, []byte(v)); err != nil {
+			t.Fatalf("failed to append, got err %v", err)
+		}
+	}
+
+	cases := []struct {
+		read         int
+		ack          int
+		expectRemain int
+	}{
+		{2, 0, 3},
+		{0, 1, 2},
+		{1, 2, 0},
+	}
+	for i, c := range cases {
+		if _, err := s.Read(stream, "a", "consumer", c.read, time.Hour); err != nil {
+			t.Fatalf("#%d: failed to read, got err %v", i, err)
+		}
+		ids := make([]string, 0)
+		for _, e := range s.streams[stream].entries {
+			if len(ids) < c.ack {
+				ids = append(ids, e.ID)
+			}
+		}
+		if err := s.Ack(stream, "a", ids...); err != nil {
+			t.Fatalf("#%d: failed to ack, got err %v", i, err)
+		}
+		if err := s.Trim(stream); err != nil {
+			t.Fatalf("#%d: failed to trim, got err %v", i, err)
+		}
+		if got := len(s.streams[stream].entries); got != c.expectRemain {
+			t.Errorf("#%d: want remain %d, got %d", i, c.expectRemain, got)
+		}
+	}
+}
+
+func TestRedisStream(t *testing.T) {
+	if os.Getenv("GO_PUBSUB_TEST_DATASTORE") != "redis-stream" {
+		t.Skip("require redis-server")
+	}
+	s, err := NewRedisStream(&Config{
+		Redis: &RedisConfig{
+			Addr: "localhost:6379",
+			Mode: RedisStreamMode,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to connect redis, got err %v", err)
+	}
+	testStream(t, s)
+	testStreamSetIdle(t, s)
+	testStreamExtend(t, s)
+	testStreamTrim(t, s)
+}
@@ -0,0 +1,36 @@
+package datastore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// build return tls.Config loaded the certificate files
+func (c *TLSConfig) build() (*tls.Config, error) {
+	res := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read ca file, path=%s", c.CAFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("not found certificate in ca file, path=%s", c.CAFile)
+		}
+		res.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client certificate")
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+	return res, nil
+}
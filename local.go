@@ -0,0 +1,481 @@
+package pubsub
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/client"
+	"github.com/takashabe/go-pubsub/datastore"
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// localService implement client.Service interface for the Store in the same process, without HTTP
+type localService struct {
+	store *models.Store
+}
+
+// NewLocalClient returns a new pubsub client accessing the Store in the same process
+func NewLocalClient(ctx context.Context, store *models.Store) (*client.Client, error) {
+	if store == nil {
+		return nil, errors.New("require non-nil store")
+	}
+	return client.NewClientWithService(ctx, &localService{store: store})
+}
+
+// isNotFound return whether the error means the entry is not exist
+func isNotFound(err error) bool {
+	cause := errors.Cause(err)
+	return cause == models.ErrNotFoundEntry || cause == datastore.ErrNotFoundEntry
+}
+
+func (s *localService) CreateTopic(ctx context.Context, id string, cfg client.TopicConfig) error {
+	t, err := s.store.NewTopicWithOptions(id, models.TopicOptions{
+		MessageRetentionDuration: cfg.MessageRetentionDuration,
+	})
+	if err != nil {
+		return err
+	}
+	s.store.Stats().GetTopicAdapter().AddTopic(t.Name, 1)
+	return nil
+}
+
+func (s *localService) DeleteTopic(ctx context.Context, id string) error {
+	t, err := s.store.GetTopic(id)
+	if err != nil {
+		return err
+	}
+	if err := t.Delete(false); err != nil {
+		return err
+	}
+	s.store.Stats().GetTopicAdapter().AddTopic(t.Name, -1)
+	return nil
+}
+
+func (s *localService) TopicExists(ctx context.Context, id string) (bool, error) {
+	_, err := s.store.GetTopic(id)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *localService) ListTopics(ctx context.Context) ([]string, error) {
+	topics, err := s.store.ListTopic()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(models.ByTopicName(topics))
+	ret := make([]string, 0, len(topics))
+	for _, t := range topics {
+		ret = append(ret, t.Name)
+	}
+	return ret, nil
+}
+
+func (s *localService) ListTopicSubscriptions(ctx context.Context, id string) ([]string, error) {
+	t, err := s.store.GetTopic(id)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := t.GetSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(models.BySubscriptionName(subs))
+	ret := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		ret = append(ret, sub.Name)
+	}
+	return ret, nil
+}
+
+func (s *localService) PublishMessages(ctx context.Context, topicID string, msgs []*client.Message) ([]string, error) {
+	t, err := s.store.GetTopic(topicID)
+	if err != nil {
+		return nil, err
+	}
+	pms := make([]*models.PublishMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		pms = append(pms, &models.PublishMessage{Data: msg.Data, Attributes: msg.Attributes, OrderingKey: msg.OrderingKey})
+	}
+	ids, err := t.PublishBatch(pms)
+	if err != nil {
+		return nil, err
+	}
+	s.store.Stats().GetTopicAdapter().AddMessage(t.Name, len(msgs))
+	return ids, nil
+}
+
+func (s *localService) CreateSubscription(ctx context.Context, id string, cfg client.SubscriptionConfig) error {
+	if cfg.Topic == nil {
+		return errors.New("require non-nil topic")
+	}
+	if cfg.AckTimeout <= 0 {
+		cfg.AckTimeout = 10 * time.Second
+	}
+
+	push := cfg.PushConfig
+	if push == nil {
+		push = &client.PushConfig{}
+	}
+	opts := models.SubscriptionOptions{
+		AckDeadline:               cfg.AckTimeout.Truncate(time.Second),
+		PushEndpoint:              push.Endpoint,
+		PushAttributes:            push.Attributes,
+		Filter:                    cfg.Filter,
+		EnableMessageOrdering:     cfg.EnableMessageOrdering,
+		EnableExactlyOnceDelivery: cfg.EnableExactlyOnceDelivery,
+		MessageRetentionDuration:  cfg.MessageRetentionDuration,
+		RetainAckedMessages:       cfg.RetainAckedMessages,
+	}
+	if p := cfg.DeadLetterPolicy; p != nil {
+		opts.DeadLetterPolicy = &models.DeadLetterPolicy{DeadLetterTopic: p.DeadLetterTopic, MaxDeliveryAttempts: p.MaxDeliveryAttempts}
+	}
+	if p := cfg.RetryPolicy; p != nil {
+		opts.RetryPolicy = &models.RetryPolicy{MinimumBackoff: p.MinimumBackoff, MaximumBackoff: p.MaximumBackoff}
+	}
+	if p := cfg.ExpirationPolicy; p != nil {
+		opts.ExpirationPolicy = &models.ExpirationPolicy{TTL: p.TTL}
+	}
+	sub, err := s.store.NewSubscriptionWithOptions(id, cfg.Topic.ID, opts)
+	if err != nil {
+		return err
+	}
+	s.store.Stats().GetSubscriptionAdapter().AddSubscription(sub.Name, 1)
+	return nil
+}
+
+func (s *localService) GetSubscriptionConfig(ctx context.Context, id string) (*client.SubscriptionConfig, error) {
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &client.SubscriptionConfig{
+		Topic:      &client.Topic{ID: sub.TopicID},
+		PushConfig: &client.PushConfig{},
+		AckTimeout: sub.DefaultAckDeadline,
+		Filter:     sub.Filter,
+
+		EnableMessageOrdering:     sub.EnableMessageOrdering,
+		EnableExactlyOnceDelivery: sub.EnableExactlyOnceDelivery,
+
+		MessageRetentionDuration: sub.MessageRetentionDuration,
+		RetainAckedMessages:      sub.RetainAckedMessages,
+		LastActivityTime:         sub.LastActivityAt,
+	}
+	if sub.PushConfig != nil && sub.PushConfig.HasValidEndpoint() {
+		cfg.PushConfig.Endpoint = sub.PushConfig.Endpoint.String()
+		cfg.PushConfig.Attributes = sub.PushConfig.Attributes.Dump()
+	}
+	if p := sub.DeadLetterPolicy; p != nil {
+		cfg.DeadLetterPolicy = &client.DeadLetterPolicy{
+			DeadLetterTopic:     p.DeadLetterTopic,
+			MaxDeliveryAttempts: p.MaxDeliveryAttempts,
+		}
+	}
+	if p := sub.RetryPolicy; p != nil {
+		cfg.RetryPolicy = &client.RetryPolicy{
+			MinimumBackoff: p.MinimumBackoff,
+			MaximumBackoff: p.MaximumBackoff,
+		}
+	}
+	if p := sub.ExpirationPolicy; p != nil {
+		cfg.ExpirationPolicy = &client.ExpirationPolicy{
+			TTL: p.TTL,
+		}
+	}
+	return cfg, nil
+}
+
+func (s *localService) ListSubscriptions(ctx context.Context) ([]string, error) {
+	subs, err := s.store.ListSubscription()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(models.BySubscriptionName(subs))
+	ret := make([]string, 0, len(subs))
+	for _, sub := range subs {
+		ret = append(ret, sub.Name)
+	}
+	return ret, nil
+}
+
+func (s *localService) DeleteSubscription(ctx context.Context, id string) error {
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		return err
+	}
+	if err := sub.Delete(); err != nil {
+		return err
+	}
+	s.store.Stats().GetSubscriptionAdapter().AddSubscription(sub.Name, -1)
+	return nil
+}
+
+func (s *localService) SubscriptionExists(ctx context.Context, id string) (bool, error) {
+	_, err := s.store.GetSubscription(id)
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *localService) ModifyPushConfig(ctx context.Context, id string, cfg *client.PushConfig) error {
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		cfg = &client.PushConfig{}
+	}
+	return sub.SetPushConfig(cfg.Endpoint, cfg.Attributes)
+}
+
+func (s *localService) Seek(ctx context.Context, id string, t time.Time) error {
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		return err
+	}
+	return sub.Seek(t)
+}
+
+func (s *localService) RestoreSnapshot(ctx context.Context, id, snapshotID string) error {
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		return err
+	}
+	snap, err := s.store.GetSnapshot(snapshotID)
+	if err != nil {
+		return err
+	}
+	return sub.RestoreSnapshot(snap)
+}
+
+func (s *localService) CreateSnapshot(ctx context.Context, id string, cfg client.SnapshotConfig) error {
+	if cfg.Subscription == nil {
+		return errors.New("require non-nil subscription")
+	}
+	_, err := s.store.NewSnapshot(id, cfg.Subscription.ID, cfg.Expiration)
+	return err
+}
+
+func (s *localService) GetSnapshotConfig(ctx context.Context, id string) (*client.SnapshotConfig, error) {
+	snap, err := s.store.GetSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	return &client.SnapshotConfig{
+		Topic:        &client.Topic{ID: snap.TopicID},
+		Subscription: &client.Subscription{ID: snap.SubscriptionID},
+		ExpireTime:   snap.ExpireAt,
+	}, nil
+}
+
+func (s *localService) ListSnapshots(ctx context.Context) ([]string, error) {
+	snaps, err := s.store.ListSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(models.BySnapshotName(snaps))
+	ret := make([]string, 0, len(snaps))
+	for _, snap := range snaps {
+		ret = append(ret, snap.Name)
+	}
+	return ret, nil
+}
+
+func (s *localService) DeleteSnapshot(ctx context.Context, id string) error {
+	snap, err := s.store.GetSnapshot(id)
+	if err != nil {
+		return err
+	}
+	return snap.Delete()
+}
+
+func (s *localService) ModifyAckDeadline(ctx context.Context, subID string, deadline time.Duration, ackIDs []string) error {
+	sub, err := s.store.GetSubscription(subID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ackIDs {
+		if err := sub.ModifyAckDeadline(id, int64(deadline.Seconds())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *localService) PullMessages(ctx context.Context, subID string, maxMessages int, maxWait time.Duration) ([]*client.Message, error) {
+	if maxMessages <= 0 {
+		maxMessages = 1
+	}
+	sub, err := s.store.GetSubscription(subID)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*models.PullMessage
+	if maxWait > 0 {
+		ctx, cancel := context.WithTimeout(ctx, maxWait)
+		defer cancel()
+		msgs, err = sub.PullWait(ctx, maxMessages)
+	} else {
+		msgs, err = sub.Pull(maxMessages)
+	}
+	if errors.Cause(err) == models.ErrEmptyMessage {
+		if ctx.Err() != nil {
+			// same as the canceled request of the REST
+			return nil, ctx.Err()
+		}
+		return nil, client.ErrNotFoundMessage
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fromPullMessages(msgs), nil
+}
+
+// fromPullMessages convert the pulled messages to the client Message
+func fromPullMessages(msgs []*models.PullMessage) []*client.Message {
+	ret := make([]*client.Message, 0, len(msgs))
+	for _, m := range msgs {
+		ret = append(ret, &client.Message{
+			ID:              m.Message.ID,
+			Data:            m.Message.Data,
+			Attributes:      m.Message.Attributes,
+			AckID:           m.AckID,
+			PublishTime:     m.Message.PublishedAt,
+			OrderingKey:     m.Message.OrderingKey,
+			DeliveryAttempt: m.DeliveryAttempt,
+		})
+	}
+	return ret
+}
+
+func (s *localService) Ack(ctx context.Context, subID string, ackIDs []string) error {
+	sub, err := s.store.GetSubscription(subID)
+	if err != nil {
+		return err
+	}
+	return ackMessages(sub, ackIDs)
+}
+
+// ackMessages ack the messages of the Subscription,
+// returns AckError of the failed AckIDs in the exactly once delivery Subscription same as the REST
+func ackMessages(sub *models.Subscription, ackIDs []string) error {
+	if !sub.EnableExactlyOnceDelivery {
+		return sub.Ack(ackIDs...)
+	}
+	failed := []string{}
+	for _, r := range sub.ConfirmAck(ackIDs...) {
+		if r.Err != nil {
+			failed = append(failed, r.AckID)
+		}
+	}
+	if len(failed) > 0 {
+		return &client.AckError{AckIDs: failed}
+	}
+	return nil
+}
+
+func (s *localService) StreamingPull(ctx context.Context, subID string, maxOutstanding int) (client.MessageStream, error) {
+	if _, err := s.store.GetSubscription(subID); err != nil {
+		return nil, err
+	}
+	if maxOutstanding <= 0 {
+		maxOutstanding = client.DefaultReceiveSettings.MaxOutstandingMessages
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &localStream{
+		store:       s.store,
+		subID:       subID,
+		ctx:         ctx,
+		cancel:      cancel,
+		outstanding: models.NewOutstanding(maxOutstanding),
+	}, nil
+}
+
+// localStream implement client.MessageStream interface for the Store, the flow control is same as the server
+type localStream struct {
+	store  *models.Store
+	subID  string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	outstanding *models.Outstanding
+}
+
+func (st *localStream) Recv() ([]*client.Message, error) {
+	for {
+		if st.outstanding.Available() <= 0 {
+			if err := st.outstanding.Wait(st.ctx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		sub, err := st.store.GetSubscription(st.subID)
+		if err != nil {
+			return nil, err
+		}
+		msgs, err := sub.StreamingPullWait(st.ctx, st.outstanding.Available())
+		if errors.Cause(err) == models.ErrEmptyMessage {
+			if st.ctx.Err() != nil {
+				return nil, st.ctx.Err()
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		st.outstanding.Deliver(msgs, sub.StreamAckDeadline())
+		return fromPullMessages(msgs), nil
+	}
+}
+
+func (st *localStream) Ack(ackIDs []string) error {
+	defer st.outstanding.Release(ackIDs)
+	sub, err := st.store.GetSubscription(st.subID)
+	if err != nil {
+		return err
+	}
+	return ackMessages(sub, ackIDs)
+}
+
+func (st *localStream) ModifyAckDeadline(deadline time.Duration, ackIDs []string) error {
+	if deadline <= 0 {
+		// nack
+		defer st.outstanding.Release(ackIDs)
+	} else {
+		defer st.outstanding.Extend(ackIDs, deadline)
+	}
+	sub, err := st.store.GetSubscription(st.subID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ackIDs {
+		if err := sub.ModifyAckDeadline(id, int64(deadline.Seconds())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *localStream) Close() error {
+	st.cancel()
+	return nil
+}
+
+func (s *localService) StatsSummary(ctx context.Context) ([]byte, error) {
+	return s.store.Stats().Summary()
+}
+
+func (s *localService) StatsTopicDetail(ctx context.Context, id string) ([]byte, error) {
+	return s.store.Stats().TopicDetail(id)
+}
+
+func (s *localService) StatsSubscriptionDetail(ctx context.Context, id string) ([]byte, error) {
+	return s.store.Stats().SubscriptionDetail(id)
+}
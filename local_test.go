@@ -0,0 +1,116 @@
+package pubsub
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/takashabe/go-pubsub/client"
+	"github.com/takashabe/go-pubsub/models"
+)
+
+func setupLocalClient(t *testing.T) *client.Client {
+	store, err := models.NewStore(nil)
+	if err != nil {
+		t.Fatalf("failed to create store, error=%v", err)
+	}
+	cli, err := NewLocalClient(context.Background(), store)
+	if err != nil {
+		t.Fatalf("failed to NewLocalClient, error=%v", err)
+	}
+	return cli
+}
+
+func TestLocalClientReceive(t *testing.T) {
+	cases := []struct {
+		streaming bool
+	}{
+		{false},
+		{true},
+	}
+	for i, c := range cases {
+		ctx := context.Background()
+		cli := setupLocalClient(t)
+		topic, err := cli.CreateTopic(ctx, "topic1")
+		if err != nil {
+			t.Fatalf("#%d: failed to create topic, error=%v", i, err)
+		}
+		sub, err := cli.CreateSubscription(ctx, "sub1", client.SubscriptionConfig{Topic: topic, AckTimeout: time.Second})
+		if err != nil {
+			t.Fatalf("#%d: failed to create subscription, error=%v", i, err)
+		}
+		for _, data := range []string{"msg1", "msg2"} {
+			if _, err := topic.Publish(ctx, &client.Message{Data: []byte(data)}).Get(ctx); err != nil {
+				t.Fatalf("#%d: failed to publish message, error=%v", i, err)
+			}
+		}
+
+		var mu sync.Mutex
+		got := []string{}
+		cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		sub.ReceiveSettings.Streaming = c.streaming
+		err = sub.Receive(cctx, func(ctx context.Context, msg *client.Message) {
+			mu.Lock()
+			defer mu.Unlock()
+			msg.Ack()
+			got = append(got, string(msg.Data))
+			if len(got) == 2 {
+				cancel()
+			}
+		})
+		cancel()
+		if err != nil {
+			t.Fatalf("#%d: failed to receive, error=%v", i, err)
+		}
+		sort.Strings(got)
+		if expect := []string{"msg1", "msg2"}; !reflect.DeepEqual(got, expect) {
+			t.Errorf("#%d: want %v, got %v", i, expect, got)
+		}
+
+		subs, err := topic.Subscriptions(ctx)
+		if err != nil {
+			t.Fatalf("#%d: failed to list subscriptions, error=%v", i, err)
+		}
+		if len(subs) != 1 || subs[0].ID != "sub1" {
+			t.Errorf("#%d: want [sub1], got %v", i, subs)
+		}
+	}
+}
+
+func TestLocalClientConfig(t *testing.T) {
+	ctx := context.Background()
+	cli := setupLocalClient(t)
+	topic, err := cli.CreateTopic(ctx, "topic1")
+	if err != nil {
+		t.Fatalf("failed to create topic, error=%v", err)
+	}
+	sub, err := cli.CreateSubscription(ctx, "sub1", client.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatalf("failed to create subscription, error=%v", err)
+	}
+	if _, err := cli.CreateSnapshot(ctx, "snap1", client.SnapshotConfig{Subscription: sub}); err != nil {
+		t.Fatalf("failed to create snapshot, error=%v", err)
+	}
+
+	// the Topic and the Subscription of the config are usable on the client
+	cfg, err := sub.Config(ctx)
+	if err != nil {
+		t.Fatalf("failed to get subscription config, error=%v", err)
+	}
+	if ok, err := cfg.Topic.Exists(ctx); !ok || err != nil {
+		t.Errorf("want topic exists, got %v, error=%v", ok, err)
+	}
+	snapCfg, err := cli.Snapshot("snap1").Config(ctx)
+	if err != nil {
+		t.Fatalf("failed to get snapshot config, error=%v", err)
+	}
+	if ok, err := snapCfg.Topic.Exists(ctx); !ok || err != nil {
+		t.Errorf("want topic exists, got %v, error=%v", ok, err)
+	}
+	if ok, err := snapCfg.Subscription.Exists(ctx); !ok || err != nil {
+		t.Errorf("want subscription exists, got %v, error=%v", ok, err)
+	}
+}
@@ -4,37 +4,14 @@ import (
 	"bytes"
 	"encoding/gob"
 
-	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/datastore"
 )
 
-// globalMessage Global message key-value store object
-var globalMessage *DatastoreMessage
-
 // DatastoreMessage is adapter between actual datastore and datastore client
 type DatastoreMessage struct {
 	store datastore.Datastore
-}
-
-// NewDatastoreMessage create DatastoreTopic object
-func NewDatastoreMessage(cfg *datastore.Config) (*DatastoreMessage, error) {
-	d, err := datastore.LoadDatastore(cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to load datastore")
-	}
-	return &DatastoreMessage{
-		store: d,
-	}, nil
-}
-
-// InitDatastoreMessage initialize global datastore object
-func InitDatastoreMessage() error {
-	d, err := NewDatastoreMessage(datastore.GlobalConfig)
-	if err != nil {
-		return err
-	}
-	globalMessage = d
-	return nil
+	// parent is the Store of the loaded Message
+	parent *Store
 }
 
 // decodeRawMessage return Message from encode raw data
@@ -66,7 +43,12 @@ func (d *DatastoreMessage) Get(key string) (*Message, error) {
 	if v == nil {
 		return nil, ErrNotFoundEntry
 	}
-	return decodeRawMessage(v)
+	m, err := decodeRawMessage(v)
+	if err != nil {
+		return nil, err
+	}
+	m.store = d.parent
+	return m, nil
 }
 
 // Set save item to datastore
@@ -78,6 +60,16 @@ func (d *DatastoreMessage) Set(m *Message) error {
 	return d.store.Set(d.prefix(m.ID), v)
 }
 
+// SetBatch add saving item to the Batch
+func (d *DatastoreMessage) SetBatch(b datastore.Batch, m *Message) error {
+	v, err := datastore.EncodeGob(m)
+	if err != nil {
+		return err
+	}
+	b.Set(d.prefix(m.ID), v)
+	return nil
+}
+
 // Delete delete item
 func (d *DatastoreMessage) Delete(key string) error {
 	return d.store.Delete(d.prefix(key))
@@ -3,54 +3,24 @@ package models
 import (
 	"bytes"
 	"encoding/gob"
-	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/datastore"
 )
 
-// globalMessageStatus global subscription datastore
-var (
-	globalMessageStatus   *DatastoreMessageStatus
-	globalMessageStatusMu sync.RWMutex
+// the index names of the MessageStatus
+const (
+	// indexAckID map AckID to MessageStatus ID
+	indexAckID = "message_status_ack_id"
+	// indexSubscription hold MessageStatus IDs of the Subscription ordered by PublishOrder
+	indexSubscription = "message_status_subscription"
 )
 
-func getGlobalMessageStatus() *DatastoreMessageStatus {
-	globalMessageStatusMu.RLock()
-	defer globalMessageStatusMu.RUnlock()
-	return globalMessageStatus
-}
-
-func setGlobalMessageStatus(v *DatastoreMessageStatus) {
-	globalMessageStatusMu.Lock()
-	defer globalMessageStatusMu.Unlock()
-	globalMessageStatus = v
-}
-
 // DatastoreMessageStatus is adapter between actual datastore and datastore client
 type DatastoreMessageStatus struct {
 	store datastore.Datastore
-}
-
-// NewDatastoreMessageStatus create DatastoreTopic object
-func NewDatastoreMessageStatus(cfg *datastore.Config) (*DatastoreMessageStatus, error) {
-	d, err := datastore.LoadDatastore(cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to load datastore")
-	}
-	return &DatastoreMessageStatus{
-		store: d,
-	}, nil
-}
-
-// InitDatastoreMessageStatus initialize global datastore object
-func InitDatastoreMessageStatus() error {
-	d, err := NewDatastoreMessageStatus(datastore.GlobalConfig)
-	if err != nil {
-		return err
-	}
-	setGlobalMessageStatus(d)
-	return nil
+	// parent is the Store of the loaded MessageStatus
+	parent *Store
 }
 
 func decodeRawMessageStatus(r interface{}) (*MessageStatus, error) {
@@ -80,21 +50,44 @@ func (d *DatastoreMessageStatus) Get(key string) (*MessageStatus, error) {
 	if v == nil {
 		return nil, ErrNotFoundEntry
 	}
-	return decodeRawMessageStatus(v)
+	ms, err := decodeRawMessageStatus(v)
+	if err != nil {
+		return nil, err
+	}
+	ms.store = d.parent
+	return ms, nil
 }
 
 // FindBySubscriptionIDAndMessageID return MessageStatus matched MessageID
 func (d *DatastoreMessageStatus) FindBySubscriptionIDAndMessageID(subID, msgID string) (*MessageStatus, error) {
-	return d.chooseByField(func(ms *MessageStatus) bool {
-		return ms.SubscriptionID == subID && ms.MessageID == msgID
-	})
+	ms, err := d.Get(makeMessageStatusID(subID, msgID))
+	if errors.Cause(err) == datastore.ErrNotFoundEntry {
+		return nil, ErrNotFoundEntry
+	}
+	return ms, err
 }
 
 // FindByAckID return MessageStatus matched AckID
 func (d *DatastoreMessageStatus) FindByAckID(ackID string) (*MessageStatus, error) {
-	return d.chooseByField(func(ms *MessageStatus) bool {
-		return ms.AckID == ackID
-	})
+	id, err := d.store.GetUniqueIndex(indexAckID, ackID)
+	if err != nil {
+		if errors.Cause(err) == datastore.ErrNotFoundEntry {
+			return nil, ErrNotFoundEntry
+		}
+		return nil, err
+	}
+	ms, err := d.Get(id)
+	if errors.Cause(err) == datastore.ErrNotFoundEntry {
+		return nil, ErrNotFoundEntry
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the index is possibly stale when the AckID is renewed at the same time
+	if ms.AckID != ackID {
+		return nil, ErrNotFoundEntry
+	}
+	return ms, nil
 }
 
 // List return all MessageStatus slice
@@ -104,55 +97,135 @@ func (d *DatastoreMessageStatus) List() ([]*MessageStatus, error) {
 	})
 }
 
-// ListBySubscriptionID return all MessageStatus slice matched SubscriptionID
+// ListBySubscriptionID return all MessageStatus slice matched SubscriptionID in publish order
 func (d *DatastoreMessageStatus) ListBySubscriptionID(subID string) ([]*MessageStatus, error) {
-	return d.collectByField(func(ms *MessageStatus) bool {
-		return ms.SubscriptionID == subID
-	})
+	ids, err := d.rangeBySubscriptionID(subID)
+	if err != nil {
+		return nil, err
+	}
+	return d.CollectByIDs(ids...)
+}
+
+// rangeBySubscriptionID return MessageStatus IDs of the Subscription in publish order
+func (d *DatastoreMessageStatus) rangeBySubscriptionID(subID string) ([]string, error) {
+	return d.store.RangeSortedIndex(indexSubscription, subID)
 }
 
-// Set save item to datastore
+// Set save item and the index to datastore
 func (d *DatastoreMessageStatus) Set(ms *MessageStatus) error {
+	b := d.store.Batch()
+	if err := d.SetBatch(b, ms); err != nil {
+		return err
+	}
+	return b.Commit()
+}
+
+// SetBatch add saving item and the index to the Batch
+func (d *DatastoreMessageStatus) SetBatch(b datastore.Batch, ms *MessageStatus) error {
 	v, err := datastore.EncodeGob(ms)
 	if err != nil {
 		return err
 	}
-	return d.store.Set(d.prefix(ms.ID), v)
+	old, err := d.Get(ms.ID)
+	if err != nil && errors.Cause(err) != datastore.ErrNotFoundEntry {
+		return err
+	}
+	b.Set(d.prefix(ms.ID), d.row(ms, v))
+	if old != nil && old.AckID != "" && old.AckID != ms.AckID {
+		b.DeleteUniqueIndex(indexAckID, old.AckID)
+	}
+	d.addIndexBatch(b, ms)
+	return nil
 }
 
-// Delete delete item
+// Delete delete item and the index
 func (d *DatastoreMessageStatus) Delete(key string) error {
-	return d.store.Delete(d.prefix(key))
+	ms, err := d.Get(key)
+	if err != nil {
+		if errors.Cause(err) == datastore.ErrNotFoundEntry {
+			return nil
+		}
+		return err
+	}
+	b := d.store.Batch()
+	b.Delete(d.prefix(key))
+	if ms.AckID != "" {
+		b.DeleteUniqueIndex(indexAckID, ms.AckID)
+	}
+	b.RemoveSortedIndex(indexSubscription, ms.SubscriptionID, ms.ID)
+	return b.Commit()
 }
 
-// CollectByIDs returns all MessageStatus depends ids
+// CollectByIDs returns all MessageStatus depends ids, not exist ids are ignored
 func (d *DatastoreMessageStatus) CollectByIDs(ids ...string) ([]*MessageStatus, error) {
-	return d.collectByField(func(ms *MessageStatus) bool {
-		for _, id := range ids {
-			if ms.ID == id {
-				return true
+	res := make([]*MessageStatus, 0, len(ids))
+	for _, id := range ids {
+		ms, err := d.Get(id)
+		if err != nil {
+			if errors.Cause(err) == datastore.ErrNotFoundEntry {
+				continue
 			}
+			return nil, err
 		}
-		return false
-	})
+		res = append(res, ms)
+	}
+	return res, nil
 }
 
-// chooseByField choose any matched a MessageStatus
-func (d *DatastoreMessageStatus) chooseByField(fn func(ms *MessageStatus) bool) (*MessageStatus, error) {
-	sources, err := datastore.SpecifyDump(d.store, d.prefix(""))
+// locker return the Locker when the datastore is able to lock the MessageStatus between the server processes
+func (d *DatastoreMessageStatus) locker() (datastore.Locker, bool) {
+	l, ok := d.store.(datastore.Locker)
+	return l, ok
+}
+
+// RebuildIndex save all stored MessageStatus again with the columns and the index, for the entries saved before the index
+func (d *DatastoreMessageStatus) RebuildIndex() error {
+	list, err := d.List()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for _, v := range sources {
-		ms, err := decodeRawMessageStatus(v)
+	if len(list) == 0 {
+		return nil
+	}
+	b := d.store.Batch()
+	for _, ms := range list {
+		v, err := datastore.EncodeGob(ms)
 		if err != nil {
-			return nil, err
-		}
-		if fn(ms) {
-			return ms, nil
+			return err
 		}
+		b.Set(d.prefix(ms.ID), d.row(ms, v))
+		d.addIndexBatch(b, ms)
+	}
+	return b.Commit()
+}
+
+// row return the encoded MessageStatus with the searchable columns
+func (d *DatastoreMessageStatus) row(ms *MessageStatus, v []byte) *datastore.Row {
+	var deliveredAt interface{}
+	if !ms.DeliveredAt.IsZero() {
+		deliveredAt = ms.DeliveredAt
+	}
+	// visible_at is the time to be able to deliver, nil is never
+	var visibleAt interface{}
+	switch ms.AckState {
+	case stateWait:
+		visibleAt = ms.PublishedAt
+	case stateDeliver:
+		visibleAt = ms.DeliveredAt.Add(ms.AckDeadline + ms.RetryBackoff)
+	}
+	return &datastore.Row{
+		Value: v,
+		Columns: map[string]interface{}{
+			"subscription_id": ms.SubscriptionID,
+			"message_id":      ms.MessageID,
+			"ack_id":          ms.AckID,
+			"state":           int(ms.AckState),
+			"delivered_at":    deliveredAt,
+			"published_at":    ms.PublishedAt,
+			"publish_order":   ms.publishOrder(),
+			"visible_at":      visibleAt,
+		},
 	}
-	return nil, ErrNotFoundEntry
 }
 
 // collectByField collect any matched MessageStatus list
@@ -167,6 +240,7 @@ func (d *DatastoreMessageStatus) collectByField(fn func(ms *MessageStatus) bool)
 		if err != nil {
 			return nil, err
 		}
+		ms.store = d.parent
 		if fn(ms) {
 			res = append(res, ms)
 		}
@@ -174,6 +248,14 @@ func (d *DatastoreMessageStatus) collectByField(fn func(ms *MessageStatus) bool)
 	return res, nil
 }
 
+// addIndexBatch add the index of the MessageStatus to the Batch
+func (d *DatastoreMessageStatus) addIndexBatch(b datastore.Batch, ms *MessageStatus) {
+	if ms.AckID != "" {
+		b.SetUniqueIndex(indexAckID, ms.AckID, ms.ID)
+	}
+	b.AddSortedIndex(indexSubscription, ms.SubscriptionID, ms.ID, float64(ms.publishOrder()))
+}
+
 func (d *DatastoreMessageStatus) prefix(key string) string {
 	return "message_status_" + key
 }
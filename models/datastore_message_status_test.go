@@ -0,0 +1,93 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageStatusIndex(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+	setupSubscription(t, "b", "A")
+	first := publishMessage(t, "A", "first", nil)
+	time.Sleep(10 * time.Millisecond)
+	second := publishMessage(t, "A", "second", nil)
+
+	// redelivery renew the AckID
+	sub := mustGetSubscription(t, "a")
+	ms, err := sub.Message.Deliver(first, "ack-1", time.Second, nil)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if _, err := sub.Message.Deliver(first, "ack-2", time.Second, nil); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	cases := []struct {
+		input     string
+		expectID  string
+		expectErr error
+	}{
+		{"ack-1", "", ErrNotFoundEntry},
+		{"ack-2", ms.ID, nil},
+		{"unknown", "", ErrNotFoundEntry},
+	}
+	for i, c := range cases {
+		got, err := testStore.messageStatus.FindByAckID(c.input)
+		if err != c.expectErr {
+			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+		if got != nil && got.ID != c.expectID {
+			t.Errorf("#%d: want %s, got %s", i, c.expectID, got.ID)
+		}
+	}
+
+	// subscription index in publish order, and removed by ack
+	if err := sub.Message.Ack("ack-2"); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	listCases := []struct {
+		input  string
+		expect []string
+	}{
+		{"a", []string{second}},
+		{"b", []string{first, second}},
+	}
+	for i, c := range listCases {
+		list, err := testStore.messageStatus.ListBySubscriptionID(c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		got := []string{}
+		for _, ms := range list {
+			got = append(got, ms.MessageID)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestPublishOrderInSameMillisecond(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+	expect := []string{}
+	for i := 0; i < 50; i++ {
+		expect = append(expect, publishMessage(t, "A", "m", nil))
+	}
+
+	list, err := testStore.messageStatus.ListBySubscriptionID("a")
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	got := []string{}
+	for _, ms := range list {
+		got = append(got, ms.MessageID)
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("want %v, got %v", expect, got)
+	}
+}
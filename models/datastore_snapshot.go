@@ -0,0 +1,96 @@
+package models
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/takashabe/go-pubsub/datastore"
+)
+
+// DatastoreSnapshot is adapter between actual datastore and datastore client
+type DatastoreSnapshot struct {
+	store datastore.Datastore
+	// parent is the Store of the loaded Snapshot
+	parent *Store
+}
+
+func decodeRawSnapshot(r interface{}) (*Snapshot, error) {
+	switch a := r.(type) {
+	case []byte:
+		return decodeGobSnapshot(a)
+	default:
+		return nil, ErrNotMatchTypeSnapshot
+	}
+}
+
+func decodeGobSnapshot(e []byte) (*Snapshot, error) {
+	var res *Snapshot
+	buf := bytes.NewReader(e)
+	if err := gob.NewDecoder(buf).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Get return item via datastore
+func (d *DatastoreSnapshot) Get(key string) (*Snapshot, error) {
+	v, err := d.store.Get(d.prefix(key))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ErrNotFoundEntry
+	}
+	s, err := decodeRawSnapshot(v)
+	if err != nil {
+		return nil, err
+	}
+	s.store = d.parent
+	return s, nil
+}
+
+// List return all snapshot slice
+func (d *DatastoreSnapshot) List() ([]*Snapshot, error) {
+	sources, err := datastore.SpecifyDump(d.store, d.prefix(""))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Snapshot, 0, len(sources))
+	for _, v := range sources {
+		s, err := decodeRawSnapshot(v)
+		if err != nil {
+			return nil, err
+		}
+		s.store = d.parent
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// Set save item to datastore
+func (d *DatastoreSnapshot) Set(snapshot *Snapshot) error {
+	v, err := datastore.EncodeGob(snapshot)
+	if err != nil {
+		return err
+	}
+	return d.store.Set(d.prefix(snapshot.Name), v)
+}
+
+// SetBatch add saving item to the Batch
+func (d *DatastoreSnapshot) SetBatch(b datastore.Batch, snapshot *Snapshot) error {
+	v, err := datastore.EncodeGob(snapshot)
+	if err != nil {
+		return err
+	}
+	b.Set(d.prefix(snapshot.Name), v)
+	return nil
+}
+
+// Delete delete item
+func (d *DatastoreSnapshot) Delete(key string) error {
+	return d.store.Delete(d.prefix(key))
+}
+
+func (d *DatastoreSnapshot) prefix(key string) string {
+	return "snapshot_" + key
+}
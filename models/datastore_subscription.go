@@ -3,54 +3,16 @@ package models
 import (
 	"bytes"
 	"encoding/gob"
-	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/datastore"
 )
 
-// globalSubscription global subscription datastore
-var (
-	globalSubscription   *DatastoreSubscription
-	globalSubscriptionMu sync.RWMutex
-)
-
-func getGlobalSubscription() *DatastoreSubscription {
-	globalSubscriptionMu.RLock()
-	defer globalSubscriptionMu.RUnlock()
-	return globalSubscription
-}
-
-func setGlobalSubscription(v *DatastoreSubscription) {
-	globalSubscriptionMu.Lock()
-	defer globalSubscriptionMu.Unlock()
-	globalSubscription = v
-}
-
 // DatastoreSubscription is adapter between actual datastore and datastore client
 type DatastoreSubscription struct {
 	store datastore.Datastore
-}
-
-// NewDatastoreSubscription create DatastoreSubscription object
-func NewDatastoreSubscription(cfg *datastore.Config) (*DatastoreSubscription, error) {
-	d, err := datastore.LoadDatastore(cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to load datastore")
-	}
-	return &DatastoreSubscription{
-		store: d,
-	}, nil
-}
-
-// InitDatastoreSubscription initialize global datastore object
-func InitDatastoreSubscription() error {
-	d, err := NewDatastoreSubscription(datastore.GlobalConfig)
-	if err != nil {
-		return err
-	}
-	setGlobalSubscription(d)
-	return nil
+	// parent is the Store of the loaded Subscription
+	parent *Store
 }
 
 func decodeRawSubscription(r interface{}) (*Subscription, error) {
@@ -80,7 +42,17 @@ func (d *DatastoreSubscription) Get(key string) (*Subscription, error) {
 	if v == nil {
 		return nil, ErrNotFoundEntry
 	}
-	return decodeRawSubscription(v)
+	return d.decode(v)
+}
+
+// decode return Subscription belong to the Store
+func (d *DatastoreSubscription) decode(v interface{}) (*Subscription, error) {
+	s, err := decodeRawSubscription(v)
+	if err != nil {
+		return nil, err
+	}
+	s.setStore(d.parent)
+	return s, nil
 }
 
 // CollectByTopicID returns all Subscription depends topic ids
@@ -104,7 +76,7 @@ func (d *DatastoreSubscription) chooseByField(fn func(ms *Subscription) bool) (*
 		return nil, err
 	}
 	for _, v := range sources {
-		ms, err := decodeRawSubscription(v)
+		ms, err := d.decode(v)
 		if err != nil {
 			return nil, err
 		}
@@ -123,7 +95,7 @@ func (d *DatastoreSubscription) collectByField(fn func(ms *Subscription) bool) (
 	}
 	res := make([]*Subscription, 0, len(sources))
 	for _, v := range sources {
-		ms, err := decodeRawSubscription(v)
+		ms, err := d.decode(v)
 		if err != nil {
 			return nil, err
 		}
@@ -140,7 +112,27 @@ func (d *DatastoreSubscription) Set(sub *Subscription) error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to encode gob")
 	}
-	return d.store.Set(d.prefix(sub.Name), v)
+	return d.store.Set(d.prefix(sub.Name), d.row(sub, v))
+}
+
+// SetBatch add saving item to the Batch
+func (d *DatastoreSubscription) SetBatch(b datastore.Batch, sub *Subscription) error {
+	v, err := datastore.EncodeGob(sub)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode gob")
+	}
+	b.Set(d.prefix(sub.Name), d.row(sub, v))
+	return nil
+}
+
+// row return the encoded Subscription with the searchable columns
+func (d *DatastoreSubscription) row(sub *Subscription, v []byte) *datastore.Row {
+	return &datastore.Row{
+		Value: v,
+		Columns: map[string]interface{}{
+			"topic_id": sub.TopicID,
+		},
+	}
 }
 
 // Delete delete item
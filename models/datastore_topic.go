@@ -4,37 +4,14 @@ import (
 	"bytes"
 	"encoding/gob"
 
-	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/datastore"
 )
 
-// globalTopics global Topic datastore
-var globalTopics *DatastoreTopic
-
 // DatastoreTopic is adapter between actual datastore and datastore client
 type DatastoreTopic struct {
 	store datastore.Datastore
-}
-
-// NewDatastoreTopic create DatastoreTopic object
-func NewDatastoreTopic(cfg *datastore.Config) (*DatastoreTopic, error) {
-	d, err := datastore.LoadDatastore(cfg)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to load datastore")
-	}
-	return &DatastoreTopic{
-		store: d,
-	}, nil
-}
-
-// InitDatastoreTopic initialize global datastore object
-func InitDatastoreTopic() error {
-	d, err := NewDatastoreTopic(datastore.GlobalConfig)
-	if err != nil {
-		return err
-	}
-	globalTopics = d
-	return nil
+	// parent is the Store of the loaded Topic
+	parent *Store
 }
 
 func decodeRawTopic(r interface{}) (*Topic, error) {
@@ -64,7 +41,12 @@ func (d *DatastoreTopic) Get(key string) (*Topic, error) {
 	if v == nil {
 		return nil, ErrNotFoundEntry
 	}
-	return decodeRawTopic(v)
+	t, err := decodeRawTopic(v)
+	if err != nil {
+		return nil, err
+	}
+	t.store = d.parent
+	return t, nil
 }
 
 // List return all topic slice
@@ -79,6 +61,7 @@ func (d *DatastoreTopic) List() ([]*Topic, error) {
 		if err != nil {
 			return nil, err
 		}
+		t.store = d.parent
 		res = append(res, t)
 	}
 	return res, nil
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// attribute keys of the delivery metadata added to the dead letter message
+const (
+	AttrDeadLetterSourceSubscription = "dead_letter_source_subscription"
+	AttrDeadLetterSourceMessageID    = "dead_letter_source_message_id"
+	AttrDeadLetterDeliveryAttempt    = "dead_letter_delivery_attempt"
+)
+
+// DeadLetterPolicy is represent forwarding the undeliverable message in Subscription
+type DeadLetterPolicy struct {
+	DeadLetterTopic     string
+	MaxDeliveryAttempts int
+}
+
+// NewDeadLetterPolicy return initialized DeadLetterPolicy, if exist the dead letter topic
+func (st *Store) NewDeadLetterPolicy(topicName string, maxAttempts int) (*DeadLetterPolicy, error) {
+	if maxAttempts <= 0 {
+		return nil, ErrInvalidDeliveryAttempts
+	}
+	if _, err := st.GetTopic(topicName); err != nil {
+		return nil, errors.Wrapf(err, "failed to get dead letter topic, name=%s", topicName)
+	}
+	return &DeadLetterPolicy{
+		DeadLetterTopic:     topicName,
+		MaxDeliveryAttempts: maxAttempts,
+	}, nil
+}
+
+// SetDeadLetterPolicy setting dead letter policy, nil is disable dead letter
+func (s *Subscription) SetDeadLetterPolicy(p *DeadLetterPolicy) error {
+	if err := s.store.supportStream(p != nil); err != nil {
+		return err
+	}
+	s.DeadLetterPolicy = p
+	return s.Save()
+}
+
+// exceededDeliveryAttempts return whether the message should be forwarded to the dead letter topic
+func (s *Subscription) exceededDeliveryAttempts(ms *MessageStatus) bool {
+	if s.DeadLetterPolicy == nil {
+		return false
+	}
+	return ms.DeliveryAttempt > s.DeadLetterPolicy.MaxDeliveryAttempts
+}
+
+// forwardDeadLetter publish the message to the dead letter topic, and ack the message
+func (s *Subscription) forwardDeadLetter(msg *Message, ms *MessageStatus) error {
+	topic, err := s.store.GetTopic(s.DeadLetterPolicy.DeadLetterTopic)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get dead letter topic, name=%s", s.DeadLetterPolicy.DeadLetterTopic)
+	}
+
+	attr := make(map[string]string, len(msg.Attributes)+3)
+	for k, v := range msg.Attributes {
+		attr[k] = v
+	}
+	attr[AttrDeadLetterSourceSubscription] = s.Name
+	attr[AttrDeadLetterSourceMessageID] = msg.ID
+	// count excluding the current delivery, it is not delivered to the subscriber
+	attr[AttrDeadLetterDeliveryAttempt] = strconv.Itoa(ms.DeliveryAttempt - 1)
+	if _, err := topic.Publish(msg.Data, attr); err != nil {
+		return errors.Wrap(err, "failed to publish dead letter message")
+	}
+	return s.ack(ms.AckID)
+}
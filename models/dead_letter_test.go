@@ -0,0 +1,115 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewDeadLetterPolicy(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+
+	cases := []struct {
+		inputTopic  string
+		inputMax    int
+		expectError bool
+	}{
+		{"B", 5, false},
+		{"B", 0, true},
+		{"Z", 5, true},
+	}
+	for i, c := range cases {
+		_, err := testStore.NewDeadLetterPolicy(c.inputTopic, c.inputMax)
+		if got := err != nil; got != c.expectError {
+			t.Errorf("#%d: want error %t, got %v", i, c.expectError, err)
+		}
+	}
+}
+
+func TestPullForwardDeadLetter(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+	setupSubscription(t, "dead", "B")
+
+	p, err := testStore.NewDeadLetterPolicy("B", 2)
+	if err != nil {
+		t.Fatalf("failed to create DeadLetterPolicy, got err %v", err)
+	}
+	if err := mustGetSubscription(t, "a").SetDeadLetterPolicy(p); err != nil {
+		t.Fatalf("failed to set DeadLetterPolicy, got err %v", err)
+	}
+	msgID := publishMessage(t, "A", "test", map[string]string{"key": "value"})
+
+	// nack until max delivery attempts
+	sub := mustGetSubscription(t, "a")
+	for i := 1; i <= 2; i++ {
+		msgs, err := sub.Pull(1)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got := msgs[0].DeliveryAttempt; got != i {
+			t.Errorf("#%d: want delivery attempt %d, got %d", i, i, got)
+		}
+		if err := sub.ModifyAckDeadline(msgs[0].AckID, 0); err != nil {
+			t.Fatalf("#%d: failed to nack, got err %v", i, err)
+		}
+	}
+	if _, err := sub.Pull(1); err != ErrEmptyMessage {
+		t.Errorf("want %v, got %v", ErrEmptyMessage, err)
+	}
+
+	// forwarded message
+	msgs, err := mustGetSubscription(t, "dead").Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	expectAttr := map[string]string{
+		"key":                            "value",
+		AttrDeadLetterSourceSubscription: "a",
+		AttrDeadLetterSourceMessageID:    msgID,
+		AttrDeadLetterDeliveryAttempt:    "2",
+	}
+	if got := msgs[0].Message.Attributes; !reflect.DeepEqual(got, expectAttr) {
+		t.Errorf("want attributes %v, got %v", expectAttr, got)
+	}
+	if got := string(msgs[0].Message.Data); got != "test" {
+		t.Errorf("want data %s, got %s", "test", got)
+	}
+}
+
+func TestPullDeletedDeadLetterTopic(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+
+	p, err := testStore.NewDeadLetterPolicy("B", 1)
+	if err != nil {
+		t.Fatalf("failed to create DeadLetterPolicy, got err %v", err)
+	}
+	if err := mustGetSubscription(t, "a").SetDeadLetterPolicy(p); err != nil {
+		t.Fatalf("failed to set DeadLetterPolicy, got err %v", err)
+	}
+	msgID := publishMessage(t, "A", "test", nil)
+	if err := mustGetTopic(t, "B").Delete(false); err != nil {
+		t.Fatalf("failed to delete topic, got err %v", err)
+	}
+
+	// redelivered as usual while unable to forward
+	sub := mustGetSubscription(t, "a")
+	for i := 1; i <= 3; i++ {
+		msgs, err := sub.Pull(1)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got := msgs[0].Message.ID; got != msgID {
+			t.Errorf("#%d: want message %s, got %s", i, msgID, got)
+		}
+		if got := msgs[0].DeliveryAttempt; got != i {
+			t.Errorf("#%d: want delivery attempt %d, got %d", i, i, got)
+		}
+		if err := sub.ModifyAckDeadline(msgs[0].AckID, 0); err != nil {
+			t.Fatalf("#%d: failed to nack, got err %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DeletedTopicID is TopicID of the Subscription detached from the Topic
+const DeletedTopicID = "_deleted-topic_"
+
+// Detached return whether the Subscription is detached from the Topic
+func (s *Subscription) Detached() bool {
+	return s.TopicID == DeletedTopicID
+}
+
+// Detach detach the Subscription from the Topic, the Subscription no longer receive published messages.
+// when purge is true, the pending messages are deleted, otherwise remain pullable.
+func (s *Subscription) Detach(purge bool) error {
+	unlock := s.lockDelivery()
+	defer unlock()
+
+	if s.store.stream != nil && !s.Detached() {
+		// the pending messages of the consumer group are not kept
+		if err := s.store.stream.DestroyGroup(streamName(s.TopicID), s.Name); err != nil {
+			return errors.Wrapf(err, "failed to destroy consumer group, SubscriptionID=%s", s.Name)
+		}
+	}
+	s.TopicID = DeletedTopicID
+	if purge {
+		if err := s.purgeMessages(); err != nil {
+			return err
+		}
+	}
+	if err := s.Save(); err != nil {
+		return errors.Wrapf(err, "failed to save subscription, SubscriptionID=%s", s.Name)
+	}
+	s.sendCurrentMessages()
+	return nil
+}
+
+// purgeMessages delete all MessageStatus of the Subscription,
+// and delete Message no longer referenced from any Subscription
+func (s *Subscription) purgeMessages() error {
+	list, err := s.store.messageStatus.ListBySubscriptionID(s.Name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to collect message status, SubscriptionID=%s", s.Name)
+	}
+	for _, ms := range list {
+		if err := expireMessageStatus(ms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete delete topic object at the Store, and detach the depended Subscriptions.
+// when purge is true, the pending messages of the Subscriptions are deleted.
+func (t *Topic) Delete(purge bool) error {
+	subs, err := t.GetSubscriptions()
+	if err != nil {
+		return errors.Wrap(err, "failed GetSubscriptions")
+	}
+	for _, s := range subs {
+		if err := s.Detach(purge); err != nil {
+			return err
+		}
+	}
+	if t.store.stream != nil {
+		// the detached Subscriptions no longer read the stream
+		if err := t.store.stream.DeleteStream(streamName(t.Name)); err != nil {
+			return errors.Wrapf(err, "failed to delete stream, TopicID=%s", t.Name)
+		}
+	}
+	return t.store.topics.Delete(t.Name)
+}
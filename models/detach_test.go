@@ -0,0 +1,50 @@
+package models
+
+import "testing"
+
+func TestDeleteTopic(t *testing.T) {
+	cases := []struct {
+		purge          bool
+		expectPullable bool
+	}{
+		{false, true},
+		{true, false},
+	}
+	for i, c := range cases {
+		setupDatastore(t)
+		setupDummyTopics(t)
+		setupSubscription(t, "a", "A")
+		msgID := publishMessage(t, "A", "pending", nil)
+
+		if err := mustGetTopic(t, "A").Delete(c.purge); err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if _, err := testStore.GetTopic("A"); err == nil {
+			t.Errorf("#%d: want deleted topic", i)
+		}
+		sub := mustGetSubscription(t, "a")
+		if !sub.Detached() {
+			t.Errorf("#%d: want detached, got topic %s", i, sub.TopicID)
+		}
+
+		// detached subscription no longer receive the message of the same name topic
+		if _, err := testStore.NewTopic("A"); err != nil {
+			t.Fatalf("#%d: failed to create topic, got err %v", i, err)
+		}
+		publishMessage(t, "A", "after", nil)
+
+		msgs, err := sub.Pull(2)
+		if got := err == nil; got != c.expectPullable {
+			t.Fatalf("#%d: want pullable %t, got err %v", i, c.expectPullable, err)
+		}
+		if c.expectPullable {
+			if len(msgs) != 1 || msgs[0].Message.ID != msgID {
+				t.Errorf("#%d: want only pending message, got %v", i, msgs)
+			}
+			continue
+		}
+		if _, err := testStore.messages.Get(msgID); err == nil {
+			t.Errorf("#%d: want purged message", i)
+		}
+	}
+}
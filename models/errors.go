@@ -4,14 +4,29 @@ import "github.com/pkg/errors"
 
 // topic errors
 var (
-	ErrAlreadyExistTopic = errors.New("already exist topic")
+	ErrAlreadyExistTopic        = errors.New("already exist topic")
+	ErrReservedTopicName        = errors.New("reserved topic name")
+	ErrInvalidRetentionDuration = errors.New("invalid message retention duration")
 )
 
 // subscription errors
 var (
 	ErrAlreadyExistSubscription = errors.New("already exist subscription")
 	ErrNotFoundAckID            = errors.New("not found message dependent to ack id")
+	ErrExpiredAckID             = errors.New("expired ack id")
 	ErrInvalidEndpoint          = errors.New("invalid endpoint URL format")
+	ErrInvalidDeliveryAttempts  = errors.New("invalid max delivery attempts")
+	ErrInvalidRetryPolicy       = errors.New("invalid retry policy backoff")
+	ErrInvalidFilter            = errors.New("invalid filter expression")
+	ErrInvalidExpirationPolicy  = errors.New("invalid expiration policy ttl")
+	ErrNotSupportStreamPush     = errors.New("push is not supported by the stream datastore")
+	ErrNotSupportStream         = errors.New("dead letter, retry, ordering, exactly once, retention, seek and snapshot are not supported by the stream datastore")
+)
+
+// snapshot errors
+var (
+	ErrAlreadyExistSnapshot = errors.New("already exist snapshot")
+	ErrMismatchSnapshot     = errors.New("snapshot topic does not match subscription topic")
 )
 
 // message errors
@@ -29,6 +44,7 @@ var (
 	ErrNotMatchTypeMessageStatus = errors.New("not match type message status")
 	ErrNotMatchTypeSubscription  = errors.New("not match type subscription")
 	ErrNotMatchTypeTopic         = errors.New("not match type topic")
+	ErrNotMatchTypeSnapshot      = errors.New("not match type snapshot")
 	ErrNotSupportOperation       = errors.New("not support operation")
 	ErrNotSupportDriver          = errors.New("not support driver")
 )
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// ExactlyOnceAckDeadline is the ack deadline of the exactly once delivery Subscription without the ack deadline,
+// the AckID is invalidated at the ack deadline, so 0 never accept the ack
+const ExactlyOnceAckDeadline = 10 * time.Second
+
+// subscriptionLocks is holds mutex for each Subscription,
+// the mutex is in the process and does not exclude the other servers sharing the datastore
+type subscriptionLocks struct {
+	locks map[string]*sync.Mutex
+	mu    sync.Mutex
+}
+
+func newSubscriptionLocks() *subscriptionLocks {
+	return &subscriptionLocks{
+		locks: make(map[string]*sync.Mutex),
+	}
+}
+
+// get return mutex of the Subscription
+func (l *subscriptionLocks) get(subID string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	m, ok := l.locks[subID]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[subID] = m
+	}
+	return m
+}
+
+// AckResult represent result of the ack for each AckID
+type AckResult struct {
+	AckID string
+	Err   error
+}
+
+// SetExactlyOnceDelivery setting exactly once delivery.
+// in the exactly once delivery, AckID is invalidated when exceeded the ack deadline or redelivered,
+// and the message is never redelivered after the successful ack.
+// the delivery and the ack are serialized only in the process, exactly once is guaranteed only with a single server.
+func (s *Subscription) SetExactlyOnceDelivery(enable bool) error {
+	if err := s.store.supportStream(enable); err != nil {
+		return err
+	}
+	s.EnableExactlyOnceDelivery = enable
+	s.applyExactlyOnceAckDeadline()
+	return s.Save()
+}
+
+// applyExactlyOnceAckDeadline set ExactlyOnceAckDeadline when the exactly once delivery without the ack deadline
+func (s *Subscription) applyExactlyOnceAckDeadline() {
+	if s.EnableExactlyOnceDelivery && s.DefaultAckDeadline <= 0 {
+		s.DefaultAckDeadline = ExactlyOnceAckDeadline
+	}
+}
+
+// lockDelivery lock the delivery state of the Subscription when enabled exactly once delivery,
+// and return the unlock function
+func (s *Subscription) lockDelivery() func() {
+	if !s.EnableExactlyOnceDelivery {
+		return func() {}
+	}
+	m := s.store.exactlyOnceLocks.get(s.Name)
+	m.Lock()
+	return m.Unlock
+}
+
+// validateAckID return whether the AckID is still valid in the exactly once delivery
+func (s *Subscription) validateAckID(id string) error {
+	ms, err := s.Message.FindByAckID(id)
+	if err != nil || ms.SubscriptionID != s.Name {
+		return ErrNotFoundAckID
+	}
+	if ms.AckState != stateDeliver || ms.Readable() {
+		return ErrExpiredAckID
+	}
+	return nil
+}
+
+// ConfirmAck ack the messages, and return the result for each AckID
+func (s *Subscription) ConfirmAck(ids ...string) []*AckResult {
+	unlock := s.lockDelivery()
+	defer unlock()
+
+	results := make([]*AckResult, 0, len(ids))
+	for _, id := range ids {
+		results = append(results, &AckResult{AckID: id, Err: s.ack(id)})
+	}
+	s.sendCurrentMessages()
+	return results
+}
+
+// ack require locked delivery
+func (s *Subscription) ack(id string) error {
+	if s.EnableExactlyOnceDelivery {
+		if err := s.validateAckID(id); err != nil {
+			return err
+		}
+	}
+	if s.RetainAckedMessages {
+		return s.Message.RetainAck(id)
+	}
+	return s.Message.Ack(id)
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfirmAck(t *testing.T) {
+	cases := []struct {
+		exactlyOnce       bool
+		expectExpiredAck  error
+		expectRedelivered bool
+	}{
+		{false, nil, false},
+		{true, ErrExpiredAckID, true},
+	}
+	for i, c := range cases {
+		setupDatastore(t)
+		setupDummyTopics(t)
+		sub := setupSubscription(t, "a", "A")
+		sub.DefaultAckDeadline = 50 * time.Millisecond
+		if err := sub.SetExactlyOnceDelivery(c.exactlyOnce); err != nil {
+			t.Fatalf("#%d: failed to set exactly once delivery, got err %v", i, err)
+		}
+		publishMessage(t, "A", "test", nil)
+
+		// ack after the ack deadline
+		sub = mustGetSubscription(t, "a")
+		msgs, err := sub.Pull(1)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		results := sub.ConfirmAck(msgs[0].AckID)
+		if got := results[0].Err; got != c.expectExpiredAck {
+			t.Errorf("#%d: want %v, got %v", i, c.expectExpiredAck, got)
+		}
+
+		_, err = sub.Pull(1)
+		if got := err == nil; got != c.expectRedelivered {
+			t.Fatalf("#%d: want redelivered %t, got err %v", i, c.expectRedelivered, err)
+		}
+	}
+}
+
+func TestConfirmAckRedelivered(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	if err := setupSubscription(t, "a", "A").SetExactlyOnceDelivery(true); err != nil {
+		t.Fatalf("failed to set exactly once delivery, got err %v", err)
+	}
+	publishMessage(t, "A", "test", nil)
+
+	sub := mustGetSubscription(t, "a")
+	first, err := sub.Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := sub.ModifyAckDeadline(first[0].AckID, 0); err != nil {
+		t.Fatalf("failed to nack, got err %v", err)
+	}
+	second, err := sub.Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	cases := []struct {
+		input  string
+		expect error
+	}{
+		{first[0].AckID, ErrNotFoundAckID},
+		{second[0].AckID, nil},
+		{second[0].AckID, ErrNotFoundAckID},
+	}
+	for i, c := range cases {
+		results := sub.ConfirmAck(c.input)
+		if got := results[0].Err; got != c.expect {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+	if _, err := sub.Pull(1); err != ErrEmptyMessage {
+		t.Errorf("want %v, got %v", ErrEmptyMessage, err)
+	}
+}
+
+func TestConfirmAckWithoutAckDeadline(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	sub, err := testStore.NewSubscriptionWithOptions("a", "A", SubscriptionOptions{EnableExactlyOnceDelivery: true})
+	if err != nil {
+		t.Fatalf("failed to create subscription, got err %v", err)
+	}
+	if sub.DefaultAckDeadline != ExactlyOnceAckDeadline {
+		t.Errorf("want ack deadline %v, got %v", ExactlyOnceAckDeadline, sub.DefaultAckDeadline)
+	}
+	publishMessage(t, "A", "test", nil)
+
+	msgs, err := sub.Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	results := sub.ConfirmAck(msgs[0].AckID)
+	if got := results[0].Err; got != nil {
+		t.Errorf("want no error, got %v", got)
+	}
+	if _, err := sub.Pull(1); err != ErrEmptyMessage {
+		t.Errorf("want %v, got %v", ErrEmptyMessage, err)
+	}
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ExpirationPolicy is represent the Subscription deleted after a period with no activity
+type ExpirationPolicy struct {
+	TTL time.Duration
+}
+
+// NewExpirationPolicy return initialized ExpirationPolicy
+func NewExpirationPolicy(ttl time.Duration) (*ExpirationPolicy, error) {
+	if ttl <= 0 {
+		return nil, ErrInvalidExpirationPolicy
+	}
+	return &ExpirationPolicy{
+		TTL: ttl,
+	}, nil
+}
+
+// SetExpirationPolicy setting expiration policy, nil is never expire.
+// the TTL is counted from now when no activity yet.
+func (s *Subscription) SetExpirationPolicy(p *ExpirationPolicy) error {
+	s.ExpirationPolicy = p
+	if s.LastActivityAt.IsZero() {
+		s.LastActivityAt = time.Now()
+	}
+	return s.Save()
+}
+
+// touchInterval return the interval of saving the activity, the activities within it are not saved
+func (p *ExpirationPolicy) touchInterval() time.Duration {
+	return p.TTL / 10
+}
+
+// Expired return whether the Subscription exceeded the TTL since the last activity,
+// allow the activity not saved within the touch interval
+func (s *Subscription) Expired(now time.Time) bool {
+	if s.ExpirationPolicy == nil || s.LastActivityAt.IsZero() {
+		return false
+	}
+	return now.Sub(s.LastActivityAt) > s.ExpirationPolicy.TTL+s.ExpirationPolicy.touchInterval()
+}
+
+// touch record the pull, ack or modify ack deadline activity when the ExpirationPolicy is set,
+// at most once per the touch interval.
+// save to the latest Subscription not to overwrite the other changes meanwhile
+func (s *Subscription) touch() {
+	if s.ExpirationPolicy == nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(s.LastActivityAt) < s.ExpirationPolicy.touchInterval() {
+		return
+	}
+	s.LastActivityAt = now
+	latest, err := s.store.GetSubscription(s.Name)
+	if err != nil {
+		log.Printf("failed to get subscription, SubscriptionID=%s, error=%v", s.Name, err)
+		return
+	}
+	latest.LastActivityAt = now
+	if err := latest.Save(); err != nil {
+		log.Printf("failed to save subscription, SubscriptionID=%s, error=%v", s.Name, err)
+	}
+}
+
+// SweepExpiredSubscriptions delete Subscription exceeded the TTL of the ExpirationPolicy and its MessageStatus,
+// and return number of the deleted Subscription
+func (st *Store) SweepExpiredSubscriptions(now time.Time) (int, error) {
+	subs, err := st.ListSubscription()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list subscription")
+	}
+	deleted := 0
+	for _, s := range subs {
+		if !s.Expired(now) {
+			continue
+		}
+		// the activity is possibly recorded after the list
+		s, err := st.GetSubscription(s.Name)
+		if err != nil || !s.Expired(now) {
+			continue
+		}
+		if err := s.expire(); err != nil {
+			return deleted, err
+		}
+		st.stats.GetSubscriptionAdapter().AddSubscription(s.Name, -1)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// expire delete the Subscription and its MessageStatus
+func (s *Subscription) expire() error {
+	if err := s.Delete(); err != nil {
+		return errors.Wrapf(err, "failed to delete subscription, SubscriptionID=%s", s.Name)
+	}
+	list, err := s.Message.CollectAllMessages()
+	if err != nil {
+		return errors.Wrapf(err, "failed to collect message status, SubscriptionID=%s", s.Name)
+	}
+	for _, ms := range list {
+		if err := expireMessageStatus(ms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewExpirationPolicy(t *testing.T) {
+	cases := []struct {
+		input     time.Duration
+		expectErr error
+	}{
+		{time.Hour, nil},
+		{0, ErrInvalidExpirationPolicy},
+		{-1, ErrInvalidExpirationPolicy},
+	}
+	for i, c := range cases {
+		_, err := NewExpirationPolicy(c.input)
+		if err != c.expectErr {
+			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+	}
+}
+
+func TestSweepExpiredSubscriptions(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	p, err := NewExpirationPolicy(100 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to create expiration policy, got err %v", err)
+	}
+	if err := setupSubscription(t, "idle", "A").SetExpirationPolicy(p); err != nil {
+		t.Fatalf("failed to set expiration policy, got err %v", err)
+	}
+	if err := setupSubscription(t, "active", "A").SetExpirationPolicy(p); err != nil {
+		t.Fatalf("failed to set expiration policy, got err %v", err)
+	}
+	setupSubscription(t, "unlimited", "A")
+	msgID := publishMessage(t, "A", "test", nil)
+
+	// pull is the activity, saved after the touch interval
+	active := mustGetSubscription(t, "active")
+	time.Sleep(20 * time.Millisecond)
+	if _, err := active.Pull(1); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	idleAt := mustGetSubscription(t, "idle").LastActivityAt
+	activeAt := mustGetSubscription(t, "active").LastActivityAt
+	if !activeAt.After(idleAt) {
+		t.Fatalf("want last activity updated, got %v", activeAt)
+	}
+
+	cases := []struct {
+		input         time.Time
+		expectDeleted int
+		expectRemain  int
+	}{
+		{idleAt.Add(50 * time.Millisecond), 0, 3},
+		// allow the touch interval
+		{idleAt.Add(105 * time.Millisecond), 0, 3},
+		{idleAt.Add(111 * time.Millisecond), 1, 2},
+		{activeAt.Add(time.Second), 1, 1},
+	}
+	for i, c := range cases {
+		got, err := testStore.SweepExpiredSubscriptions(c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got != c.expectDeleted {
+			t.Errorf("#%d: want deleted %d, got %d", i, c.expectDeleted, got)
+		}
+		subs, err := testStore.ListSubscription()
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if len(subs) != c.expectRemain {
+			t.Errorf("#%d: want remain %d, got %d", i, c.expectRemain, len(subs))
+		}
+	}
+
+	// message status of the expired subscription is also deleted
+	list, err := testStore.messageStatus.List()
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if len(list) != 1 || list[0].SubscriptionID != "unlimited" {
+		t.Errorf("want only unlimited subscription status, got %v", list)
+	}
+	m, err := testStore.messages.Get(msgID)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if len(m.SubscribeIDs) != 1 {
+		t.Errorf("want subscriptions [unlimited], got %v", m.SubscribeIDs)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "unlimited", "A")
+	p, err := NewExpirationPolicy(time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create expiration policy, got err %v", err)
+	}
+	if err := setupSubscription(t, "expiring", "A").SetExpirationPolicy(p); err != nil {
+		t.Fatalf("failed to set expiration policy, got err %v", err)
+	}
+
+	cases := []struct {
+		subID  string
+		expect time.Time
+	}{
+		// not saved without the policy
+		{"unlimited", time.Time{}},
+		// not saved within the touch interval
+		{"expiring", mustGetSubscription(t, "expiring").LastActivityAt},
+	}
+	for i, c := range cases {
+		publishMessage(t, "A", "test", nil)
+		if _, err := mustGetSubscription(t, c.subID).Pull(1); err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got := mustGetSubscription(t, c.subID).LastActivityAt; !got.Equal(c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter is parsed filter expression of the Subscription.
+//
+// supported syntax:
+//
+//	attributes.key = "value"
+//	attributes.key != "value"
+//	attributes:key
+//	hasPrefix(attributes.key, "prefix")
+//	NOT expr, expr AND expr, expr OR expr, (expr)
+type Filter struct {
+	Expression string
+	root       filterNode
+}
+
+// ParseFilter return parsed Filter, empty expression is match all messages
+func ParseFilter(expr string) (*Filter, error) {
+	f := &Filter{Expression: expr}
+	if strings.TrimSpace(expr) == "" {
+		return f, nil
+	}
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, errors.Wrapf(ErrInvalidFilter, "unexpected %q at %d", t.value, t.pos)
+	}
+	f.root = root
+	return f, nil
+}
+
+// Match return whether the attributes matched the filter
+func (f *Filter) Match(attr map[string]string) bool {
+	if f == nil || f.root == nil {
+		return true
+	}
+	return f.root.match(attr)
+}
+
+// filterNode is node of the filter expression tree
+type filterNode interface {
+	match(attr map[string]string) bool
+}
+
+type filterAnd struct {
+	left, right filterNode
+}
+
+func (n *filterAnd) match(attr map[string]string) bool {
+	return n.left.match(attr) && n.right.match(attr)
+}
+
+type filterOr struct {
+	left, right filterNode
+}
+
+func (n *filterOr) match(attr map[string]string) bool {
+	return n.left.match(attr) || n.right.match(attr)
+}
+
+type filterNot struct {
+	node filterNode
+}
+
+func (n *filterNot) match(attr map[string]string) bool {
+	return !n.node.match(attr)
+}
+
+type filterEqual struct {
+	key, value string
+}
+
+func (n *filterEqual) match(attr map[string]string) bool {
+	v, ok := attr[n.key]
+	return ok && v == n.value
+}
+
+type filterHas struct {
+	key string
+}
+
+func (n *filterHas) match(attr map[string]string) bool {
+	_, ok := attr[n.key]
+	return ok
+}
+
+type filterHasPrefix struct {
+	key, prefix string
+}
+
+func (n *filterHasPrefix) match(attr map[string]string) bool {
+	v, ok := attr[n.key]
+	return ok && strings.HasPrefix(v, n.prefix)
+}
+
+// tokenKind is kind of the filter token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenSymbol
+)
+
+type filterToken struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// tokenizeFilter split the filter expression into tokens
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '!' && i+1 < len(expr) && expr[i+1] == '=':
+			tokens = append(tokens, filterToken{kind: tokenSymbol, value: "!=", pos: i})
+			i += 2
+		case strings.IndexByte("()=,:", c) >= 0:
+			tokens = append(tokens, filterToken{kind: tokenSymbol, value: string(c), pos: i})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != '"'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, errors.Wrapf(ErrInvalidFilter, "unterminated string at %d", i)
+			}
+			v, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, errors.Wrapf(ErrInvalidFilter, "invalid string at %d", i)
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, value: v, pos: i})
+			i = end + 1
+		case isFilterIdentChar(c):
+			end := i
+			for end < len(expr) && isFilterIdentChar(expr[end]) {
+				end++
+			}
+			tokens = append(tokens, filterToken{kind: tokenIdent, value: expr[i:end], pos: i})
+			i = end
+		default:
+			return nil, errors.Wrapf(ErrInvalidFilter, "unexpected character %q at %d", c, i)
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEOF, pos: len(expr)}), nil
+}
+
+func isFilterIdentChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-' || c == '.'
+}
+
+// filterParser is recursive descent parser for the filter expression
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *filterParser) expect(kind tokenKind, value string) (filterToken, error) {
+	t := p.next()
+	if t.kind != kind || (value != "" && t.value != value) {
+		return t, errors.Wrapf(ErrInvalidFilter, "unexpected %q at %d", t.value, t.pos)
+	}
+	return t, nil
+}
+
+func (p *filterParser) isKeyword(value string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && t.value == value
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("AND") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.isKeyword("NOT") {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{node: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokenSymbol && t.value == "(":
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenSymbol, ")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+
+	case t.kind == tokenIdent && t.value == "hasPrefix":
+		if _, err := p.expect(tokenSymbol, "("); err != nil {
+			return nil, err
+		}
+		key, err := p.parseAttributeKey()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenSymbol, ","); err != nil {
+			return nil, err
+		}
+		prefix, err := p.expect(tokenString, "")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenSymbol, ")"); err != nil {
+			return nil, err
+		}
+		return &filterHasPrefix{key: key, prefix: prefix.value}, nil
+
+	case t.kind == tokenIdent && t.value == "attributes":
+		// attributes:key
+		if _, err := p.expect(tokenSymbol, ":"); err != nil {
+			return nil, err
+		}
+		key, err := p.expect(tokenIdent, "")
+		if err != nil {
+			return nil, err
+		}
+		return &filterHas{key: key.value}, nil
+
+	case t.kind == tokenIdent && strings.HasPrefix(t.value, "attributes."):
+		p.pos--
+		key, err := p.parseAttributeKey()
+		if err != nil {
+			return nil, err
+		}
+		op := p.next()
+		if op.kind != tokenSymbol || (op.value != "=" && op.value != "!=") {
+			return nil, errors.Wrapf(ErrInvalidFilter, "unexpected %q at %d", op.value, op.pos)
+		}
+		value, err := p.expect(tokenString, "")
+		if err != nil {
+			return nil, err
+		}
+		var node filterNode = &filterEqual{key: key, value: value.value}
+		if op.value == "!=" {
+			node = &filterNot{node: node}
+		}
+		return node, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidFilter, "unexpected %q at %d", t.value, t.pos)
+}
+
+// parseAttributeKey return key of the "attributes.key" token
+func (p *filterParser) parseAttributeKey() (string, error) {
+	t, err := p.expect(tokenIdent, "")
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimPrefix(t.value, "attributes.")
+	if key == t.value || key == "" {
+		return "", errors.Wrapf(ErrInvalidFilter, "invalid attribute %q at %d", t.value, t.pos)
+	}
+	return key, nil
+}
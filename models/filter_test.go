@@ -0,0 +1,79 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestParseFilter(t *testing.T) {
+	cases := []struct {
+		input       string
+		expectError error
+	}{
+		{``, nil},
+		{`attributes.type = "order"`, nil},
+		{`attributes.type = "order" AND hasPrefix(attributes.region, "eu")`, nil},
+		{`NOT attributes:type OR (attributes.a != "1" AND attributes.b = "2")`, nil},
+		{`attributes.type = order`, ErrInvalidFilter},
+		{`attributes.type == "order"`, ErrInvalidFilter},
+		{`type = "order"`, ErrInvalidFilter},
+		{`attributes. = "order"`, ErrInvalidFilter},
+		{`attributes.type = "order" AND`, ErrInvalidFilter},
+		{`(attributes.type = "order"`, ErrInvalidFilter},
+		{`hasPrefix(attributes.region)`, ErrInvalidFilter},
+		{`attributes.type = "order`, ErrInvalidFilter},
+	}
+	for i, c := range cases {
+		_, err := ParseFilter(c.input)
+		if errors.Cause(err) != c.expectError {
+			t.Errorf("#%d: want %v, got %v", i, c.expectError, err)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	cases := []struct {
+		input  string
+		attr   map[string]string
+		expect bool
+	}{
+		{``, nil, true},
+		{`attributes.type = "order"`, map[string]string{"type": "order"}, true},
+		{`attributes.type = "order"`, map[string]string{"type": "user"}, false},
+		{`attributes.type = "order"`, nil, false},
+		{`attributes.type != "order"`, nil, true},
+		{`attributes:type`, map[string]string{"type": ""}, true},
+		{`NOT attributes:type`, map[string]string{"type": ""}, false},
+		{
+			`attributes.type = "order" AND hasPrefix(attributes.region, "eu")`,
+			map[string]string{"type": "order", "region": "eu-west"},
+			true,
+		},
+		{
+			`attributes.type = "order" AND hasPrefix(attributes.region, "eu")`,
+			map[string]string{"type": "order", "region": "us-east"},
+			false,
+		},
+		{
+			`attributes.type = "user" OR attributes.type = "order" AND attributes.region = "eu"`,
+			map[string]string{"type": "user"},
+			true,
+		},
+		{
+			`(attributes.type = "user" OR attributes.type = "order") AND attributes.region = "eu"`,
+			map[string]string{"type": "user"},
+			false,
+		},
+		{`attributes.msg = "say \"hi\""`, map[string]string{"msg": `say "hi"`}, true},
+	}
+	for i, c := range cases {
+		f, err := ParseFilter(c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got := f.Match(c.attr); got != c.expect {
+			t.Errorf("#%d: want %t, got %t", i, c.expect, got)
+		}
+	}
+}
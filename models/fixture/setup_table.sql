@@ -1,6 +1,8 @@
-CREATE TABLE IF NOT EXISTS `pubsub` (
-  `id` varchar(255) NOT NULL,
-  `value` blob NOT NULL,
-  PRIMARY KEY (`id`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 DELETE FROM `pubsub`;
+DELETE FROM `pubsub_unique_index`;
+DELETE FROM `pubsub_sorted_index`;
+DELETE FROM `topics`;
+DELETE FROM `subscriptions`;
+DELETE FROM `messages`;
+DELETE FROM `message_statuses`;
+DELETE FROM `snapshots`;
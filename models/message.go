@@ -1,6 +1,7 @@
 package models
 
 import (
+	"sync"
 	"time"
 
 	"github.com/satori/go.uuid"
@@ -12,7 +13,14 @@ type Message struct {
 	Data         []byte            `json:"data"`
 	Attributes   map[string]string `json:"attributes"`
 	SubscribeIDs []string          `json:"-"`
-	PublishedAt  time.Time         `json:"publish_time"`
+	// SnapshotIDs are the Snapshots captured the Message, keep the Message acked by all Subscriptions
+	SnapshotIDs []string  `json:"-"`
+	PublishedAt time.Time `json:"publish_time"`
+	OrderingKey string    `json:"ordering_key,omitempty"`
+	// PublishOrder is the milliseconds of PublishedAt * 1000 + the sequence in the same millisecond
+	PublishOrder int64 `json:"-"`
+
+	store *Store
 }
 
 func makeMessageID() string {
@@ -23,7 +31,31 @@ func makeAckID() string {
 	return uuid.NewV1().String()
 }
 
-// NewMessage return initialized Message
+// makePublishOrder return the publish order of the time without the sequence,
+// exactly represented by the float64 score of the index unlike the nanoseconds
+func makePublishOrder(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond) * 1000
+}
+
+// publishClock generate the increasing publish order in the Store
+type publishClock struct {
+	mu   sync.Mutex
+	last int64
+}
+
+// next return the publish order of the time, greater than the previous one
+func (c *publishClock) next(t time.Time) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := makePublishOrder(t)
+	if o <= c.last {
+		o = c.last + 1
+	}
+	c.last = o
+	return o
+}
+
+// NewMessage return initialized Message, not yet saved to datastore
 func NewMessage(id string, data []byte, attr map[string]string, subs []*Subscription) *Message {
 	m := &Message{
 		ID:           id,
@@ -33,7 +65,7 @@ func NewMessage(id string, data []byte, attr map[string]string, subs []*Subscrip
 		PublishedAt:  time.Now(),
 	}
 	for _, sub := range subs {
-		m.AddSubscription(sub.Name)
+		m.SubscribeIDs = append(m.SubscribeIDs, sub.Name)
 	}
 	return m
 }
@@ -55,14 +87,33 @@ func (m *Message) AckSubscription(subID string) error {
 	return nil
 }
 
+// releaseSnapshot remove Snapshot, and delete the Message no longer referenced
+func (m *Message) releaseSnapshot(name string) error {
+	for k, v := range m.SnapshotIDs {
+		if name == v {
+			m.SnapshotIDs = append(m.SnapshotIDs[:k], m.SnapshotIDs[k+1:]...)
+			break
+		}
+	}
+	if !m.referenced() {
+		return m.Delete()
+	}
+	return m.Save()
+}
+
+// referenced return whether the Message is referenced from any Subscription or Snapshot
+func (m *Message) referenced() bool {
+	return len(m.SubscribeIDs) > 0 || len(m.SnapshotIDs) > 0
+}
+
 // Save is save message to datastore
 func (m *Message) Save() error {
-	return globalMessage.Set(m)
+	return m.store.messages.Set(m)
 }
 
 // Delete is received all ack response message to delete
 func (m *Message) Delete() error {
-	return globalMessage.Delete(m.ID)
+	return m.store.messages.Delete(m.ID)
 }
 
 // ByMessageID implements sort.Interface for []*Message based on the ID
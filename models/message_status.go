@@ -3,10 +3,10 @@ package models
 import (
 	"fmt"
 	"log"
-	"sort"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/datastore"
 )
 
 // messageState is represent Message deliver, ack status
@@ -37,7 +37,7 @@ func (ms *MessageStatus) Readable() bool {
 	switch ms.AckState {
 	case stateDeliver:
 		lapsedTime := time.Now().Sub(ms.DeliveredAt)
-		return lapsedTime > ms.AckDeadline
+		return lapsedTime > ms.AckDeadline+ms.RetryBackoff
 	case stateWait:
 		return true
 	default:
@@ -54,6 +54,19 @@ type MessageStatus struct {
 	AckDeadline    time.Duration
 	AckState       messageState
 	DeliveredAt    time.Time
+
+	// DeliveryAttempt is number of the delivery
+	DeliveryAttempt int
+	// RetryBackoff is delay of the redelivery after exceeded AckDeadline
+	RetryBackoff time.Duration
+	// PublishedAt is publish time of the Message
+	PublishedAt time.Time
+	// PublishOrder is publish order of the Message, used to deliver in publish order
+	PublishOrder int64
+	// OrderingKey is set only when the Subscription enabled message ordering
+	OrderingKey string
+
+	store *Store
 }
 
 func newMessageStatus(subID, msgID string, deadline time.Duration) *MessageStatus {
@@ -76,65 +89,99 @@ func (ms *MessageStatus) Deliver(ackID string) {
 	ms.AckState = stateDeliver
 	ms.AckID = ackID
 	ms.DeliveredAt = time.Now()
+	ms.DeliveryAttempt++
 }
 
 // Save save MessageStatus to backend datastore
 func (ms *MessageStatus) Save() error {
-	return getGlobalMessageStatus().Set(ms)
+	return ms.store.messageStatus.Set(ms)
 }
 
 // Delete delete MessageStatus from backend datastore
 func (ms *MessageStatus) Delete() error {
-	return getGlobalMessageStatus().Delete(ms.ID)
+	return ms.store.messageStatus.Delete(ms.ID)
+}
+
+// publishOrder return the publish order, the MessageStatus saved before the PublishOrder is ordered by PublishedAt
+func (ms *MessageStatus) publishOrder() int64 {
+	if ms.PublishOrder != 0 {
+		return ms.PublishOrder
+	}
+	return makePublishOrder(ms.PublishedAt)
 }
 
-// MessageStatusStore is holds and adapter for MessageStatus
+// MessageStatusStore is holds and adapter for MessageStatus,
+// the MessageStatus of the Subscription are found by the index of the datastore
 type MessageStatusStore struct {
 	SubscriptionID string
-	Status         []string
+
+	store *Store
 }
 
 // NewMessageStatusStore return created MessageStatusStore
-func NewMessageStatusStore(subID string) *MessageStatusStore {
+func (st *Store) NewMessageStatusStore(subID string) *MessageStatusStore {
 	return &MessageStatusStore{
 		SubscriptionID: subID,
-		Status:         make([]string, 0),
+		store:          st,
 	}
 }
 
-// NewMessageStatus return created MessageStatus and save datastore
-func (mss *MessageStatusStore) NewMessageStatus(subID, msgID string, deadline time.Duration) (*MessageStatus, error) {
-	ms := newMessageStatus(subID, msgID, deadline)
+// NewMessageStatus return created MessageStatus and save datastore.
+// when ordered is true, the MessageStatus holds OrderingKey of the Message.
+func (mss *MessageStatusStore) NewMessageStatus(subID string, msg *Message, deadline time.Duration, ordered bool) (*MessageStatus, error) {
+	ms := mss.prepareMessageStatus(subID, msg, deadline, ordered)
 	if err := ms.Save(); err != nil {
 		return nil, err
 	}
-	mss.Status = append(mss.Status, ms.ID)
 	return ms, nil
 }
 
-// CollectReadableMessage return readable messages
-func (mss *MessageStatusStore) CollectReadableMessage(size int) ([]*Message, error) {
-	// check size
-	storeLength := len(mss.Status)
-	if storeLength == 0 {
-		return nil, ErrEmptyMessage
-	}
-	if storeLength < size {
-		size = storeLength
+// prepareMessageStatus return created MessageStatus, but not save datastore
+func (mss *MessageStatusStore) prepareMessageStatus(subID string, msg *Message, deadline time.Duration, ordered bool) *MessageStatus {
+	ms := newMessageStatus(subID, msg.ID, deadline)
+	ms.store = mss.store
+	ms.PublishedAt = msg.PublishedAt
+	ms.PublishOrder = msg.PublishOrder
+	if ordered {
+		ms.OrderingKey = msg.OrderingKey
 	}
+	return ms
+}
 
-	// collect messages
-	msList, err := getGlobalMessageStatus().CollectByIDs(mss.Status...)
+// CollectReadableMessage return readable messages in publish order.
+// the message has OrderingKey is readable only after acked the previous messages of the same key.
+func (mss *MessageStatusStore) CollectReadableMessage(size int) ([]*Message, error) {
+	ids, err := mss.store.messageStatus.rangeBySubscriptionID(mss.SubscriptionID)
 	if err != nil {
 		return nil, err
 	}
+
 	res := make([]*Message, 0)
-	for _, ms := range msList {
+	blockedKeys := make(map[string]bool)
+	for _, id := range ids {
 		if len(res) >= size {
 			break
 		}
+		ms, err := mss.store.messageStatus.Get(id)
+		if err != nil {
+			// deleted after the range
+			if errors.Cause(err) == datastore.ErrNotFoundEntry {
+				continue
+			}
+			return nil, err
+		}
+		if ms.AckState == stateAck {
+			continue
+		}
+		if ms.OrderingKey != "" {
+			if blockedKeys[ms.OrderingKey] {
+				continue
+			}
+			// subsequent messages of the key wait for ack of this message
+			blockedKeys[ms.OrderingKey] = true
+		}
 		if ms.Readable() {
-			m, err := globalMessage.Get(ms.MessageID)
+			m, err := mss.store.messages.Get(ms.MessageID)
 			if err != nil {
 				log.Printf("failed to get message, id=%s, error=%v", ms.MessageID, err)
 				continue
@@ -147,35 +194,87 @@ func (mss *MessageStatusStore) CollectReadableMessage(size int) ([]*Message, err
 	if len(res) == 0 {
 		return nil, ErrEmptyMessage
 	}
-	sort.Sort(ByMessageID(res))
 	return res, nil
 }
 
 // CollectAllMessages returns all Message
 func (mss *MessageStatusStore) CollectAllMessages() ([]*MessageStatus, error) {
-	return getGlobalMessageStatus().ListBySubscriptionID(mss.SubscriptionID)
+	return mss.store.messageStatus.ListBySubscriptionID(mss.SubscriptionID)
 }
 
-// Deliver register AckID to message
-func (mss *MessageStatusStore) Deliver(msgID, ackID string) error {
-	ms, err := getGlobalMessageStatus().FindBySubscriptionIDAndMessageID(mss.SubscriptionID, msgID)
+// Deliver register AckID and ack deadline to message, and return delivered MessageStatus.
+// the redelivery of the message is delayed by the RetryPolicy.
+func (mss *MessageStatusStore) Deliver(msgID, ackID string, deadline time.Duration, policy *RetryPolicy) (*MessageStatus, error) {
+	ms, err := mss.store.messageStatus.FindBySubscriptionIDAndMessageID(mss.SubscriptionID, msgID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if ms.AckState == stateAck {
-		return ErrAlreadyReadMessage
+		return nil, ErrAlreadyReadMessage
 	}
 	ms.Deliver(ackID)
-	return ms.Save()
+	// reset the deadline modified in the previous delivery
+	ms.AckDeadline = deadline
+	ms.RetryBackoff = policy.backoff(ms.DeliveryAttempt)
+	if err := ms.Save(); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// deliverLocked deliver readable messages locked in the datastore with the new AckID,
+// the other server processes do not deliver the same messages. the MessageStatus are returned in publish order.
+func (mss *MessageStatusStore) deliverLocked(l datastore.Locker, size int, deadline time.Duration, policy *RetryPolicy) ([]*MessageStatus, error) {
+	res := make([]*MessageStatus, 0, size)
+	err := l.LockSortedIndex(indexSubscription, mss.SubscriptionID, size, time.Now(), func(values [][]byte, b datastore.Batch) error {
+		for _, v := range values {
+			ms, err := decodeGobMessageStatus(v)
+			if err != nil {
+				return err
+			}
+			ms.store = mss.store
+			ms.Deliver(makeAckID())
+			ms.AckDeadline = deadline
+			ms.RetryBackoff = policy.backoff(ms.DeliveryAttempt)
+			if err := mss.store.messageStatus.SetBatch(b, ms); err != nil {
+				return err
+			}
+			res = append(res, ms)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to lock message status, SubscriptionID=%s", mss.SubscriptionID)
+	}
+	if len(res) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	return res, nil
 }
 
 // Ack invisible message depends ackID
 func (mss *MessageStatusStore) Ack(ackID string) error {
-	ms, err := getGlobalMessageStatus().FindByAckID(ackID)
+	ms, err := mss.store.messageStatus.FindByAckID(ackID)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to FindByAckID, AckID=%s", ackID))
 	}
-	m, err := globalMessage.Get(ms.MessageID)
+	return ackMessageStatus(ms)
+}
+
+// RetainAck change message state to acked without delete, message can be redelivered by the Seek
+func (mss *MessageStatusStore) RetainAck(ackID string) error {
+	ms, err := mss.store.messageStatus.FindByAckID(ackID)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("failed to FindByAckID, AckID=%s", ackID))
+	}
+	ms.AckState = stateAck
+	ms.AckID = ""
+	return ms.Save()
+}
+
+// ackMessageStatus delete MessageStatus, and delete Message when received ack from all depended Subscriptions and not captured by any Snapshot
+func ackMessageStatus(ms *MessageStatus) error {
+	m, err := ms.store.messages.Get(ms.MessageID)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to get message, MessageID=%s", ms.MessageID))
 	}
@@ -190,7 +289,7 @@ func (mss *MessageStatusStore) Ack(ackID string) error {
 	if err := ms.Delete(); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to delete message status, MessageStatusID=%s", ms.ID))
 	}
-	if len(m.SubscribeIDs) == 0 {
+	if !m.referenced() {
 		if err := m.Delete(); err != nil {
 			return errors.Wrap(err, fmt.Sprintf("failed to delete message, MessageID=%s", m.ID))
 		}
@@ -200,5 +299,5 @@ func (mss *MessageStatusStore) Ack(ackID string) error {
 
 // FindByAckID return MessageStatus depends AckID
 func (mss *MessageStatusStore) FindByAckID(ackID string) (*MessageStatus, error) {
-	return getGlobalMessageStatus().FindByAckID(ackID)
+	return mss.store.messageStatus.FindByAckID(ackID)
 }
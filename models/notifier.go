@@ -0,0 +1,39 @@
+package models
+
+import "sync"
+
+// messageNotifier is broadcaster to the waiters for each Subscription
+type messageNotifier struct {
+	chans map[string]chan struct{}
+	mu    sync.Mutex
+}
+
+func newMessageNotifier() *messageNotifier {
+	return &messageNotifier{
+		chans: make(map[string]chan struct{}),
+	}
+}
+
+// wait returns channel to be closed when the message is registered to the Subscription
+func (n *messageNotifier) wait(subID string) <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ch, ok := n.chans[subID]
+	if !ok {
+		ch = make(chan struct{})
+		n.chans[subID] = ch
+	}
+	return ch
+}
+
+// notify wake up all waiters of the Subscription
+func (n *messageNotifier) notify(subID string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if ch, ok := n.chans[subID]; ok {
+		close(ch)
+		delete(n.chans, subID)
+	}
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MinStreamAckDeadline is the minimum ack deadline of the streaming pull,
+// not to redeliver the messages of the Subscription without the ack deadline in a tight loop
+const MinStreamAckDeadline = 10 * time.Second
+
+// StreamAckDeadline return the ack deadline of the messages delivered by StreamingPullWait
+func (s *Subscription) StreamAckDeadline() time.Duration {
+	if s.DefaultAckDeadline < MinStreamAckDeadline {
+		return MinStreamAckDeadline
+	}
+	return s.DefaultAckDeadline
+}
+
+// StreamingPullWait is PullWait for the streaming pull, the messages are delivered with at least MinStreamAckDeadline
+func (s *Subscription) StreamingPullWait(ctx context.Context, size int) ([]*PullMessage, error) {
+	return s.pullWait(ctx, size, MinStreamAckDeadline)
+}
+
+// Outstanding is the flow control of the streaming pull, holds the delivered messages
+// until acked, nacked or exceeded the ack deadline
+type Outstanding struct {
+	max       int
+	deadlines map[string]time.Time
+	released  chan struct{}
+	mu        sync.Mutex
+}
+
+// NewOutstanding return Outstanding limited to max messages
+func NewOutstanding(max int) *Outstanding {
+	return &Outstanding{
+		max:       max,
+		deadlines: make(map[string]time.Time),
+		released:  make(chan struct{}, 1),
+	}
+}
+
+// Available returns number of the deliverable messages,
+// the messages exceeded the ack deadline are released to be redelivered with the new AckID
+func (o *Outstanding) Available() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := time.Now()
+	for id, d := range o.deadlines {
+		if now.After(d) {
+			delete(o.deadlines, id)
+		}
+	}
+	return o.max - len(o.deadlines)
+}
+
+// Deliver mark messages as outstanding until the ack deadline
+func (o *Outstanding) Deliver(msgs []*PullMessage, deadline time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	d := time.Now().Add(deadline)
+	for _, m := range msgs {
+		o.deadlines[m.AckID] = d
+	}
+}
+
+// Extend renew the ack deadline of the outstanding messages
+func (o *Outstanding) Extend(ackIDs []string, deadline time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	d := time.Now().Add(deadline)
+	for _, id := range ackIDs {
+		if _, ok := o.deadlines[id]; ok {
+			o.deadlines[id] = d
+		}
+	}
+}
+
+// Release remove messages from outstanding, and notify to the waiting sender
+func (o *Outstanding) Release(ackIDs []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, id := range ackIDs {
+		delete(o.deadlines, id)
+	}
+	select {
+	case o.released <- struct{}{}:
+	default:
+	}
+}
+
+// Wait blocks until any message is released or exceeded the ack deadline, or ctx is done
+func (o *Outstanding) Wait(ctx context.Context) error {
+	timer := time.NewTimer(o.untilExpire())
+	defer timer.Stop()
+	select {
+	case <-o.released:
+		return nil
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// untilExpire return the duration until the earliest ack deadline
+func (o *Outstanding) untilExpire() time.Duration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var earliest time.Time
+	for _, d := range o.deadlines {
+		if earliest.IsZero() || d.Before(earliest) {
+			earliest = d
+		}
+	}
+	if earliest.IsZero() {
+		return 0
+	}
+	// wake up just after the deadline, Available release the message after it
+	return time.Until(earliest) + time.Millisecond
+}
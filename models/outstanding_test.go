@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOutstanding(t *testing.T) {
+	o := NewOutstanding(2)
+	o.Deliver([]*PullMessage{{AckID: "a"}}, time.Hour)
+	o.Deliver([]*PullMessage{{AckID: "b"}}, 10*time.Millisecond)
+	o.Extend([]string{"unknown"}, time.Hour)
+
+	cases := []struct {
+		release         []string
+		wait            time.Duration
+		expectAvailable int
+	}{
+		{nil, 0, 0},
+		// exceeded the ack deadline
+		{nil, 20 * time.Millisecond, 1},
+		{[]string{"a"}, 0, 2},
+	}
+	for i, c := range cases {
+		o.Release(c.release)
+		time.Sleep(c.wait)
+		if got := o.Available(); got != c.expectAvailable {
+			t.Errorf("#%d: want %d, got %d", i, c.expectAvailable, got)
+		}
+	}
+}
+
+func TestOutstandingWaitExpire(t *testing.T) {
+	o := NewOutstanding(1)
+	o.Deliver([]*PullMessage{{AckID: "a"}}, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := o.Wait(ctx); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if got := o.Available(); got != 1 {
+		t.Errorf("want 1, got %d", got)
+	}
+}
+
+func TestStreamingPullWaitWithoutAckDeadline(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	sub, err := testStore.NewSubscription("a", "A", 0, "", nil, "")
+	if err != nil {
+		t.Fatalf("failed to create subscription, got err %v", err)
+	}
+	if got := sub.StreamAckDeadline(); got != MinStreamAckDeadline {
+		t.Errorf("want %v, got %v", MinStreamAckDeadline, got)
+	}
+	publishMessage(t, "A", "1", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	msgs, err := sub.StreamingPullWait(ctx, 1)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("want 1 message, got %v, err %v", msgs, err)
+	}
+	// not redelivered until MinStreamAckDeadline
+	if _, err := sub.StreamingPullWait(ctx, 1); err != ErrEmptyMessage {
+		t.Errorf("want %v, got %v", ErrEmptyMessage, err)
+	}
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/datastore"
+)
+
+// RetentionSweepInterval is interval of the sweeping expired messages
+const RetentionSweepInterval = 1 * time.Minute
+
+// SetMessageRetentionDuration setting retention duration of the messages published to the Topic, 0 is unlimited
+func (t *Topic) SetMessageRetentionDuration(d time.Duration) error {
+	if d < 0 {
+		return ErrInvalidRetentionDuration
+	}
+	if err := t.store.supportStream(d > 0); err != nil {
+		return err
+	}
+	t.MessageRetentionDuration = d
+	return t.Save()
+}
+
+// SetMessageRetentionDuration setting retention duration of the unacked messages,
+// 0 is used retention duration of the Topic
+func (s *Subscription) SetMessageRetentionDuration(d time.Duration) error {
+	if d < 0 {
+		return ErrInvalidRetentionDuration
+	}
+	if err := s.store.supportStream(d > 0); err != nil {
+		return err
+	}
+	s.MessageRetentionDuration = d
+	return s.Save()
+}
+
+// RunRetentionSweeper sweep expired subscriptions, messages, snapshots and the acked stream entries every interval until ctx is done or the Store is closed
+func (st *Store) RunRetentionSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-st.done:
+			return
+		case <-ticker.C:
+		}
+		if _, err := st.SweepExpiredMessages(time.Now()); err != nil {
+			log.Printf("failed to sweep expired messages, error=%v", err)
+		}
+		if _, err := st.SweepExpiredSubscriptions(time.Now()); err != nil {
+			log.Printf("failed to sweep expired subscriptions, error=%v", err)
+		}
+		if _, err := st.SweepExpiredSnapshots(time.Now()); err != nil {
+			log.Printf("failed to sweep expired snapshots, error=%v", err)
+		}
+		if err := st.SweepStreams(); err != nil {
+			log.Printf("failed to sweep streams, error=%v", err)
+		}
+	}
+}
+
+// SweepExpiredMessages delete MessageStatus exceeded the retention duration,
+// and delete Message no longer referenced from any Subscription.
+// the MessageStatus are read from the index of each Subscription in publish order until not expired.
+// return number of the deleted MessageStatus.
+func (st *Store) SweepExpiredMessages(now time.Time) (int, error) {
+	subs, err := st.ListSubscription()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list subscription")
+	}
+	expired := 0
+	for _, s := range subs {
+		n, err := s.sweepExpiredMessages(now)
+		expired += n
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// sweepExpiredMessages delete MessageStatus of the Subscription exceeded the retention duration
+func (s *Subscription) sweepExpiredMessages(now time.Time) (int, error) {
+	retention := s.retentionDuration()
+	if retention <= 0 {
+		return 0, nil
+	}
+	ids, err := s.store.messageStatus.rangeBySubscriptionID(s.Name)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to range message status, SubscriptionID=%s", s.Name)
+	}
+	expired := 0
+	for _, id := range ids {
+		ms, err := s.store.messageStatus.Get(id)
+		if err != nil {
+			if cause := errors.Cause(err); cause == ErrNotFoundEntry || cause == datastore.ErrNotFoundEntry {
+				continue
+			}
+			return expired, err
+		}
+		if ms.PublishedAt.IsZero() {
+			continue
+		}
+		// the later messages in publish order are not expired
+		if now.Sub(ms.PublishedAt) <= retention {
+			break
+		}
+		if err := expireMessageStatus(ms); err != nil {
+			return expired, err
+		}
+		// retained acked message is not counted to the expired metrics
+		if ms.AckState != stateAck {
+			s.store.stats.GetSubscriptionAdapter().AddExpiredMessage(ms.SubscriptionID, 1)
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// retentionDuration return retention duration of the Subscription, prefer the Subscription setting to the Topic
+func (s *Subscription) retentionDuration() time.Duration {
+	if s.MessageRetentionDuration > 0 {
+		return s.MessageRetentionDuration
+	}
+	if t, err := s.store.GetTopic(s.TopicID); err == nil {
+		return t.MessageRetentionDuration
+	}
+	return 0
+}
+
+// expireMessageStatus delete MessageStatus, and delete Message when not referenced from any Subscription or Snapshot
+func expireMessageStatus(ms *MessageStatus) error {
+	if err := ms.Delete(); err != nil {
+		return errors.Wrapf(err, "failed to delete message status, MessageStatusID=%s", ms.ID)
+	}
+	m, err := ms.store.messages.Get(ms.MessageID)
+	if err != nil {
+		// already deleted
+		return nil
+	}
+	if err := m.AckSubscription(ms.SubscriptionID); err != nil {
+		return errors.Wrapf(err, "failed to release message, MessageID=%s", m.ID)
+	}
+	if !m.referenced() {
+		if err := m.Delete(); err != nil {
+			return errors.Wrapf(err, "failed to delete message, MessageID=%s", m.ID)
+		}
+	}
+	return nil
+}
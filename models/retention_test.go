@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSweepExpiredMessages(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	if err := mustGetTopic(t, "A").SetMessageRetentionDuration(time.Hour); err != nil {
+		t.Fatalf("failed to set retention duration, got err %v", err)
+	}
+	setupSubscription(t, "inherit", "A")
+	if err := setupSubscription(t, "short", "A").SetMessageRetentionDuration(10 * time.Minute); err != nil {
+		t.Fatalf("failed to set retention duration, got err %v", err)
+	}
+	setupSubscription(t, "deleted", "A")
+	setupSubscription(t, "unlimited", "B")
+
+	msgID := publishMessage(t, "A", "test", nil)
+	publishMessage(t, "B", "test", nil)
+	noSubMsgID := publishMessage(t, "C", "test", nil)
+	if err := mustGetSubscription(t, "deleted").Delete(); err != nil {
+		t.Fatalf("failed to delete subscription, got err %v", err)
+	}
+
+	now := time.Now()
+	cases := []struct {
+		input         time.Time
+		expectExpired int
+		expectRemain  []string
+	}{
+		// the deleted Subscription released the message at the Delete
+		{now, 0, []string{"inherit", "short"}},
+		{now.Add(30 * time.Minute), 1, []string{"inherit"}},
+		{now.Add(2 * time.Hour), 1, []string{}},
+		{now.Add(365 * 24 * time.Hour), 0, []string{}},
+	}
+	for i, c := range cases {
+		got, err := testStore.SweepExpiredMessages(c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got != c.expectExpired {
+			t.Errorf("#%d: want expired %d, got %d", i, c.expectExpired, got)
+		}
+
+		m, err := testStore.messages.Get(msgID)
+		if len(c.expectRemain) == 0 {
+			if err == nil {
+				t.Errorf("#%d: want deleted message, got %v", i, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if len(m.SubscribeIDs) != len(c.expectRemain) {
+			t.Errorf("#%d: want subscriptions %v, got %v", i, c.expectRemain, m.SubscribeIDs)
+		}
+	}
+
+	// unlimited retention
+	if _, err := mustGetSubscription(t, "unlimited").Pull(1); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+	// no subscription message
+	if _, err := testStore.messages.Get(noSubMsgID); err == nil {
+		t.Errorf("want deleted message, got nil")
+	}
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// RetryPolicy is represent delay of the redelivery for the nacked or expired message in Subscription
+type RetryPolicy struct {
+	MinimumBackoff time.Duration
+	MaximumBackoff time.Duration
+}
+
+// NewRetryPolicy return initialized RetryPolicy,
+// MinimumBackoff must be positive to be doubled, use nil RetryPolicy to redeliver immediately
+func NewRetryPolicy(min, max time.Duration) (*RetryPolicy, error) {
+	if min <= 0 || max < min {
+		return nil, ErrInvalidRetryPolicy
+	}
+	return &RetryPolicy{
+		MinimumBackoff: min,
+		MaximumBackoff: max,
+	}, nil
+}
+
+// backoff return delay of the redelivery after the delivery attempt.
+// the delay is doubled for each attempt, from MinimumBackoff up to MaximumBackoff.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	if p == nil || attempt <= 0 {
+		return 0
+	}
+	d := p.MinimumBackoff
+	for i := 1; i < attempt && d < p.MaximumBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaximumBackoff {
+		return p.MaximumBackoff
+	}
+	return d
+}
+
+// SetRetryPolicy setting retry policy, nil is redeliver immediately
+func (s *Subscription) SetRetryPolicy(p *RetryPolicy) error {
+	if err := s.store.supportStream(p != nil); err != nil {
+		return err
+	}
+	s.RetryPolicy = p
+	return s.Save()
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p, err := NewRetryPolicy(10*time.Second, 60*time.Second)
+	if err != nil {
+		t.Fatalf("failed to create RetryPolicy, got err %v", err)
+	}
+
+	cases := []struct {
+		input  int
+		expect time.Duration
+	}{
+		{0, 0},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, 60 * time.Second},
+		{100, 60 * time.Second},
+	}
+	for i, c := range cases {
+		if got := p.backoff(c.input); got != c.expect {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+
+	// nil policy is redeliver immediately
+	var nilPolicy *RetryPolicy
+	if got := nilPolicy.backoff(1); got != 0 {
+		t.Errorf("want 0, got %v", got)
+	}
+}
+
+func TestNewRetryPolicy(t *testing.T) {
+	cases := []struct {
+		inputMin    time.Duration
+		inputMax    time.Duration
+		expectError error
+	}{
+		{time.Second, time.Minute, nil},
+		{time.Second, time.Second, nil},
+		// never doubled from 0
+		{0, time.Minute, ErrInvalidRetryPolicy},
+		{0, 0, ErrInvalidRetryPolicy},
+		{time.Minute, time.Second, ErrInvalidRetryPolicy},
+		{-time.Second, time.Second, ErrInvalidRetryPolicy},
+	}
+	for i, c := range cases {
+		_, err := NewRetryPolicy(c.inputMin, c.inputMax)
+		if err != c.expectError {
+			t.Errorf("#%d: want %v, got %v", i, c.expectError, err)
+		}
+	}
+}
+
+func TestPullRetryBackoff(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+
+	p, err := NewRetryPolicy(100*time.Millisecond, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to create RetryPolicy, got err %v", err)
+	}
+	if err := mustGetSubscription(t, "a").SetRetryPolicy(p); err != nil {
+		t.Fatalf("failed to set RetryPolicy, got err %v", err)
+	}
+	publishMessage(t, "A", "test", nil)
+
+	// nack
+	sub := mustGetSubscription(t, "a")
+	msgs, err := sub.Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := sub.ModifyAckDeadline(msgs[0].AckID, 0); err != nil {
+		t.Fatalf("failed to nack, got err %v", err)
+	}
+
+	// before backoff
+	if _, err := sub.Pull(1); err != ErrEmptyMessage {
+		t.Errorf("want %v, got %v", ErrEmptyMessage, err)
+	}
+	// after backoff
+	time.Sleep(150 * time.Millisecond)
+	msgs, err = sub.Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if want := 2; msgs[0].DeliveryAttempt != want {
+		t.Errorf("want delivery attempt %d, got %d", want, msgs[0].DeliveryAttempt)
+	}
+}
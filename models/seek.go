@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SetRetainAckedMessages setting whether to keep the acked messages for the Seek
+func (s *Subscription) SetRetainAckedMessages(enable bool) error {
+	if err := s.store.supportStream(enable); err != nil {
+		return err
+	}
+	s.RetainAckedMessages = enable
+	return s.Save()
+}
+
+// Seek mark the messages published before the time as acked,
+// and the messages published after the time become redeliverable.
+// the acked messages are redelivered only when retained by RetainAckedMessages.
+func (s *Subscription) Seek(t time.Time) error {
+	if err := s.store.supportStream(true); err != nil {
+		return err
+	}
+	unlock := s.lockDelivery()
+	defer unlock()
+
+	list, err := s.Message.CollectAllMessages()
+	if err != nil {
+		return errors.Wrapf(err, "failed to collect message status, SubscriptionID=%s", s.Name)
+	}
+	for _, ms := range list {
+		publishedAt, err := publishedAtOf(ms)
+		if err != nil {
+			return err
+		}
+		if publishedAt.Before(t) {
+			if err := s.seekAck(ms); err != nil {
+				return err
+			}
+			continue
+		}
+		ms.AckState = stateWait
+		ms.AckID = ""
+		if err := ms.Save(); err != nil {
+			return errors.Wrapf(err, "failed to save message status, MessageStatusID=%s", ms.ID)
+		}
+	}
+
+	s.store.notifier.notify(s.Name)
+	s.sendCurrentMessages()
+	return nil
+}
+
+// seekAck change the MessageStatus to acked, and delete it unless retained
+func (s *Subscription) seekAck(ms *MessageStatus) error {
+	if ms.AckState == stateAck {
+		return nil
+	}
+	if s.RetainAckedMessages {
+		ms.AckState = stateAck
+		ms.AckID = ""
+		return ms.Save()
+	}
+	return ackMessageStatus(ms)
+}
+
+// publishedAtOf return publish time of the Message depended MessageStatus
+func publishedAtOf(ms *MessageStatus) (time.Time, error) {
+	if !ms.PublishedAt.IsZero() {
+		return ms.PublishedAt, nil
+	}
+	m, err := ms.store.messages.Get(ms.MessageID)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "failed to get message, MessageID=%s", ms.MessageID)
+	}
+	return m.PublishedAt, nil
+}
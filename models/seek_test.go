@@ -0,0 +1,86 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSeek(t *testing.T) {
+	cases := []struct {
+		retain      bool
+		seekToFirst bool
+		expect      []string
+	}{
+		{true, false, []string{"second"}},
+		{true, true, []string{"first", "second"}},
+		{false, false, []string{}},
+		{false, true, []string{}},
+	}
+	for i, c := range cases {
+		setupDatastore(t)
+		setupDummyTopics(t)
+		if err := setupSubscription(t, "a", "A").SetRetainAckedMessages(c.retain); err != nil {
+			t.Fatalf("#%d: failed to set retain acked messages, got err %v", i, err)
+		}
+		before := time.Now()
+		publishMessage(t, "A", "first", nil)
+		time.Sleep(10 * time.Millisecond)
+		middle := time.Now()
+		publishMessage(t, "A", "second", nil)
+
+		// ack all messages
+		sub := mustGetSubscription(t, "a")
+		msgs, err := sub.Pull(2)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		for _, m := range msgs {
+			if err := sub.Ack(m.AckID); err != nil {
+				t.Fatalf("#%d: failed to ack, got err %v", i, err)
+			}
+		}
+
+		seekTime := middle
+		if c.seekToFirst {
+			seekTime = before
+		}
+		if err := sub.Seek(seekTime); err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		msgs, _ = sub.Pull(2)
+		got := []string{}
+		for _, m := range msgs {
+			got = append(got, string(m.Message.Data))
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestSeekUnacked(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+	publishMessage(t, "A", "first", nil)
+	time.Sleep(10 * time.Millisecond)
+	middle := time.Now()
+	publishMessage(t, "A", "second", nil)
+
+	// outstanding messages are acked or redelivered immediately
+	sub := mustGetSubscription(t, "a")
+	if _, err := sub.Pull(2); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := sub.Seek(middle); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	msgs, err := sub.Pull(2)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Message.Data) != "second" {
+		t.Errorf("want only second message, got %v", msgs)
+	}
+}
@@ -0,0 +1,249 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultSnapshotExpiration is expiration of the Snapshot when not specified
+const DefaultSnapshotExpiration = 7 * 24 * time.Hour
+
+// Snapshot is holds the unacked messages of the Subscription at a point in time
+type Snapshot struct {
+	Name           string    `json:"name"`
+	TopicID        string    `json:"topic"`
+	SubscriptionID string    `json:"subscription"`
+	ExpireAt       time.Time `json:"expire_time"`
+
+	// CreatedAt is the time captured the messages, the messages published after it are unacked by the restore
+	CreatedAt time.Time `json:"-"`
+	// MessageIDs are the unacked messages, the Messages are not deleted until the Snapshot deleted
+	MessageIDs []string `json:"-"`
+
+	store *Store
+}
+
+// NewSnapshot return Snapshot captured the unacked messages of the Subscription,
+// if not exist already same name Snapshot.
+// expiration less than or equal to 0 is used DefaultSnapshotExpiration.
+func (st *Store) NewSnapshot(name, subID string, expiration time.Duration) (*Snapshot, error) {
+	if err := st.supportStream(true); err != nil {
+		return nil, err
+	}
+	if _, err := st.GetSnapshot(name); err == nil {
+		return nil, ErrAlreadyExistSnapshot
+	}
+	sub, err := st.GetSubscription(subID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get subscription, SubscriptionID=%s", subID)
+	}
+	if expiration <= 0 {
+		expiration = DefaultSnapshotExpiration
+	}
+
+	now := time.Now()
+	msgs, err := sub.unackedMessages()
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		Name:           name,
+		TopicID:        sub.TopicID,
+		SubscriptionID: sub.Name,
+		ExpireAt:       now.Add(expiration),
+		CreatedAt:      now,
+		MessageIDs:     make([]string, 0, len(msgs)),
+		store:          st,
+	}
+
+	// save the Snapshot and pin the Messages all-or-nothing
+	b := st.newBatch()
+	for _, m := range msgs {
+		s.MessageIDs = append(s.MessageIDs, m.ID)
+		m.SnapshotIDs = append(m.SnapshotIDs, name)
+		if err := st.messages.SetBatch(b, m); err != nil {
+			return nil, errors.Wrapf(err, "failed to encode message, MessageID=%s", m.ID)
+		}
+	}
+	if err := st.snapshots.SetBatch(b, s); err != nil {
+		return nil, errors.Wrapf(err, "failed to encode snapshot, name=%s", name)
+	}
+	if err := b.Commit(); err != nil {
+		return nil, errors.Wrapf(err, "failed to save snapshot, name=%s", name)
+	}
+	return s, nil
+}
+
+// GetSnapshot return Snapshot, the expired Snapshot is not found
+func (st *Store) GetSnapshot(name string) (*Snapshot, error) {
+	s, err := st.snapshots.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if s.Expired(time.Now()) {
+		return nil, ErrNotFoundEntry
+	}
+	return s, nil
+}
+
+// ListSnapshot returns not expired Snapshot list
+func (st *Store) ListSnapshot() ([]*Snapshot, error) {
+	list, err := st.snapshots.List()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res := make([]*Snapshot, 0, len(list))
+	for _, s := range list {
+		if !s.Expired(now) {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+// Expired return whether the Snapshot exceeded the expiration
+func (s *Snapshot) Expired(now time.Time) bool {
+	return now.After(s.ExpireAt)
+}
+
+// Save is save to datastore
+func (s *Snapshot) Save() error {
+	return s.store.snapshots.Set(s)
+}
+
+// Delete is delete from datastore, and release the captured Messages
+func (s *Snapshot) Delete() error {
+	for _, id := range s.MessageIDs {
+		m, err := s.store.messages.Get(id)
+		if err != nil {
+			// already deleted
+			continue
+		}
+		if err := m.releaseSnapshot(s.Name); err != nil {
+			return errors.Wrapf(err, "failed to release message, MessageID=%s", id)
+		}
+	}
+	return s.store.snapshots.Delete(s.Name)
+}
+
+// SweepExpiredSnapshots delete Snapshot exceeded the expiration, and return number of the deleted Snapshot
+func (st *Store) SweepExpiredSnapshots(now time.Time) (int, error) {
+	list, err := st.snapshots.List()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to list snapshot")
+	}
+	deleted := 0
+	for _, s := range list {
+		if !s.Expired(now) {
+			continue
+		}
+		if err := s.Delete(); err != nil {
+			return deleted, errors.Wrapf(err, "failed to delete snapshot, name=%s", s.Name)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// unackedMessages return the unacked messages in publish order
+func (s *Subscription) unackedMessages() ([]*Message, error) {
+	list, err := s.Message.CollectAllMessages()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to collect message status, SubscriptionID=%s", s.Name)
+	}
+	res := make([]*Message, 0, len(list))
+	for _, ms := range list {
+		if ms.AckState == stateAck {
+			continue
+		}
+		m, err := s.store.messages.Get(ms.MessageID)
+		if err != nil {
+			// already deleted
+			continue
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+// RestoreSnapshot mark the messages captured in the Snapshot and published after the Snapshot as unacked,
+// and the other messages as acked. the Snapshot must be created from the Subscription of the same Topic.
+func (s *Subscription) RestoreSnapshot(snap *Snapshot) error {
+	if err := s.store.supportStream(true); err != nil {
+		return err
+	}
+	if snap.TopicID != s.TopicID {
+		return ErrMismatchSnapshot
+	}
+
+	unlock := s.lockDelivery()
+	defer unlock()
+
+	captured := make(map[string]bool, len(snap.MessageIDs))
+	for _, id := range snap.MessageIDs {
+		captured[id] = true
+	}
+	list, err := s.Message.CollectAllMessages()
+	if err != nil {
+		return errors.Wrapf(err, "failed to collect message status, SubscriptionID=%s", s.Name)
+	}
+	for _, ms := range list {
+		if captured[ms.MessageID] {
+			delete(captured, ms.MessageID)
+		} else {
+			publishedAt, err := publishedAtOf(ms)
+			if err != nil {
+				return err
+			}
+			if publishedAt.Before(snap.CreatedAt) {
+				if err := s.seekAck(ms); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		ms.AckState = stateWait
+		ms.AckID = ""
+		if err := ms.Save(); err != nil {
+			return errors.Wrapf(err, "failed to save message status, MessageStatusID=%s", ms.ID)
+		}
+	}
+
+	// the messages already deleted by ack are registered again
+	for _, id := range snap.MessageIDs {
+		if !captured[id] {
+			continue
+		}
+		if err := s.restoreMessage(id); err != nil {
+			return err
+		}
+	}
+
+	s.store.notifier.notify(s.Name)
+	s.sendCurrentMessages()
+	return nil
+}
+
+// restoreMessage associate the Message pinned by the Snapshot to the Subscription again
+func (s *Subscription) restoreMessage(id string) error {
+	m, err := s.store.messages.Get(id)
+	if err != nil {
+		log.Printf("failed to get captured message, MessageID=%s, error=%v", id, err)
+		return nil
+	}
+	if err := m.AddSubscription(s.Name); err != nil {
+		return errors.Wrapf(err, "failed to save message, MessageID=%s", m.ID)
+	}
+	_, err = s.Message.NewMessageStatus(s.Name, m, s.DefaultAckDeadline, s.EnableMessageOrdering)
+	return err
+}
+
+// BySnapshotName implements sort.Interface for []*Snapshot based on the Name
+type BySnapshotName []*Snapshot
+
+func (a BySnapshotName) Len() int           { return len(a) }
+func (a BySnapshotName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a BySnapshotName) Less(i, j int) bool { return a[i].Name < a[j].Name }
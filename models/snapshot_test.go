@@ -0,0 +1,172 @@
+package models
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+	setupSubscription(t, "b", "A")
+	if _, err := testStore.NewSnapshot("exist", "a", 0); err != nil {
+		t.Fatalf("failed to create snapshot, got err %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		subID     string
+		expectErr bool
+	}{
+		{"new", "a", false},
+		{"exist", "b", true},
+		{"unknown", "unknown", true},
+	}
+	for i, c := range cases {
+		_, err := testStore.NewSnapshot(c.name, c.subID, 0)
+		if got := err != nil; got != c.expectErr {
+			t.Errorf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+	}
+}
+
+func TestSnapshotExpiration(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+	if _, err := testStore.NewSnapshot("short", "a", time.Minute); err != nil {
+		t.Fatalf("failed to create snapshot, got err %v", err)
+	}
+	if _, err := testStore.NewSnapshot("default", "a", 0); err != nil {
+		t.Fatalf("failed to create snapshot, got err %v", err)
+	}
+
+	now := time.Now()
+	cases := []struct {
+		input         time.Time
+		expectDeleted int
+		expectRemain  []string
+	}{
+		{now, 0, []string{"default", "short"}},
+		{now.Add(time.Hour), 1, []string{"default"}},
+		{now.Add(DefaultSnapshotExpiration + time.Hour), 1, []string{}},
+	}
+	for i, c := range cases {
+		got, err := testStore.SweepExpiredSnapshots(c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got != c.expectDeleted {
+			t.Errorf("#%d: want deleted %d, got %d", i, c.expectDeleted, got)
+		}
+		list, err := testStore.ListSnapshot()
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		names := []string{}
+		for _, s := range list {
+			names = append(names, s.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, c.expectRemain) {
+			t.Errorf("#%d: want %v, got %v", i, c.expectRemain, names)
+		}
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	cases := []struct {
+		retain bool
+		expect []string
+	}{
+		{true, []string{"captured", "acked after", "unacked after"}},
+		{false, []string{"captured", "unacked after"}},
+	}
+	for i, c := range cases {
+		setupDatastore(t)
+		setupDummyTopics(t)
+		if err := setupSubscription(t, "a", "A").SetRetainAckedMessages(c.retain); err != nil {
+			t.Fatalf("#%d: failed to set retain acked messages, got err %v", i, err)
+		}
+		setupSubscription(t, "b", "B")
+		publishMessage(t, "A", "captured", nil)
+		snap, err := testStore.NewSnapshot("snap", "a", 0)
+		if err != nil {
+			t.Fatalf("#%d: failed to create snapshot, got err %v", i, err)
+		}
+		publishMessage(t, "A", "acked after", nil)
+
+		// ack the captured message and the message published after the snapshot
+		sub := mustGetSubscription(t, "a")
+		msgs, err := sub.Pull(2)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		for _, m := range msgs {
+			if err := sub.Ack(m.AckID); err != nil {
+				t.Fatalf("#%d: failed to ack, got err %v", i, err)
+			}
+		}
+		publishMessage(t, "A", "unacked after", nil)
+		if err := sub.RestoreSnapshot(snap); err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		msgs, err = sub.Pull(3)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		got := []string{}
+		for _, m := range msgs {
+			got = append(got, string(m.Message.Data))
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+
+		// snapshot of the other topic
+		if err := mustGetSubscription(t, "b").RestoreSnapshot(snap); err != ErrMismatchSnapshot {
+			t.Errorf("#%d: want %v, got %v", i, ErrMismatchSnapshot, err)
+		}
+	}
+}
+
+func TestSnapshotPinMessage(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "a", "A")
+	id := publishMessage(t, "A", "captured", nil)
+	snap, err := testStore.NewSnapshot("snap", "a", 0)
+	if err != nil {
+		t.Fatalf("failed to create snapshot, got err %v", err)
+	}
+	sub := mustGetSubscription(t, "a")
+	msgs, err := sub.Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := sub.Ack(msgs[0].AckID); err != nil {
+		t.Fatalf("failed to ack, got err %v", err)
+	}
+
+	cases := []struct {
+		delete      bool
+		expectExist bool
+	}{
+		{false, true},
+		{true, false},
+	}
+	for i, c := range cases {
+		if c.delete {
+			if err := snap.Delete(); err != nil {
+				t.Fatalf("#%d: failed to delete snapshot, got err %v", i, err)
+			}
+		}
+		_, err := testStore.messages.Get(id)
+		if got := err == nil; got != c.expectExist {
+			t.Errorf("#%d: want exist %t, got err %v", i, c.expectExist, err)
+		}
+	}
+}
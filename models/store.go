@@ -0,0 +1,120 @@
+package models
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/datastore"
+	"github.com/takashabe/go-pubsub/stats"
+)
+
+// Store is the models on the single backend datastore, the Stores are isolated from each other.
+// the Topic, Subscription, Message and Snapshot loaded from the Store are belong to it.
+type Store struct {
+	backend datastore.Datastore
+
+	topics        *DatastoreTopic
+	subscriptions *DatastoreSubscription
+	messages      *DatastoreMessage
+	messageStatus *DatastoreMessageStatus
+	snapshots     *DatastoreSnapshot
+
+	// stream is the Stream delivering the messages, nil when the datastore is not the Stream
+	stream datastore.Stream
+	// notifier wake up pull requests waiting for the messages
+	notifier *messageNotifier
+	// exactlyOnceLocks serializes the delivery and the ack in the exactly once delivery Subscription
+	exactlyOnceLocks *subscriptionLocks
+	// clock generate the publish order of the Messages
+	clock *publishClock
+	// stats is the metrics of the Topics and Subscriptions in the Store
+	stats *stats.Stats
+
+	// done is closed by Close, stop the push loops and the sweeper
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStore return Store on the datastore loaded from the config
+func NewStore(cfg *datastore.Config) (*Store, error) {
+	d, err := datastore.LoadDatastore(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load datastore")
+	}
+	return NewStoreWithDatastore(d)
+}
+
+// NewStoreWithDatastore return Store on the datastore, and rebuild the index of the stored MessageStatus once
+func NewStoreWithDatastore(d datastore.Datastore) (*Store, error) {
+	st := &Store{
+		backend:          d,
+		notifier:         newMessageNotifier(),
+		exactlyOnceLocks: newSubscriptionLocks(),
+		clock:            &publishClock{},
+		stats:            stats.New(),
+		done:             make(chan struct{}),
+	}
+	st.topics = &DatastoreTopic{store: d, parent: st}
+	st.subscriptions = &DatastoreSubscription{store: d, parent: st}
+	st.messages = &DatastoreMessage{store: d, parent: st}
+	st.messageStatus = &DatastoreMessageStatus{store: d, parent: st}
+	st.snapshots = &DatastoreSnapshot{store: d, parent: st}
+	st.stream, _ = d.(datastore.Stream)
+
+	if err := st.migrateIndex(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// indexVersion is the version of the index of the stored entries, increment it to rebuild the index
+const indexVersion = 1
+
+// indexVersionKey is the key of the version of the rebuilt index
+const indexVersionKey = "index_version"
+
+// migrateIndex rebuild the index of the stored MessageStatus when the stored version is older than indexVersion,
+// the entries saved before the index are indexed once at the first start
+func (st *Store) migrateIndex() error {
+	v, err := st.backend.Get(indexVersionKey)
+	if err != nil && errors.Cause(err) != datastore.ErrNotFoundEntry {
+		return errors.Wrap(err, "failed to get index version")
+	}
+	if b, ok := v.([]byte); ok {
+		if current, err := strconv.Atoi(string(b)); err == nil && current >= indexVersion {
+			return nil
+		}
+	}
+	if err := st.messageStatus.RebuildIndex(); err != nil {
+		return errors.Wrap(err, "failed to rebuild message status index")
+	}
+	return st.backend.Set(indexVersionKey, []byte(strconv.Itoa(indexVersion)))
+}
+
+// Datastore return the backend datastore
+func (st *Store) Datastore() datastore.Datastore {
+	return st.backend
+}
+
+// Stats return the metrics of the Store
+func (st *Store) Stats() *stats.Stats {
+	return st.stats
+}
+
+// Close stop the push loops and the sweeper, and release the datastore.
+// the Store and the models loaded from it are no longer available
+func (st *Store) Close() error {
+	var err error
+	st.closeOnce.Do(func() {
+		close(st.done)
+		err = st.backend.Close()
+	})
+	return err
+}
+
+// newBatch return Batch for writing the entries of any type all-or-nothing,
+// all models datastore share the same backend
+func (st *Store) newBatch() datastore.Batch {
+	return st.backend.Batch()
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/datastore"
+)
+
+func TestStoreIsolation(t *testing.T) {
+	stores := make([]*Store, 0, 2)
+	for i := 0; i < 2; i++ {
+		s, err := NewStore(&datastore.Config{})
+		if err != nil {
+			t.Fatalf("#%d: failed to create store, got err %v", i, err)
+		}
+		stores = append(stores, s)
+	}
+	topic, err := stores[0].NewTopic("A")
+	if err != nil {
+		t.Fatalf("failed to create topic, got err %v", err)
+	}
+	if _, err := stores[0].NewSubscription("a", "A", 10, "", nil, ""); err != nil {
+		t.Fatalf("failed to create subscription, got err %v", err)
+	}
+	msgID, err := topic.Publish([]byte("test"), nil)
+	if err != nil {
+		t.Fatalf("failed to publish, got err %v", err)
+	}
+
+	cases := []struct {
+		store      *Store
+		expectErr  error
+		expectMsgs int
+	}{
+		{stores[0], nil, 1},
+		{stores[1], datastore.ErrNotFoundEntry, 0},
+	}
+	for i, c := range cases {
+		sub, err := c.store.GetSubscription("a")
+		if errors.Cause(err) != c.expectErr {
+			t.Fatalf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+		if _, err := c.store.messages.Get(msgID); (err == nil) != (c.expectMsgs > 0) {
+			t.Errorf("#%d: want message exist %v, got err %v", i, c.expectMsgs > 0, err)
+		}
+		if sub == nil {
+			continue
+		}
+		msgs, err := sub.Pull(10)
+		if err != nil {
+			t.Fatalf("#%d: failed to pull, got err %v", i, err)
+		}
+		if len(msgs) != c.expectMsgs {
+			t.Errorf("#%d: want %d messages, got %d", i, c.expectMsgs, len(msgs))
+		}
+	}
+}
+
+func TestMigrateIndex(t *testing.T) {
+	backend := datastore.NewMemory(nil)
+	// save MessageStatus without the index, same as the previous versions
+	saveRaw := func(id, ackID string) {
+		v, err := datastore.EncodeGob(&MessageStatus{ID: id, SubscriptionID: "a", AckID: ackID})
+		if err != nil {
+			t.Fatalf("failed to encode, got err %v", err)
+		}
+		if err := backend.Set("message_status_"+id, v); err != nil {
+			t.Fatalf("failed to set, got err %v", err)
+		}
+	}
+
+	cases := []struct {
+		id          string
+		expectIndex bool
+	}{
+		// rebuilt at the first start
+		{"first", true},
+		// not rebuilt after that
+		{"second", false},
+	}
+	for i, c := range cases {
+		saveRaw(c.id, "ack-"+c.id)
+		st, err := NewStoreWithDatastore(backend)
+		if err != nil {
+			t.Fatalf("#%d: failed to create store, got err %v", i, err)
+		}
+		_, err = st.messageStatus.FindByAckID("ack-" + c.id)
+		if got := err == nil; got != c.expectIndex {
+			t.Errorf("#%d: want indexed %t, got err %v", i, c.expectIndex, err)
+		}
+	}
+}
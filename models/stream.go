@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/datastore"
+)
+
+// streamName return the stream key of the Topic, not to overlap the prefix of the Topic entries
+func streamName(topicID string) string {
+	return "stream_" + topicID
+}
+
+// supportStream return ErrNotSupportStream when the feature is used on the stream datastore
+func (st *Store) supportStream(used bool) error {
+	if used && st.stream != nil {
+		return ErrNotSupportStream
+	}
+	return nil
+}
+
+// streamConsumer is the consumer name of this process in the consumer groups
+var streamConsumer = func() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}()
+
+// publishStream append the Message to the stream of the Topic, and notify to the matched Subscriptions
+func (t *Topic) publishStream(m *Message, subs []*Subscription) (string, error) {
+	v, err := datastore.EncodeGob(m)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode Message")
+	}
+	if _, err := t.store.stream.Append(streamName(t.Name), v); err != nil {
+		return "", errors.Wrap(err, "failed to append Message")
+	}
+	for _, s := range subs {
+		t.store.stats.GetSubscriptionAdapter().AddMessage(s.Name, 1)
+		t.store.notifier.notify(s.Name)
+	}
+	return m.ID, nil
+}
+
+// pullStream read the messages from the consumer group, the AckID is the entry ID.
+// the messages not matched the filter are acked without delivery.
+func (s *Subscription) pullStream(size int, deadline time.Duration) ([]*PullMessage, error) {
+	if s.Detached() {
+		return nil, ErrEmptyMessage
+	}
+	stream := streamName(s.TopicID)
+	entries, err := s.store.stream.Read(stream, s.Name, streamConsumer, size, deadline)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read stream, SubscriptionID=%s", s.Name)
+	}
+
+	res := make([]*PullMessage, 0, len(entries))
+	for _, e := range entries {
+		m, err := decodeGobMessage(e.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode Message, EntryID=%s", e.ID)
+		}
+		if !s.MatchFilter(m.Attributes) {
+			if err := s.store.stream.Ack(stream, s.Name, e.ID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		res = append(res, &PullMessage{AckID: e.ID, Message: m, DeliveryAttempt: e.DeliveryCount})
+	}
+	if len(res) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	return res, nil
+}
+
+// ackStream ack the entries of the consumer group
+func (s *Subscription) ackStream(ids ...string) error {
+	if s.Detached() {
+		return ErrNotFoundAckID
+	}
+	return s.store.stream.Ack(streamName(s.TopicID), s.Name, ids...)
+}
+
+// modifyAckDeadlineStream set the idle time of the entry to be redelivered after the timeout,
+// the timeout longer than the DefaultAckDeadline extends the entry until the deadline
+func (s *Subscription) modifyAckDeadlineStream(id string, timeout int64) error {
+	if s.Detached() {
+		return ErrNotFoundAckID
+	}
+	stream := streamName(s.TopicID)
+	var err error
+	if d := convertAckDeadlineSeconds(timeout); d > s.DefaultAckDeadline {
+		err = s.store.stream.Extend(stream, s.Name, streamConsumer, id, time.Now().Add(d))
+	} else {
+		err = s.store.stream.SetIdle(stream, s.Name, streamConsumer, id, s.DefaultAckDeadline-d)
+	}
+	if errors.Cause(err) == datastore.ErrNotFoundEntry {
+		return ErrNotFoundAckID
+	}
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		// nack, wake up waiting pull requests
+		s.store.notifier.notify(s.Name)
+	}
+	return nil
+}
+
+// SweepStreams trim the entries of the Topic streams delivered to all Subscriptions and acked,
+// do nothing when the datastore is not the Stream
+func (st *Store) SweepStreams() error {
+	if st.stream == nil {
+		return nil
+	}
+	topics, err := st.ListTopic()
+	if err != nil {
+		return errors.Wrap(err, "failed to list topic")
+	}
+	for _, t := range topics {
+		if err := st.stream.Trim(streamName(t.Name)); err != nil {
+			return errors.Wrapf(err, "failed to trim stream, TopicID=%s", t.Name)
+		}
+	}
+	return nil
+}
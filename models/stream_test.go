@@ -0,0 +1,172 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/datastore"
+)
+
+// setupStream setup datastore delivering by the MemoryStream, when the datastore is not the Stream
+func setupStream(t *testing.T) func() {
+	setupDatastore(t)
+	if testStore.stream != nil {
+		return func() {}
+	}
+	testStore.stream = datastore.NewMemoryStream(nil)
+	return func() { testStore.stream = nil }
+}
+
+func pullMessageData(msgs []*PullMessage) []string {
+	res := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		res = append(res, string(m.Message.Data))
+	}
+	return res
+}
+
+func TestStreamPullAndAck(t *testing.T) {
+	cases := []struct {
+		filter        string
+		publish       []map[string]string
+		expectData    []string
+		expectAttempt int
+	}{
+		{"", []map[string]string{nil, nil}, []string{"0", "1"}, 1},
+		{"attributes.key = \"a\"", []map[string]string{{"key": "b"}, {"key": "a"}}, []string{"1"}, 1},
+	}
+	for i, c := range cases {
+		teardown := setupStream(t)
+		setupDummyTopics(t)
+		sub, err := testStore.NewSubscription("a", "A", 10, "", nil, c.filter)
+		if err != nil {
+			t.Fatalf("#%d: failed to create subscription, got err %v", i, err)
+		}
+		for j, attr := range c.publish {
+			publishMessage(t, "A", string(rune('0'+j)), attr)
+		}
+
+		msgs, err := sub.Pull(10)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got := pullMessageData(msgs); !reflect.DeepEqual(got, c.expectData) {
+			t.Errorf("#%d: want messages %v, got %v", i, c.expectData, got)
+		}
+		for _, m := range msgs {
+			if m.DeliveryAttempt != c.expectAttempt {
+				t.Errorf("#%d: want delivery attempt %d, got %d", i, c.expectAttempt, m.DeliveryAttempt)
+			}
+			if err := sub.Ack(m.AckID); err != nil {
+				t.Fatalf("#%d: failed to ack, got err %v", i, err)
+			}
+		}
+		if _, err := sub.Pull(10); errors.Cause(err) != ErrEmptyMessage {
+			t.Errorf("#%d: want error %v, got %v", i, ErrEmptyMessage, err)
+		}
+		teardown()
+	}
+}
+
+func TestStreamModifyAckDeadline(t *testing.T) {
+	cases := []struct {
+		ackDeadline   int64
+		timeout       int64
+		expectPulled  bool
+		expectAttempt int
+	}{
+		{10, 0, true, 2},
+		{10, 10, false, 0},
+		// extended longer than the ack deadline of the Subscription
+		{0, 10, false, 0},
+	}
+	for i, c := range cases {
+		teardown := setupStream(t)
+		setupDummyTopics(t)
+		sub, err := testStore.NewSubscription("a", "A", c.ackDeadline, "", nil, "")
+		if err != nil {
+			t.Fatalf("#%d: failed to create subscription, got err %v", i, err)
+		}
+		publishMessage(t, "A", "test", nil)
+
+		msgs, err := sub.Pull(1)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if err := sub.ModifyAckDeadline(msgs[0].AckID, c.timeout); err != nil {
+			t.Fatalf("#%d: failed to modify ack deadline, got err %v", i, err)
+		}
+		msgs, err = sub.Pull(1)
+		if got := err == nil; got != c.expectPulled {
+			t.Fatalf("#%d: want pulled %t, got err %v", i, c.expectPulled, err)
+		}
+		if c.expectPulled && msgs[0].DeliveryAttempt != c.expectAttempt {
+			t.Errorf("#%d: want delivery attempt %d, got %d", i, c.expectAttempt, msgs[0].DeliveryAttempt)
+		}
+		teardown()
+	}
+}
+
+func TestStreamNotSupportPush(t *testing.T) {
+	teardown := setupStream(t)
+	defer teardown()
+	setupDummyTopics(t)
+
+	_, err := testStore.NewSubscription("a", "A", 10, "http://localhost:8080", nil, "")
+	if errors.Cause(err) != ErrNotSupportStreamPush {
+		t.Errorf("want error %v, got %v", ErrNotSupportStreamPush, err)
+	}
+}
+
+func TestStreamNotSupport(t *testing.T) {
+	teardown := setupStream(t)
+	defer teardown()
+	setupDummyTopics(t)
+	sub := setupSubscription(t, "a", "A")
+
+	cases := []struct {
+		fn func() error
+	}{
+		{func() error {
+			_, err := testStore.NewSubscriptionWithOptions("b", "A", SubscriptionOptions{EnableMessageOrdering: true})
+			return err
+		}},
+		{func() error { return sub.SetRetryPolicy(&RetryPolicy{MinimumBackoff: time.Second}) }},
+		{func() error { return sub.SetExactlyOnceDelivery(true) }},
+		{func() error { return mustGetTopic(t, "A").SetMessageRetentionDuration(time.Hour) }},
+		{func() error { return sub.Seek(time.Now()) }},
+		{func() error {
+			_, err := testStore.NewSnapshot("snap", "a", 0)
+			return err
+		}},
+	}
+	for i, c := range cases {
+		if err := c.fn(); errors.Cause(err) != ErrNotSupportStream {
+			t.Errorf("#%d: want error %v, got %v", i, ErrNotSupportStream, err)
+		}
+	}
+	// disable is allowed
+	if err := sub.SetExactlyOnceDelivery(false); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+}
+
+func TestSweepStreams(t *testing.T) {
+	teardown := setupStream(t)
+	defer teardown()
+	setupDummyTopics(t)
+	sub := setupSubscription(t, "a", "A")
+	publishMessage(t, "A", "1", nil)
+	msgs, err := sub.Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := sub.Ack(msgs[0].AckID); err != nil {
+		t.Fatalf("failed to ack, got err %v", err)
+	}
+	if err := testStore.SweepStreams(); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+}
@@ -1,12 +1,13 @@
 package models
 
 import (
+	"context"
 	"log"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
-	"github.com/takashabe/go-pubsub/stats"
+	"github.com/takashabe/go-pubsub/datastore"
 )
 
 // Subscription is subscription object
@@ -16,6 +17,28 @@ type Subscription struct {
 	Message            *MessageStatusStore `json:"-"`
 	DefaultAckDeadline time.Duration       `json:"ack_deadline_seconds"`
 	PushConfig         *Push               `json:"push_config"`
+	DeadLetterPolicy   *DeadLetterPolicy   `json:"dead_letter_policy"`
+	RetryPolicy        *RetryPolicy        `json:"retry_policy"`
+
+	// Filter is expression of the message attributes to receive
+	Filter string `json:"filter"`
+
+	// EnableMessageOrdering is deliver the messages with the same ordering key in publish order
+	EnableMessageOrdering bool `json:"enable_message_ordering"`
+
+	// EnableExactlyOnceDelivery is guarantee no redelivery after the successful ack
+	EnableExactlyOnceDelivery bool `json:"enable_exactly_once_delivery"`
+
+	// MessageRetentionDuration is retention duration of the unacked messages, 0 is used the Topic setting
+	MessageRetentionDuration time.Duration `json:"message_retention_duration"`
+
+	// RetainAckedMessages is keep the acked messages until exceeded the retention duration, to enable the Seek
+	RetainAckedMessages bool `json:"retain_acked_messages"`
+
+	// ExpirationPolicy is delete the Subscription after a period with no activity
+	ExpirationPolicy *ExpirationPolicy `json:"expiration_policy"`
+	// LastActivityAt is time of the last pull, ack or modify ack deadline
+	LastActivityAt time.Time `json:"last_activity_at"`
 
 	// push params
 	PushTick    time.Duration `json:"-"`
@@ -25,6 +48,8 @@ type Subscription struct {
 	abortMu     sync.RWMutex
 	runningMu   sync.RWMutex
 	sizeMu      sync.RWMutex
+
+	store *Store
 }
 
 // push variables
@@ -34,57 +59,191 @@ const (
 	MinPushSize  = 1
 )
 
-// NewSubscription return initialized subscription, if not exist already same name Subscription
-func NewSubscription(name, topicName string, timeout int64, endpoint string, attr map[string]string) (*Subscription, error) {
-	if _, err := GetSubscription(name); err == nil {
+// PullRecheckInterval is interval of the recheck readable messages while waiting pull,
+// it is necessary to pick up the messages that have passed the ack deadline
+const PullRecheckInterval = 1 * time.Second
+
+// NewSubscription return initialized subscription, if not exist already same name Subscription.
+// the filter is expression of the message attributes, empty filter is receive all messages.
+func (st *Store) NewSubscription(name, topicName string, timeout int64, endpoint string, attr map[string]string, filter string) (*Subscription, error) {
+	return st.NewSubscriptionWithOptions(name, topicName, SubscriptionOptions{
+		AckDeadline:    convertAckDeadlineSeconds(timeout),
+		PushEndpoint:   endpoint,
+		PushAttributes: attr,
+		Filter:         filter,
+	})
+}
+
+// SubscriptionOptions is the settings of the new Subscription
+type SubscriptionOptions struct {
+	AckDeadline    time.Duration
+	PushEndpoint   string
+	PushAttributes map[string]string
+	// Filter is expression of the message attributes, empty filter is receive all messages
+	Filter string
+
+	// the policies are nil when disabled
+	DeadLetterPolicy *DeadLetterPolicy
+	RetryPolicy      *RetryPolicy
+	ExpirationPolicy *ExpirationPolicy
+
+	EnableMessageOrdering     bool
+	EnableExactlyOnceDelivery bool
+
+	// MessageRetentionDuration is retention duration of the unacked messages, 0 is used the Topic setting
+	MessageRetentionDuration time.Duration
+	RetainAckedMessages      bool
+}
+
+// validate return error when any option is invalid
+func (o *SubscriptionOptions) validate(st *Store) error {
+	if _, err := ParseFilter(o.Filter); err != nil {
+		return err
+	}
+	if p := o.DeadLetterPolicy; p != nil {
+		if _, err := st.NewDeadLetterPolicy(p.DeadLetterTopic, p.MaxDeliveryAttempts); err != nil {
+			return err
+		}
+	}
+	if p := o.RetryPolicy; p != nil {
+		if _, err := NewRetryPolicy(p.MinimumBackoff, p.MaximumBackoff); err != nil {
+			return err
+		}
+	}
+	if p := o.ExpirationPolicy; p != nil {
+		if _, err := NewExpirationPolicy(p.TTL); err != nil {
+			return err
+		}
+	}
+	if o.MessageRetentionDuration < 0 {
+		return ErrInvalidRetentionDuration
+	}
+	return st.supportStream(o.DeadLetterPolicy != nil || o.RetryPolicy != nil ||
+		o.EnableMessageOrdering || o.EnableExactlyOnceDelivery ||
+		o.MessageRetentionDuration > 0 || o.RetainAckedMessages)
+}
+
+// NewSubscriptionWithOptions return initialized subscription, if not exist already same name Subscription.
+// all options are validated before saving, the invalid options leave nothing.
+func (st *Store) NewSubscriptionWithOptions(name, topicName string, opts SubscriptionOptions) (*Subscription, error) {
+	if _, err := st.GetSubscription(name); err == nil {
 		return nil, ErrAlreadyExistSubscription
 	}
-	topic, err := GetTopic(topicName)
+	topic, err := st.GetTopic(topicName)
 	if err != nil {
 		return nil, err
 	}
-	s := &Subscription{
-		Name:               name,
-		TopicID:            topic.Name,
-		Message:            NewMessageStatusStore(name),
-		DefaultAckDeadline: convertAckDeadlineSeconds(timeout),
-		PushTick:           PushInterval,
-		PushSize:           MinPushSize,
-	}
-	if err := s.SetPushConfig(endpoint, attr); err != nil {
+	if err := opts.validate(st); err != nil {
 		return nil, err
 	}
-	if err := s.Save(); err != nil {
+	push, err := NewPush(opts.PushEndpoint, opts.PushAttributes)
+	if err != nil {
 		return nil, err
 	}
+	if st.stream != nil && push.HasValidEndpoint() {
+		return nil, ErrNotSupportStreamPush
+	}
 
+	s := &Subscription{
+		Name:                      name,
+		TopicID:                   topic.Name,
+		Message:                   st.NewMessageStatusStore(name),
+		DefaultAckDeadline:        opts.AckDeadline,
+		PushConfig:                push,
+		DeadLetterPolicy:          opts.DeadLetterPolicy,
+		RetryPolicy:               opts.RetryPolicy,
+		Filter:                    opts.Filter,
+		EnableMessageOrdering:     opts.EnableMessageOrdering,
+		EnableExactlyOnceDelivery: opts.EnableExactlyOnceDelivery,
+		MessageRetentionDuration:  opts.MessageRetentionDuration,
+		RetainAckedMessages:       opts.RetainAckedMessages,
+		ExpirationPolicy:          opts.ExpirationPolicy,
+		PushTick:                  PushInterval,
+		PushSize:                  MinPushSize,
+		store:                     st,
+	}
+	if s.DefaultAckDeadline < 0 {
+		s.DefaultAckDeadline = 0
+	}
+	s.applyExactlyOnceAckDeadline()
+	if s.ExpirationPolicy != nil {
+		// the TTL is counted from the creation
+		s.LastActivityAt = time.Now()
+	}
+	if st.stream != nil {
+		if err := st.stream.CreateGroup(streamName(s.TopicID), s.Name); err != nil {
+			return nil, errors.Wrapf(err, "failed to create consumer group, SubscriptionID=%s", s.Name)
+		}
+	}
+	if err := s.Save(); err != nil {
+		return nil, err
+	}
+	if err := s.PushLoop(); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
 // GetSubscription return Subscription object
-func GetSubscription(name string) (*Subscription, error) {
-	return getGlobalSubscription().Get(name)
+func (st *Store) GetSubscription(name string) (*Subscription, error) {
+	return st.subscriptions.Get(name)
 }
 
-// Delete is delete subscription at globalSubscription
+// setStore set the Store to the Subscription and the MessageStatusStore
+func (s *Subscription) setStore(st *Store) {
+	s.store = st
+	if s.Message != nil {
+		s.Message.store = st
+	}
+}
+
+// Delete is delete subscription and the pending messages at the Store
 func (s *Subscription) Delete() error {
-	return getGlobalSubscription().Delete(s.Name)
+	if s.store.stream != nil {
+		if !s.Detached() {
+			if err := s.store.stream.DestroyGroup(streamName(s.TopicID), s.Name); err != nil {
+				return errors.Wrapf(err, "failed to destroy consumer group, SubscriptionID=%s", s.Name)
+			}
+		}
+	} else if err := s.purgeMessages(); err != nil {
+		return err
+	}
+	return s.store.subscriptions.Delete(s.Name)
 }
 
-// ListSubscription returns subscription list from globalSubscription
-func ListSubscription() ([]*Subscription, error) {
-	return getGlobalSubscription().List()
+// ListSubscription returns subscription list from the Store
+func (st *Store) ListSubscription() ([]*Subscription, error) {
+	return st.subscriptions.List()
+}
+
+// MatchFilter return whether the message attributes matched the Filter
+func (s *Subscription) MatchFilter(attr map[string]string) bool {
+	f, err := ParseFilter(s.Filter)
+	if err != nil {
+		log.Printf("failed to parse filter, subscription=%s, error=%v", s.Name, err)
+		return false
+	}
+	return f.Match(attr)
 }
 
 // RegisterMessage associate Message to Subscription
 func (s *Subscription) RegisterMessage(msg *Message) error {
-	if _, err := s.Message.NewMessageStatus(s.Name, msg.ID, s.DefaultAckDeadline); err != nil {
-		return err
-	}
-	if err := s.Save(); err != nil {
+	if _, err := s.Message.NewMessageStatus(s.Name, msg, s.DefaultAckDeadline, s.EnableMessageOrdering); err != nil {
 		return err
 	}
+	return s.notifyRegistered()
+}
+
+// registerMessageBatch add the MessageStatus of the Message to the Batch
+func (s *Subscription) registerMessageBatch(b datastore.Batch, msg *Message) error {
+	ms := s.Message.prepareMessageStatus(s.Name, msg, s.DefaultAckDeadline, s.EnableMessageOrdering)
+	return s.store.messageStatus.SetBatch(b, ms)
+}
+
+// notifyRegistered notify the registered message to the waiting pull, and push when push mode
+func (s *Subscription) notifyRegistered() error {
 	s.sendCurrentMessages()
+	s.store.notifier.notify(s.Name)
 
 	// push
 	if !s.isPullMode() {
@@ -97,26 +256,149 @@ func (s *Subscription) RegisterMessage(msg *Message) error {
 
 // PullMessage represent Message and AckID pair
 type PullMessage struct {
-	AckID   string   `json:"ack_id"`
-	Message *Message `json:"message"`
+	AckID           string   `json:"ack_id"`
+	Message         *Message `json:"message"`
+	DeliveryAttempt int      `json:"delivery_attempt"`
 }
 
-// Pull returns readable messages, and change message state
+// Pull returns readable messages, and change message state.
+// the messages exceeded max delivery attempts are forwarded to the dead letter topic,
+// and delivered as usual when failed to forward.
 func (s *Subscription) Pull(size int) ([]*PullMessage, error) {
-	msgs, err := s.Message.CollectReadableMessage(size)
+	return s.pull(size, s.DefaultAckDeadline)
+}
+
+// pull is Pull with the ack deadline of the delivered messages
+func (s *Subscription) pull(size int, deadline time.Duration) ([]*PullMessage, error) {
+	unlock := s.lockDelivery()
+	defer unlock()
+	s.touch()
+
+	if s.store.stream != nil {
+		return s.pullStream(size, deadline)
+	}
+	for {
+		msgs, statuses, err := s.deliverMessages(size, deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		pullMsgs := make([]*PullMessage, 0, len(msgs))
+		for i, m := range msgs {
+			ms := statuses[i]
+			if s.exceededDeliveryAttempts(ms) {
+				err := s.forwardDeadLetter(m, ms)
+				if err == nil {
+					continue
+				}
+				// deliver as usual, not to stop the Subscription by the dead letter topic
+				log.Printf("failed to forward dead letter, SubscriptionID=%s, MessageID=%s, error=%v", s.Name, m.ID, err)
+			}
+			pullMsgs = append(pullMsgs, &PullMessage{AckID: ms.AckID, Message: m, DeliveryAttempt: ms.DeliveryAttempt})
+		}
+		// retry when all messages forwarded to the dead letter topic
+		if len(pullMsgs) > 0 {
+			return pullMsgs, nil
+		}
+	}
+}
+
+// deliverMessages deliver readable messages with the new AckID, and return the Messages and the delivered MessageStatus.
+// when the datastore is able to lock, the messages are locked not to deliver the same messages by the other servers.
+// the ordered Subscription is delivered holding the lock of the Subscription instead,
+// the servers deliver it one by one to keep the order.
+func (s *Subscription) deliverMessages(size int, deadline time.Duration) ([]*Message, []*MessageStatus, error) {
+	l, ok := s.store.messageStatus.locker()
+	if !ok {
+		return s.deliverReadable(size, deadline)
+	}
+	if s.EnableMessageOrdering {
+		var (
+			msgs     []*Message
+			statuses []*MessageStatus
+		)
+		err := l.Lock(orderingLockName(s.Name), func() error {
+			var err error
+			msgs, statuses, err = s.deliverReadable(size, deadline)
+			return err
+		})
+		return msgs, statuses, err
+	}
+
+	statuses, err := s.Message.deliverLocked(l, size, deadline, s.RetryPolicy)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	msgs := make([]*Message, 0, len(statuses))
+	delivered := make([]*MessageStatus, 0, len(statuses))
+	for _, ms := range statuses {
+		m, err := s.store.messages.Get(ms.MessageID)
+		if err != nil {
+			log.Printf("failed to get message, id=%s, error=%v", ms.MessageID, err)
+			continue
+		}
+		msgs = append(msgs, m)
+		delivered = append(delivered, ms)
+	}
+	return msgs, delivered, nil
+}
 
-	pullMsgs := make([]*PullMessage, 0, len(msgs))
+// deliverReadable deliver the readable messages collected in the process
+func (s *Subscription) deliverReadable(size int, deadline time.Duration) ([]*Message, []*MessageStatus, error) {
+	msgs, err := s.Message.CollectReadableMessage(size)
+	if err != nil {
+		return nil, nil, err
+	}
+	statuses := make([]*MessageStatus, 0, len(msgs))
 	for _, m := range msgs {
-		ackID := makeAckID()
-		if err := s.Message.Deliver(m.ID, ackID); err != nil {
+		ms, err := s.Message.Deliver(m.ID, makeAckID(), deadline, s.RetryPolicy)
+		if err != nil {
+			return nil, nil, err
+		}
+		statuses = append(statuses, ms)
+	}
+	return msgs, statuses, nil
+}
+
+// orderingLockName return the lock name of the ordered Subscription
+func orderingLockName(sub string) string {
+	return "ordering_" + sub
+}
+
+// PullWait returns readable messages like Pull,
+// but when not exist readable messages, waits until registered new message or ctx is done
+func (s *Subscription) PullWait(ctx context.Context, size int) ([]*PullMessage, error) {
+	return s.pullWait(ctx, size, 0)
+}
+
+// pullWait is PullWait with the ack deadline at least minDeadline
+func (s *Subscription) pullWait(ctx context.Context, size int, minDeadline time.Duration) ([]*PullMessage, error) {
+	for {
+		// register waiter before the pull, not to miss the message registered meanwhile
+		wait := s.store.notifier.wait(s.Name)
+		deadline := s.DefaultAckDeadline
+		if deadline < minDeadline {
+			deadline = minDeadline
+		}
+		msgs, err := s.pull(size, deadline)
+		if errors.Cause(err) != ErrEmptyMessage {
+			return msgs, err
+		}
+
+		select {
+		case <-wait:
+		case <-time.After(PullRecheckInterval):
+		case <-ctx.Done():
+			return nil, ErrEmptyMessage
+		}
+
+		// refresh Subscription
+		sub, err := s.store.GetSubscription(s.Name)
+		if err != nil {
 			return nil, err
 		}
-		pullMsgs = append(pullMsgs, &PullMessage{AckID: ackID, Message: m})
+		s = sub
 	}
-	return pullMsgs, nil
 }
 
 // SentState is state of send push message
@@ -154,8 +436,19 @@ func (s *Subscription) Push(size int) (SentState, error) {
 	}
 	for _, msg := range msgs {
 		ackID := makeAckID()
-		s.Message.Deliver(msg.ID, ackID)
-		err := s.PushConfig.sendMessage(msg, s.Name)
+		ms, err := s.Message.Deliver(msg.ID, ackID, s.DefaultAckDeadline, s.RetryPolicy)
+		if err != nil {
+			return sentFailed, err
+		}
+		if s.exceededDeliveryAttempts(ms) {
+			err := s.forwardDeadLetter(msg, ms)
+			if err == nil {
+				continue
+			}
+			// push as usual, not to stop the Subscription by the dead letter topic
+			log.Printf("failed to forward dead letter, SubscriptionID=%s, MessageID=%s, error=%v", s.Name, msg.ID, err)
+		}
+		err = s.PushConfig.sendMessage(msg, s.Name)
 		if err != nil {
 			return sentFailed, err
 		}
@@ -167,9 +460,16 @@ func (s *Subscription) Push(size int) (SentState, error) {
 
 // Ack succeed Message delivery. remove sent Message.
 func (s *Subscription) Ack(ids ...string) error {
+	unlock := s.lockDelivery()
+	defer unlock()
+	s.touch()
+
+	if s.store.stream != nil {
+		return s.ackStream(ids...)
+	}
 	// collect MessageID list dependent to AckID
 	for _, id := range ids {
-		if err := s.Message.Ack(id); err != nil {
+		if err := s.ack(id); err != nil {
 			return err
 		}
 	}
@@ -178,14 +478,43 @@ func (s *Subscription) Ack(ids ...string) error {
 	return nil
 }
 
-// ModifyAckDeadline modify message ack deadline seconds
+// ModifyAckDeadline modify message ack deadline seconds, the deadline is counted from now
 func (s *Subscription) ModifyAckDeadline(id string, timeout int64) error {
+	unlock := s.lockDelivery()
+	defer unlock()
+	s.touch()
+
+	if s.store.stream != nil {
+		return s.modifyAckDeadlineStream(id, timeout)
+	}
+	if s.EnableExactlyOnceDelivery {
+		if err := s.validateAckID(id); err != nil {
+			return err
+		}
+	}
 	ms, err := s.Message.FindByAckID(id)
 	if err != nil {
 		return err
 	}
 	ms.AckDeadline = convertAckDeadlineSeconds(timeout)
-	return ms.Save()
+	ms.DeliveredAt = time.Now()
+	if err := ms.Save(); err != nil {
+		return err
+	}
+	if ms.Readable() {
+		// nack, wake up waiting pull requests
+		s.store.notifier.notify(s.Name)
+	}
+	return nil
+}
+
+// SetMessageOrdering setting message ordering, affect the messages published after this
+func (s *Subscription) SetMessageOrdering(enable bool) error {
+	if err := s.store.supportStream(enable); err != nil {
+		return err
+	}
+	s.EnableMessageOrdering = enable
+	return s.Save()
 }
 
 // SetPushConfig setting push endpoint with attributes
@@ -194,6 +523,9 @@ func (s *Subscription) SetPushConfig(endpoint string, attribute map[string]strin
 	if err != nil {
 		return err
 	}
+	if s.store.stream != nil && p.HasValidEndpoint() {
+		return ErrNotSupportStreamPush
+	}
 
 	s.PushConfig = p
 	if p.HasValidEndpoint() {
@@ -229,7 +561,7 @@ func (s *Subscription) PushLoop() error {
 	go func() {
 		for {
 			// refresh Subscription
-			s, err := GetSubscription(s.Name)
+			s, err := s.store.GetSubscription(s.Name)
 			if err != nil {
 				log.Println(err.Error())
 				break
@@ -252,7 +584,12 @@ func (s *Subscription) PushLoop() error {
 				s.decrementPushSize()
 			}
 
-			time.Sleep(s.PushTick)
+			select {
+			case <-s.store.done:
+				// the datastore is released, leave the running state as it is
+				return
+			case <-time.After(s.PushTick):
+			}
 		}
 
 		if err := s.teardownPushLoop(); err != nil {
@@ -264,7 +601,7 @@ func (s *Subscription) PushLoop() error {
 
 func (s *Subscription) teardownPushLoop() error {
 	// goroutine safe
-	s, err := GetSubscription(s.Name)
+	s, err := s.store.GetSubscription(s.Name)
 	if err != nil {
 		return err
 	}
@@ -326,7 +663,7 @@ func (s *Subscription) setSize(i int) error {
 	defer s.sizeMu.Unlock()
 
 	// goroutine safe
-	s, err := GetSubscription(s.Name)
+	s, err := s.store.GetSubscription(s.Name)
 	if err != nil {
 		return err
 	}
@@ -360,7 +697,7 @@ func convertAckDeadlineSeconds(timeout int64) time.Duration {
 
 // Save is save to datastore
 func (s *Subscription) Save() error {
-	return getGlobalSubscription().Set(s)
+	return s.store.subscriptions.Set(s)
 }
 
 func (s *Subscription) sendCurrentMessages() error {
@@ -370,9 +707,12 @@ func (s *Subscription) sendCurrentMessages() error {
 	}
 	var msgIDs []string
 	for _, msg := range msgs {
+		if msg.AckState == stateAck {
+			continue
+		}
 		msgIDs = append(msgIDs, msg.MessageID)
 	}
-	stats.GetSubscriptionAdapter().CurrentMessages(s.Name, msgIDs)
+	s.store.stats.GetSubscriptionAdapter().CurrentMessages(s.Name, msgIDs)
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -28,7 +29,7 @@ func TestNewSubscription(t *testing.T) {
 	expect1 := &Subscription{
 		Name:               "A",
 		TopicID:            "A",
-		Message:            NewMessageStatusStore("A"),
+		Message:            testStore.NewMessageStatusStore("A"),
 		DefaultAckDeadline: 0,
 		PushConfig: &Push{
 			Endpoint: testURL(t, "localhost:8080"),
@@ -39,6 +40,7 @@ func TestNewSubscription(t *testing.T) {
 		PushRunning: true,
 		PushTick:    PushInterval,
 		PushSize:    MinPushSize,
+		store:       testStore,
 	}
 
 	cases := []struct {
@@ -72,7 +74,7 @@ func TestNewSubscription(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		got, err := NewSubscription(c.name, c.topicName, c.timeout, c.endpoint, c.attr)
+		got, err := testStore.NewSubscription(c.name, c.topicName, c.timeout, c.endpoint, c.attr, "")
 		if errors.Cause(err) != c.expectErr {
 			t.Fatalf("#%d: want %v, got %v", i, c.expectErr, err)
 		}
@@ -82,12 +84,87 @@ func TestNewSubscription(t *testing.T) {
 	}
 }
 
+func TestNewSubscriptionWithOptions(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+
+	cases := []struct {
+		name      string
+		opts      SubscriptionOptions
+		expectErr error
+	}{
+		{
+			"A",
+			SubscriptionOptions{
+				AckDeadline:               10 * time.Second,
+				DeadLetterPolicy:          &DeadLetterPolicy{DeadLetterTopic: "B", MaxDeliveryAttempts: 5},
+				RetryPolicy:               &RetryPolicy{MinimumBackoff: time.Second, MaximumBackoff: time.Minute},
+				ExpirationPolicy:          &ExpirationPolicy{TTL: time.Hour},
+				EnableMessageOrdering:     true,
+				EnableExactlyOnceDelivery: true,
+				MessageRetentionDuration:  time.Hour,
+				RetainAckedMessages:       true,
+			},
+			nil,
+		},
+		{
+			"B",
+			SubscriptionOptions{DeadLetterPolicy: &DeadLetterPolicy{DeadLetterTopic: "Z", MaxDeliveryAttempts: 5}},
+			datastore.ErrNotFoundEntry,
+		},
+		{
+			"B",
+			SubscriptionOptions{RetryPolicy: &RetryPolicy{MinimumBackoff: time.Minute, MaximumBackoff: time.Second}},
+			ErrInvalidRetryPolicy,
+		},
+		{
+			"B",
+			SubscriptionOptions{ExpirationPolicy: &ExpirationPolicy{}},
+			ErrInvalidExpirationPolicy,
+		},
+		{
+			"B",
+			SubscriptionOptions{MessageRetentionDuration: -1},
+			ErrInvalidRetentionDuration,
+		},
+	}
+	for i, c := range cases {
+		_, err := testStore.NewSubscriptionWithOptions(c.name, "A", c.opts)
+		if errors.Cause(err) != c.expectErr {
+			t.Fatalf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+		got, err := testStore.GetSubscription(c.name)
+		if c.expectErr != nil {
+			// the invalid options leave nothing
+			if err == nil {
+				t.Errorf("#%d: want not saved subscription, got %v", i, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if !reflect.DeepEqual(got.DeadLetterPolicy, c.opts.DeadLetterPolicy) ||
+			!reflect.DeepEqual(got.RetryPolicy, c.opts.RetryPolicy) ||
+			!reflect.DeepEqual(got.ExpirationPolicy, c.opts.ExpirationPolicy) ||
+			got.EnableMessageOrdering != c.opts.EnableMessageOrdering ||
+			got.EnableExactlyOnceDelivery != c.opts.EnableExactlyOnceDelivery ||
+			got.MessageRetentionDuration != c.opts.MessageRetentionDuration ||
+			got.RetainAckedMessages != c.opts.RetainAckedMessages {
+			t.Errorf("#%d: want options %#v, got %#v", i, c.opts, got)
+		}
+		if got.LastActivityAt.IsZero() {
+			t.Errorf("#%d: want activity time for the expiration policy", i)
+		}
+	}
+}
+
 func TestDeleteSubscription(t *testing.T) {
 	setupDatastore(t)
-	subA := &Subscription{Name: "A", TopicID: "a"}
-	subB := &Subscription{Name: "B", TopicID: "a"}
-	globalSubscription.Set(subA)
-	globalSubscription.Set(subB)
+	subA := &Subscription{Name: "A", TopicID: "a", store: testStore}
+	subB := &Subscription{Name: "B", TopicID: "a", store: testStore}
+	testStore.subscriptions.Set(subA)
+	testStore.subscriptions.Set(subB)
 
 	cases := []struct {
 		input          *Subscription
@@ -103,7 +180,7 @@ func TestDeleteSubscription(t *testing.T) {
 			t.Errorf("#%d: want no error, got %v", i, err)
 		}
 		names := []string{}
-		if list, err := ListSubscription(); err != nil {
+		if list, err := testStore.ListSubscription(); err != nil {
 			t.Fatalf("#%d: want no error, got %v", i, err)
 		} else {
 			for _, s := range list {
@@ -122,7 +199,7 @@ func TestPullAndAck(t *testing.T) {
 	setupDummySubscription(t)
 
 	// faster for test
-	if s, err := GetSubscription("a"); err != nil {
+	if s, err := testStore.GetSubscription("a"); err != nil {
 		t.Fatalf("failed to get Subscription, got error %v", err)
 	} else {
 		s.DefaultAckDeadline = 100 * time.Millisecond
@@ -135,7 +212,7 @@ func TestPullAndAck(t *testing.T) {
 	msgID := publishMessage(t, "A", "test", nil)
 
 	// collect a message
-	sub, err := GetSubscription("a") // get updated Subscription
+	sub, err := testStore.GetSubscription("a") // get updated Subscription
 	if err != nil {
 		t.Fatalf("failed to get Subscription, got error %v", err)
 	}
@@ -168,7 +245,7 @@ func TestPullAndAck(t *testing.T) {
 
 	// pull and none send ack, retry pull
 	publishMessage(t, "A", "test", nil)
-	sub, err = GetSubscription("a") // get updated Subscription
+	sub, err = testStore.GetSubscription("a") // get updated Subscription
 	if err != nil {
 		t.Fatalf("failed to get Subscription, got error %v", err)
 	}
@@ -203,6 +280,39 @@ func TestPullAndAck(t *testing.T) {
 	}()
 }
 
+func TestPullWait(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupDummySubscription(t)
+
+	// timeout at empty subscription
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := mustGetSubscription(t, "a").PullWait(ctx, 1)
+	if err != ErrEmptyMessage {
+		t.Errorf("want %v, got %v", ErrEmptyMessage, err)
+	}
+
+	// wake up by the publish
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		publishMessage(t, "A", "test", nil)
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	begin := time.Now()
+	msgs, err := mustGetSubscription(t, "a").PullWait(ctx, 1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if want := 1; len(msgs) != want {
+		t.Errorf("want len %d, got len %d", want, len(msgs))
+	}
+	if elapsed := time.Since(begin); elapsed >= PullRecheckInterval {
+		t.Errorf("want wake up before recheck interval, got elapsed %v", elapsed)
+	}
+}
+
 func TestPushImmediately(t *testing.T) {
 	setupDatastore(t)
 	setupDummyTopics(t)
@@ -224,7 +334,7 @@ func TestPushImmediately(t *testing.T) {
 	}
 
 	// not exist message when push and ack message
-	_, err = getGlobalMessageStatus().FindBySubscriptionIDAndMessageID("a", msgID)
+	_, err = testStore.messageStatus.FindBySubscriptionIDAndMessageID("a", msgID)
 	if err != ErrNotFoundEntry {
 		t.Errorf("error want %s , got %s", ErrNotFoundEntry, err)
 	}
@@ -263,7 +373,7 @@ func TestPushLoop(t *testing.T) {
 	waitPushRunningDisable(t, "a")
 
 	// want empty message
-	list, err := getGlobalMessageStatus().collectByField(func(ms *MessageStatus) bool {
+	list, err := testStore.messageStatus.collectByField(func(ms *MessageStatus) bool {
 		return ms.SubscriptionID == sub.Name
 	})
 	if err != nil {
@@ -308,7 +418,7 @@ func TestPushLoopIncrement(t *testing.T) {
 	waitPushRunningDisable(t, "a")
 
 	// want empty message
-	list, err := getGlobalMessageStatus().collectByField(func(ms *MessageStatus) bool {
+	list, err := testStore.messageStatus.collectByField(func(ms *MessageStatus) bool {
 		return ms.SubscriptionID == sub.Name
 	})
 	if err != nil {
@@ -362,7 +472,7 @@ func TestPushLoopDecrement(t *testing.T) {
 	waitPushRunningDisable(t, "a")
 
 	// want fullsize message
-	list, err := getGlobalMessageStatus().collectByField(func(ms *MessageStatus) bool {
+	list, err := testStore.messageStatus.collectByField(func(ms *MessageStatus) bool {
 		return ms.SubscriptionID == sub.Name
 	})
 	if err != nil {
@@ -377,3 +487,71 @@ func TestPushLoopDecrement(t *testing.T) {
 		t.Errorf("want push size = %d, got %d", MinPushSize, got)
 	}
 }
+
+func TestPullOrdering(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "ordered", "A")
+	setupSubscription(t, "unordered", "A")
+	if err := mustGetSubscription(t, "ordered").SetMessageOrdering(true); err != nil {
+		t.Fatalf("failed to set message ordering, got err %v", err)
+	}
+
+	inputs := []struct {
+		data string
+		key  string
+	}{
+		{"1", "x"},
+		{"2", "x"},
+		{"3", "y"},
+		{"4", ""},
+		{"5", "x"},
+	}
+	for _, in := range inputs {
+		if _, err := mustGetTopic(t, "A").PublishWithOrderingKey([]byte(in.data), nil, in.key); err != nil {
+			t.Fatalf("failed to publish, got err %v", err)
+		}
+	}
+	pullData := func(sub *Subscription) ([]string, []string) {
+		msgs, err := sub.Pull(10)
+		if err != nil && err != ErrEmptyMessage {
+			t.Fatalf("failed to pull, got err %v", err)
+		}
+		data := []string{}
+		ackIDs := []string{}
+		for _, m := range msgs {
+			data = append(data, string(m.Message.Data))
+			ackIDs = append(ackIDs, m.AckID)
+		}
+		return data, ackIDs
+	}
+
+	// disabled ordering, receive all messages in publish order
+	if got, _ := pullData(mustGetSubscription(t, "unordered")); !reflect.DeepEqual(got, []string{"1", "2", "3", "4", "5"}) {
+		t.Errorf("want all messages in publish order, got %v", got)
+	}
+
+	// enabled ordering, receive the head of the each keys
+	sub := mustGetSubscription(t, "ordered")
+	cases := []struct {
+		expect []string
+	}{
+		{[]string{"1", "3", "4"}},
+		{[]string{"2"}},
+		{[]string{"5"}},
+		{[]string{}},
+	}
+	for i, c := range cases {
+		got, ackIDs := pullData(sub)
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+		// next message of the key is not readable until ack
+		if again, _ := pullData(sub); len(again) != 0 {
+			t.Errorf("#%d: want no messages before ack, got %v", i, again)
+		}
+		if err := sub.Ack(ackIDs...); err != nil {
+			t.Fatalf("#%d: failed to ack, got err %v", i, err)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package models
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	fixture "github.com/takashabe/go-fixture"
 	_ "github.com/takashabe/go-fixture/mysql" // mysql driver
 	"github.com/takashabe/go-pubsub/datastore"
+	bolt "go.etcd.io/bbolt"
 )
 
 func createDatastoreConfig(t *testing.T) *datastore.Config {
@@ -20,6 +22,27 @@ func createDatastoreConfig(t *testing.T) *datastore.Config {
 				Password: getEnvWithDefault("DB_PASSWORD", ""),
 			},
 		}
+	case "postgres":
+		return &datastore.Config{
+			Postgres: &datastore.PostgresConfig{
+				Addr:     "localhost:5432",
+				User:     getEnvWithDefault("PG_USER", "pubsub"),
+				Password: getEnvWithDefault("PG_PASSWORD", ""),
+			},
+		}
+	case "file":
+		return &datastore.Config{
+			File: &datastore.FileConfig{
+				Path: filepath.Join(os.TempDir(), "go-pubsub-models-test.db"),
+			},
+		}
+	case "redis-stream":
+		return &datastore.Config{
+			Redis: &datastore.RedisConfig{
+				Addr: "localhost:6379",
+				Mode: datastore.RedisStreamMode,
+			},
+		}
 	case "redis":
 		// TODO: specifiable redis config
 
@@ -44,30 +67,37 @@ func getEnvWithDefault(env, def string) string {
 	return def
 }
 
-func setupDatastore(t *testing.T) {
-	cfg := createDatastoreConfig(t)
-	datastore.GlobalConfig = cfg
+// truncatePostgres clear all tables of the Postgres
+const truncatePostgres = `TRUNCATE pubsub, pubsub_unique_index, pubsub_sorted_index,
+	topics, subscriptions, messages, message_statuses, snapshots`
 
-	// setup global variables
-	if err := InitDatastoreTopic(); err != nil {
-		t.Fatal(err)
-	}
-	if err := InitDatastoreSubscription(); err != nil {
-		t.Fatal(err)
-	}
-	if err := InitDatastoreMessage(); err != nil {
-		t.Fatal(err)
-	}
-	if err := InitDatastoreMessageStatus(); err != nil {
-		t.Fatal(err)
-	}
+// testStore is the Store initialized by setupDatastore
+var testStore *Store
 
-	// flush datastore
-	d, err := datastore.LoadDatastore(datastore.GlobalConfig)
+func setupDatastore(t *testing.T) {
+	d, err := datastore.LoadDatastore(createDatastoreConfig(t))
 	if err != nil {
 		t.Fatalf("failed to load datastore, got err %v", err)
 	}
+	flushDatastore(t, d)
+
+	testStore, err = NewStoreWithDatastore(d)
+	if err != nil {
+		t.Fatalf("failed to create store, got err %v", err)
+	}
+}
+
+// flushDatastore delete all entries of the datastore
+func flushDatastore(t *testing.T, d datastore.Datastore) {
 	switch a := d.(type) {
+	case *datastore.RedisStream:
+		conn := a.Pool.Get()
+		defer conn.Close()
+
+		_, err := conn.Do("FLUSHDB")
+		if err != nil {
+			t.Fatalf("failed to FLUSHDB on Redis, got error %v", err)
+		}
 	case *datastore.Redis:
 		conn := a.Pool.Get()
 		defer conn.Close()
@@ -84,20 +114,48 @@ func setupDatastore(t *testing.T) {
 		if err := f.LoadSQL("fixture/setup_table.sql"); err != nil {
 			t.Fatalf("failed to execute fixture, got err %v", err)
 		}
+	case *datastore.Postgres:
+		if _, err := a.Conn.Exec(truncatePostgres); err != nil {
+			t.Fatalf("failed to truncate tables, got err %v", err)
+		}
+	case *datastore.File:
+		if err := flushFile(a.DB); err != nil {
+			t.Fatalf("failed to flush file, got err %v", err)
+		}
 	}
 }
 
+// flushFile recreate all buckets of the File
+func flushFile(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		names := make([][]byte, 0)
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte{}, name...))
+			return nil
+		})
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func setupDatastoreAndSetTopics(t *testing.T, names ...string) {
 	setupDatastore(t)
 	for _, v := range names {
-		if _, err := NewTopic(v); err != nil {
+		if _, err := testStore.NewTopic(v); err != nil {
 			t.Fatalf("failed to new topic, got err %v", err)
 		}
 	}
 }
 
 func setupTopic(t *testing.T, name string) *Topic {
-	topic, err := NewTopic(name)
+	topic, err := testStore.NewTopic(name)
 	if err != nil {
 		t.Fatalf("failed to create topic, key=%s", name)
 	}
@@ -113,7 +171,7 @@ func setupDummyTopics(t *testing.T) {
 
 // publishMessage requires Topic
 func publishMessage(t *testing.T, topicID, message string, attr map[string]string) string {
-	top, err := GetTopic(topicID)
+	top, err := testStore.GetTopic(topicID)
 	if err != nil {
 		t.Fatalf("failed to get topic, got error %v", err)
 	}
@@ -126,7 +184,7 @@ func publishMessage(t *testing.T, topicID, message string, attr map[string]strin
 
 // setupSubscription requires Topic
 func setupSubscription(t *testing.T, name, topicName string) *Subscription {
-	s, err := NewSubscription(name, topicName, 10, "", nil)
+	s, err := testStore.NewSubscription(name, topicName, 10, "", nil, "")
 	if err != nil {
 		t.Fatalf("failed to cretae Subscription, got error %v", err)
 	}
@@ -141,7 +199,7 @@ func setupDummySubscription(t *testing.T) {
 }
 
 func mustGetTopic(t *testing.T, id string) *Topic {
-	a, err := GetTopic(id)
+	a, err := testStore.GetTopic(id)
 	if err != nil {
 		t.Fatalf("failed to get topic, got err %v", err)
 	}
@@ -149,7 +207,7 @@ func mustGetTopic(t *testing.T, id string) *Topic {
 }
 
 func mustGetSubscription(t *testing.T, id string) *Subscription {
-	a, err := GetSubscription(id)
+	a, err := testStore.GetSubscription(id)
 	if err != nil {
 		t.Fatalf("failed to get subscription, got err %v", err)
 	}
@@ -1,22 +1,52 @@
 package models
 
 import (
+	"log"
+	"time"
+
 	"github.com/pkg/errors"
-	"github.com/takashabe/go-pubsub/stats"
 )
 
 // Topic is topic object
 type Topic struct {
 	Name string `json:"name"`
+
+	// MessageRetentionDuration is retention duration of the unacked messages, 0 is unlimited
+	MessageRetentionDuration time.Duration `json:"message_retention_duration"`
+
+	store *Store
+}
+
+// TopicOptions is the settings of the new Topic
+type TopicOptions struct {
+	// MessageRetentionDuration is retention duration of the unacked messages, 0 is unlimited
+	MessageRetentionDuration time.Duration
+}
+
+// NewTopic return initialized topic, if not exist already topic name in the Store
+func (st *Store) NewTopic(name string) (*Topic, error) {
+	return st.NewTopicWithOptions(name, TopicOptions{})
 }
 
-// NewTopic return initialized topic, if not exist already topic name in GlobalTopics
-func NewTopic(name string) (*Topic, error) {
-	if _, err := GetTopic(name); err == nil {
+// NewTopicWithOptions return initialized topic with the options, if not exist already topic name in the Store.
+// the Topic is saved once after validating the options
+func (st *Store) NewTopicWithOptions(name string, opts TopicOptions) (*Topic, error) {
+	if name == DeletedTopicID {
+		return nil, ErrReservedTopicName
+	}
+	if _, err := st.GetTopic(name); err == nil {
 		return nil, ErrAlreadyExistTopic
 	}
+	if opts.MessageRetentionDuration < 0 {
+		return nil, ErrInvalidRetentionDuration
+	}
+	if err := st.supportStream(opts.MessageRetentionDuration > 0); err != nil {
+		return nil, err
+	}
 	t := &Topic{
-		Name: name,
+		Name:                     name,
+		MessageRetentionDuration: opts.MessageRetentionDuration,
+		store:                    st,
 	}
 	if err := t.Save(); err != nil {
 		return nil, errors.Wrapf(err, "failed to save topic, name=%s", name)
@@ -25,49 +55,115 @@ func NewTopic(name string) (*Topic, error) {
 }
 
 // GetTopic return topic object
-func GetTopic(name string) (*Topic, error) {
-	return globalTopics.Get(name)
+func (st *Store) GetTopic(name string) (*Topic, error) {
+	return st.topics.Get(name)
 }
 
 // ListTopic returns topic list
-func ListTopic() ([]*Topic, error) {
-	return globalTopics.List()
-}
-
-// Delete topic object at GlobalTopics
-func (t *Topic) Delete() error {
-	return globalTopics.Delete(t.Name)
+func (st *Store) ListTopic() ([]*Topic, error) {
+	return st.topics.List()
 }
 
 // Publish create message and deliver to subscription, and return created message id
 func (t *Topic) Publish(data []byte, attr map[string]string) (string, error) {
-	subList, err := t.GetSubscriptions()
+	return t.PublishWithOrderingKey(data, attr, "")
+}
+
+// PublishWithOrderingKey is Publish with the ordering key,
+// the messages with the same key are delivered in publish order to the ordering enabled Subscription.
+// the message is not stored when no Subscription receive it, the Seek and the retention do not keep it.
+func (t *Topic) PublishWithOrderingKey(data []byte, attr map[string]string, orderingKey string) (string, error) {
+	ids, err := t.PublishBatch([]*PublishMessage{{Data: data, Attributes: attr, OrderingKey: orderingKey}})
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+// PublishMessage represent the message published by PublishBatch
+type PublishMessage struct {
+	Data        []byte
+	Attributes  map[string]string
+	OrderingKey string
+}
+
+// PublishBatch publish the messages in order, and return created message ids.
+// the messages and the fan-out to the Subscriptions are saved all-or-nothing, except on the stream datastore
+func (t *Topic) PublishBatch(msgs []*PublishMessage) ([]string, error) {
+	subs, err := t.GetSubscriptions()
 	if err != nil {
-		return "", errors.Wrap(err, "failed GetSubscriptions")
+		return nil, errors.Wrap(err, "failed GetSubscriptions")
 	}
 
-	// TODO: need transaction
-	m := NewMessage(makeMessageID(), data, attr, subList)
-	if err := m.Save(); err != nil {
-		return "", errors.Wrap(err, "failed save Message")
+	ids := make([]string, 0, len(msgs))
+	registered := make([][]*Subscription, 0, len(msgs))
+	b := t.store.newBatch()
+	for _, pm := range msgs {
+		// register the message only to the Subscription matched the filter
+		subList := make([]*Subscription, 0, len(subs))
+		for _, s := range subs {
+			if !s.MatchFilter(pm.Attributes) {
+				t.store.stats.GetSubscriptionAdapter().AddFilteredMessage(s.Name, 1)
+				continue
+			}
+			subList = append(subList, s)
+		}
+
+		m := NewMessage(makeMessageID(), pm.Data, pm.Attributes, subList)
+		m.OrderingKey = pm.OrderingKey
+		m.PublishOrder = t.store.clock.next(m.PublishedAt)
+		m.store = t.store
+		if t.store.stream != nil {
+			id, err := t.publishStream(m, subList)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+			continue
+		}
+		ids = append(ids, m.ID)
+		if len(subList) == 0 {
+			// no one receive the message, not to leave the message never deleted
+			continue
+		}
+
+		if err := t.store.messages.SetBatch(b, m); err != nil {
+			return nil, errors.Wrap(err, "failed to encode Message")
+		}
+		for _, s := range subList {
+			if err := s.registerMessageBatch(b, m); err != nil {
+				return nil, errors.Wrapf(err, "failed to register Message, SubscriptionID=%s", s.Name)
+			}
+		}
+		registered = append(registered, subList)
 	}
-	for _, s := range subList {
-		if err := s.RegisterMessage(m); err != nil {
-			return "", err
+	if len(registered) == 0 {
+		return ids, nil
+	}
+	if err := b.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit Message")
+	}
+
+	// the messages are already saved, the failure of the push is retried by the push loop
+	for _, subList := range registered {
+		for _, s := range subList {
+			t.store.stats.GetSubscriptionAdapter().AddMessage(s.Name, 1)
+			if err := s.notifyRegistered(); err != nil {
+				log.Printf("failed to push message, SubscriptionID=%s, error=%v", s.Name, err)
+			}
 		}
-		stats.GetSubscriptionAdapter().AddMessage(s.Name, 1)
 	}
-	return m.ID, nil
+	return ids, nil
 }
 
 // GetSubscriptions returns topic dependent Subscription list
 func (t *Topic) GetSubscriptions() ([]*Subscription, error) {
-	return getGlobalSubscription().CollectByTopicID(t.Name)
+	return t.store.subscriptions.CollectByTopicID(t.Name)
 }
 
 // Save save to datastore
 func (t *Topic) Save() error {
-	return globalTopics.Set(t)
+	return t.store.topics.Set(t)
 }
 
 // ByTopicName is implements sort.Interface for []*Topic based on the ID
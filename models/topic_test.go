@@ -1,7 +1,9 @@
 package models
 
 import (
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/datastore"
@@ -23,19 +25,24 @@ func TestNewTopic(t *testing.T) {
 			ErrAlreadyExistTopic,
 			[]string{"a"},
 		},
+		{
+			[]string{DeletedTopicID},
+			ErrReservedTopicName,
+			[]string{},
+		},
 	}
 	for i, c := range cases {
 		setupDatastore(t)
 		var err error
 		for _, s := range c.inputs {
 			// expect last input return value equal expectErr
-			_, err = NewTopic(s)
+			_, err = testStore.NewTopic(s)
 		}
 		if err != c.expectErr {
 			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
 		}
 
-		list, err := globalTopics.List()
+		list, err := testStore.topics.List()
 		if err != nil {
 			t.Fatalf("#%d: want no error, got %v", i, err)
 		}
@@ -43,13 +50,46 @@ func TestNewTopic(t *testing.T) {
 			t.Fatalf("#%d: want %d, got %d", i, len(c.expectExistTopics), len(list))
 		}
 		for i2, s := range c.expectExistTopics {
-			if _, err = globalTopics.Get(s); err != nil {
+			if _, err = testStore.topics.Get(s); err != nil {
 				t.Errorf("#%d-%d: key %s want no error, got %v", i, i2, s, err)
 			}
 		}
 	}
 }
 
+func TestNewTopicWithOptions(t *testing.T) {
+	cases := []struct {
+		input      TopicOptions
+		expectErr  error
+		expectSave bool
+	}{
+		{TopicOptions{}, nil, true},
+		{TopicOptions{MessageRetentionDuration: time.Hour}, nil, true},
+		{TopicOptions{MessageRetentionDuration: -1}, ErrInvalidRetentionDuration, false},
+	}
+	for i, c := range cases {
+		setupDatastore(t)
+		_, err := testStore.NewTopicWithOptions("a", c.input)
+		if errors.Cause(err) != c.expectErr {
+			t.Fatalf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+
+		got, err := testStore.topics.Get("a")
+		if !c.expectSave {
+			if errors.Cause(err) != datastore.ErrNotFoundEntry {
+				t.Errorf("#%d: want not saved topic, got %v", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got.MessageRetentionDuration != c.input.MessageRetentionDuration {
+			t.Errorf("#%d: want %v, got %v", i, c.input.MessageRetentionDuration, got.MessageRetentionDuration)
+		}
+	}
+}
+
 func TestGetTopic(t *testing.T) {
 	setupDatastore(t)
 	setupDummyTopics(t)
@@ -63,7 +103,7 @@ func TestGetTopic(t *testing.T) {
 		{"D", "", datastore.ErrNotFoundEntry},
 	}
 	for i, c := range cases {
-		got, err := GetTopic(c.input)
+		got, err := testStore.GetTopic(c.input)
 		if errors.Cause(err) != c.expectErr {
 			t.Fatalf("#%d: want %v, got %v", i, c.expectErr, err)
 		}
@@ -72,3 +112,87 @@ func TestGetTopic(t *testing.T) {
 		}
 	}
 }
+
+func TestPublishWithFilter(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	if _, err := testStore.NewSubscription("all", "A", 10, "", nil, ""); err != nil {
+		t.Fatalf("failed to create subscription, got err %v", err)
+	}
+	if _, err := testStore.NewSubscription("order", "A", 10, "", nil, `attributes.type = "order"`); err != nil {
+		t.Fatalf("failed to create subscription, got err %v", err)
+	}
+	if _, err := testStore.NewSubscription("invalid", "A", 10, "", nil, `type = "order"`); errors.Cause(err) != ErrInvalidFilter {
+		t.Fatalf("want %v, got %v", ErrInvalidFilter, err)
+	}
+
+	orderID := publishMessage(t, "A", "order", map[string]string{"type": "order"})
+	userID := publishMessage(t, "A", "user", map[string]string{"type": "user"})
+
+	cases := []struct {
+		sub    string
+		expect []string
+	}{
+		{"all", []string{orderID, userID}},
+		{"order", []string{orderID}},
+	}
+	for i, c := range cases {
+		msgs, err := mustGetSubscription(t, c.sub).Message.CollectReadableMessage(10)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		got := []string{}
+		for _, m := range msgs {
+			got = append(got, m.ID)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+
+	// filtered message is not depend to the subscription
+	m, err := testStore.messages.Get(userID)
+	if err != nil {
+		t.Fatalf("failed to get message, got err %v", err)
+	}
+	if want := []string{"all"}; !reflect.DeepEqual(m.SubscribeIDs, want) {
+		t.Errorf("want %v, got %v", want, m.SubscribeIDs)
+	}
+}
+
+func TestPublishBatch(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	if _, err := testStore.NewSubscription("order", "A", 10, "", nil, `attributes.type = "order"`); err != nil {
+		t.Fatalf("failed to create subscription, got err %v", err)
+	}
+
+	ids, err := mustGetTopic(t, "A").PublishBatch([]*PublishMessage{
+		{Data: []byte("1"), Attributes: map[string]string{"type": "order"}},
+		{Data: []byte("2"), Attributes: map[string]string{"type": "user"}},
+		{Data: []byte("3"), Attributes: map[string]string{"type": "order"}},
+	})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("want 3 message ids, got %v", ids)
+	}
+
+	// only the matched messages are delivered in publish order
+	msgs, err := mustGetSubscription(t, "order").Message.CollectReadableMessage(10)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	got := []string{}
+	for _, m := range msgs {
+		got = append(got, m.ID)
+	}
+	if want := []string{ids[0], ids[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	// the message no one receive is not stored
+	if _, err := testStore.messages.Get(ids[1]); errors.Cause(err) != datastore.ErrNotFoundEntry {
+		t.Errorf("want %v, got %v", datastore.ErrNotFoundEntry, err)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/takashabe/go-pubsub/datastore"
 )
@@ -38,6 +39,32 @@ func TestLoadConfig(t *testing.T) {
 			},
 			nil,
 		},
+		{
+			"testdata/redis_options.yaml",
+			&Config{
+				&datastore.Config{
+					Redis: &datastore.RedisConfig{
+						Password:     "secret",
+						DB:           1,
+						MaxIdle:      5,
+						MaxActive:    20,
+						IdleTimeout:  5 * time.Minute,
+						DialTimeout:  time.Second,
+						ReadTimeout:  500 * time.Millisecond,
+						WriteTimeout: 500 * time.Millisecond,
+						TLS: &datastore.TLSConfig{
+							CAFile:     "/etc/ssl/redis-ca.pem",
+							ServerName: "redis.local",
+						},
+						Sentinel: &datastore.RedisSentinelConfig{
+							MasterName: "mymaster",
+							Addrs:      []string{"localhost:26379", "localhost:26380"},
+						},
+					},
+				},
+			},
+			nil,
+		},
 		{
 			"testdata/empty_param.yaml",
 			&Config{&datastore.Config{}},
@@ -3,15 +3,17 @@ package server
 import (
 	"net/http"
 
-	"github.com/takashabe/go-pubsub/stats"
+	"github.com/takashabe/go-pubsub/models"
 )
 
-// Monitoring is monitoring frontend server
-type Monitoring struct{}
+// Monitoring is monitoring frontend server of the stats in the Store
+type Monitoring struct {
+	store *models.Store
+}
 
 // Summary returns summary from all stats
 func (m *Monitoring) Summary(w http.ResponseWriter, r *http.Request) {
-	b, err := stats.Summary()
+	b, err := m.store.Stats().Summary()
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "failed to get metrics")
 		return
@@ -21,7 +23,7 @@ func (m *Monitoring) Summary(w http.ResponseWriter, r *http.Request) {
 
 // TopicSummary returns summary from topic stats
 func (m *Monitoring) TopicSummary(w http.ResponseWriter, r *http.Request) {
-	b, err := stats.TopicSummary()
+	b, err := m.store.Stats().TopicSummary()
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "failed to get metrics")
 		return
@@ -31,7 +33,7 @@ func (m *Monitoring) TopicSummary(w http.ResponseWriter, r *http.Request) {
 
 // SubscriptionSummary returns summary from subscription stats
 func (m *Monitoring) SubscriptionSummary(w http.ResponseWriter, r *http.Request) {
-	b, err := stats.SubscriptionSummary()
+	b, err := m.store.Stats().SubscriptionSummary()
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "failed to get metrics")
 		return
@@ -41,7 +43,7 @@ func (m *Monitoring) SubscriptionSummary(w http.ResponseWriter, r *http.Request)
 
 // TopicDetail returns detail from topic stats
 func (m *Monitoring) TopicDetail(w http.ResponseWriter, r *http.Request, id string) {
-	b, err := stats.TopicDetail(id)
+	b, err := m.store.Stats().TopicDetail(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "failed to get metrics")
 		return
@@ -51,7 +53,7 @@ func (m *Monitoring) TopicDetail(w http.ResponseWriter, r *http.Request, id stri
 
 // SubscriptionDetail returns detail from subscription stats
 func (m *Monitoring) SubscriptionDetail(w http.ResponseWriter, r *http.Request, id string) {
-	b, err := stats.SubscriptionDetail(id)
+	b, err := m.store.Stats().SubscriptionDetail(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "failed to get metrics")
 		return
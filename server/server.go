@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -8,9 +9,7 @@ import (
 	"os"
 
 	"github.com/pkg/errors"
-	"github.com/takashabe/go-pubsub/datastore"
 	"github.com/takashabe/go-pubsub/models"
-	"github.com/takashabe/go-pubsub/stats"
 	"github.com/takashabe/go-router"
 )
 
@@ -80,11 +79,11 @@ func JSON(w http.ResponseWriter, code int, src interface{}) {
 	Respond(w, code, src)
 }
 
-// Routes returns initialized for the topic and subscription router
-func Routes() *router.Router {
+// Routes returns initialized for the topic, subscription and snapshot router on the Store of the server
+func (s *Server) Routes() *router.Router {
 	r := router.NewRouter()
 
-	ts := TopicServer{}
+	ts := TopicServer{store: s.store}
 	topicRoot := "/topic"
 	r.Get(topicRoot+"/", ts.List)
 	r.Get(topicRoot+"/:id", ts.Get)
@@ -93,18 +92,29 @@ func Routes() *router.Router {
 	r.Post(topicRoot+"/:id/publish", ts.Publish)
 	r.Delete(topicRoot+"/:id", ts.Delete)
 
-	ss := SubscriptionServer{}
+	ss := SubscriptionServer{store: s.store}
 	subscriptionRoot := "/subscription"
 	r.Get(subscriptionRoot+"/", ss.List)
 	r.Get(subscriptionRoot+"/:id", ss.Get)
 	r.Put(subscriptionRoot+"/:id", ss.Create)
 	r.Post(subscriptionRoot+"/:id/pull", ss.Pull)
+	r.Get(subscriptionRoot+"/:id/stream", ss.Stream)
 	r.Post(subscriptionRoot+"/:id/ack", ss.Ack)
 	r.Post(subscriptionRoot+"/:id/ack/modify", ss.ModifyAck)
 	r.Post(subscriptionRoot+"/:id/push/modify", ss.ModifyPush)
+	r.Post(subscriptionRoot+"/:id/seek", ss.Seek)
+	r.Post(subscriptionRoot+"/:id/restore", ss.Restore)
+	r.Post(subscriptionRoot+"/:id/detach", ss.Detach)
 	r.Delete(subscriptionRoot+"/:id", ss.Delete)
 
-	ms := Monitoring{}
+	sn := SnapshotServer{store: s.store}
+	snapshotRoot := "/snapshot"
+	r.Get(snapshotRoot+"/", sn.List)
+	r.Get(snapshotRoot+"/:id", sn.Get)
+	r.Put(snapshotRoot+"/:id", sn.Create)
+	r.Delete(snapshotRoot+"/:id", sn.Delete)
+
+	ms := Monitoring{store: s.store}
 	monitoringRoot := "/stats"
 	r.Get(monitoringRoot+"/", ms.Summary)
 	r.Get(monitoringRoot+"/topic", ms.TopicSummary)
@@ -116,7 +126,8 @@ func Routes() *router.Router {
 
 // Server is topic and subscription frontend server
 type Server struct {
-	cfg *Config
+	cfg   *Config
+	store *models.Store
 }
 
 // NewServer return initialized server
@@ -130,32 +141,41 @@ func NewServer(path string) (*Server, error) {
 	}, nil
 }
 
-// PrepareServer settings datastore and stats configuration
+// NewServerWithStore return server on the Store, the Store is able to be shared with the other servers
+func NewServerWithStore(store *models.Store) *Server {
+	return &Server{
+		cfg:   &Config{},
+		store: store,
+	}
+}
+
+// Store return the Store of the server, nil before InitDatastore
+func (s *Server) Store() *models.Store {
+	return s.store
+}
+
+// PrepareServer settings datastore, the stats is belong to the Store
 func (s *Server) PrepareServer() error {
-	stats.Initialize()
 	return s.InitDatastore()
 }
 
-// InitDatastore prepare datastore initialize
+// InitDatastore create the Store from the datastore config, unless the Store is already set
 func (s *Server) InitDatastore() error {
-	datastore.SetGlobalConfig(s.cfg.Datastore)
-	if err := models.InitDatastoreTopic(); err != nil {
-		return errors.Wrap(err, "failed to init datastore topic")
-	}
-	if err := models.InitDatastoreSubscription(); err != nil {
-		return errors.Wrap(err, "failed to init datastore subscription")
-	}
-	if err := models.InitDatastoreMessage(); err != nil {
-		return errors.Wrap(err, "failed to init datastore message")
+	if s.store != nil {
+		return nil
 	}
-	if err := models.InitDatastoreMessageStatus(); err != nil {
-		return errors.Wrap(err, "failed to init datastore message status")
+	store, err := models.NewStore(s.cfg.Datastore)
+	if err != nil {
+		return errors.Wrap(err, "failed to init datastore")
 	}
+	s.store = store
 	return nil
 }
 
-// Run start server
+// Run start server, and sweeper of the expired messages
 func (s *Server) Run(port int) error {
+	go s.store.RunRetentionSweeper(context.Background(), models.RetentionSweepInterval)
+
 	log.Printf("Pubsub server running at http://localhost:%d/", port)
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), Routes())
+	return http.ListenAndServe(fmt.Sprintf(":%d", port), s.Routes())
 }
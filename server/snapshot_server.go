@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// SnapshotServer is snapshot frontend server
+type SnapshotServer struct {
+	store *models.Store
+}
+
+// ResourceSnapshot represent snapshot response data
+type ResourceSnapshot struct {
+	Name         string    `json:"name"`
+	Topic        string    `json:"topic"`
+	Subscription string    `json:"subscription"`
+	ExpireTime   time.Time `json:"expire_time"`
+}
+
+// snapshotToResource is Snapshot object convert to ResourceSnapshot
+func snapshotToResource(s *models.Snapshot) ResourceSnapshot {
+	return ResourceSnapshot{
+		Name:         s.Name,
+		Topic:        s.TopicID,
+		Subscription: s.SubscriptionID,
+		ExpireTime:   s.ExpireAt,
+	}
+}
+
+// RequestCreateSnapshot represent request create snapshot API json
+type RequestCreateSnapshot struct {
+	Subscription      string `json:"subscription"`
+	ExpirationSeconds int64  `json:"expiration_seconds"`
+}
+
+// Create is create snapshot from the unacked messages of the subscription
+func (s *SnapshotServer) Create(w http.ResponseWriter, r *http.Request, id string) {
+	// parse request
+	var req RequestCreateSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusNotFound, err, "failed to parsed request")
+		return
+	}
+
+	// create snapshot
+	snap, err := s.store.NewSnapshot(id, req.Subscription, time.Duration(req.ExpirationSeconds)*time.Second)
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "failed to create snapshot")
+		return
+	}
+	JSON(w, http.StatusCreated, snapshotToResource(snap))
+}
+
+// Get is get already exist snapshot
+func (s *SnapshotServer) Get(w http.ResponseWriter, r *http.Request, id string) {
+	snap, err := s.store.GetSnapshot(id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "not found snapshot")
+		return
+	}
+	JSON(w, http.StatusOK, snapshotToResource(snap))
+}
+
+// List is gets snapshot list
+func (s *SnapshotServer) List(w http.ResponseWriter, r *http.Request) {
+	snaps, err := s.store.ListSnapshot()
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "not found snapshot")
+		return
+	}
+	sort.Sort(models.BySnapshotName(snaps))
+	res := make([]ResourceSnapshot, 0, len(snaps))
+	for _, v := range snaps {
+		res = append(res, snapshotToResource(v))
+	}
+	JSON(w, http.StatusOK, res)
+}
+
+// Delete is delete snapshot
+func (s *SnapshotServer) Delete(w http.ResponseWriter, r *http.Request, id string) {
+	snap, err := s.store.GetSnapshot(id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "snapshot already not exist")
+		return
+	}
+	if err := snap.Delete(); err != nil {
+		Error(w, http.StatusInternalServerError, err, "failed to delete snapshot")
+		return
+	}
+	JSON(w, http.StatusNoContent, "")
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func createDummySnapshot(t *testing.T, ts *httptest.Server, id, sub string) *http.Response {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(RequestCreateSnapshot{Subscription: sub}); err != nil {
+		t.Fatalf("failed to encode json, got err %v", err)
+	}
+	req, err := http.NewRequest("PUT", fmt.Sprintf("%s/snapshot/%s", ts.URL, id), &buf)
+	if err != nil {
+		t.Fatalf("failed to create request, got err %v", err)
+	}
+	res, err := dummyClient(t).Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request, got err %v", err)
+	}
+	return res
+}
+
+func TestCreateAndGetSnapshot(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+
+	cases := []struct {
+		id            string
+		sub           string
+		expectPutCode int
+		expectGetCode int
+	}{
+		{"snap1", "A", http.StatusCreated, http.StatusOK},
+		{"snap1", "B", http.StatusNotFound, http.StatusOK},
+		{"snap2", "unknown", http.StatusNotFound, http.StatusNotFound},
+	}
+	for i, c := range cases {
+		res := createDummySnapshot(t, ts, c.id, c.sub)
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectPutCode {
+			t.Errorf("#%d: put code want %d, got %d", i, c.expectPutCode, got)
+		}
+
+		get, err := dummyClient(t).Get(fmt.Sprintf("%s/snapshot/%s", ts.URL, c.id))
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer get.Body.Close()
+		if got := get.StatusCode; got != c.expectGetCode {
+			t.Errorf("#%d: get code want %d, got %d", i, c.expectGetCode, got)
+		}
+	}
+}
+
+func TestListAndDeleteSnapshot(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+	createDummySnapshot(t, ts, "snap2", "B").Body.Close()
+	createDummySnapshot(t, ts, "snap1", "A").Body.Close()
+
+	// list
+	res, err := dummyClient(t).Get(ts.URL + "/snapshot/")
+	if err != nil {
+		t.Fatalf("failed to send request, got err %v", err)
+	}
+	defer res.Body.Close()
+	var list []ResourceSnapshot
+	if err := json.NewDecoder(res.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode json, got err %v", err)
+	}
+	names := []string{}
+	for _, s := range list {
+		names = append(names, s.Name)
+	}
+	if want := []string{"snap1", "snap2"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("want %v, got %v", want, names)
+	}
+
+	// delete
+	cases := []struct {
+		id         string
+		expectCode int
+	}{
+		{"snap1", http.StatusNoContent},
+		{"snap1", http.StatusNotFound},
+	}
+	for i, c := range cases {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/snapshot/%s", ts.URL, c.id), nil)
+		if err != nil {
+			t.Fatalf("#%d: failed to create request, got err %v", i, err)
+		}
+		res, err := dummyClient(t).Do(req)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: code want %d, got %d", i, c.expectCode, got)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+	createDummySubscription(t, ts, ResourceSubscription{
+		Name:       "C",
+		Topic:      "b",
+		AckTimeout: 10,
+	})
+	dummyPublishMessage(t, ts)
+	createDummySnapshot(t, ts, "snap", "A").Body.Close()
+
+	// beforehand pull and ack all messages
+	response := pullMessage(t, ts, "A", 3)
+	defer response.Body.Close()
+	var responsePull ResponsePull
+	if err := json.NewDecoder(response.Body).Decode(&responsePull); err != nil {
+		t.Fatalf("failed to beforehand encode json, got err %v", err)
+	}
+	ackIDs := make([]string, 0)
+	for _, r := range responsePull.Messages {
+		ackIDs = append(ackIDs, r.AckID)
+	}
+	var ackBuf bytes.Buffer
+	json.NewEncoder(&ackBuf).Encode(RequestAck{AckIDs: ackIDs})
+	ack, err := dummyClient(t).Post(fmt.Sprintf("%s/subscription/A/ack", ts.URL), "application/json", &ackBuf)
+	if err != nil {
+		t.Fatalf("failed to beforehand ack, got err %v", err)
+	}
+	ack.Body.Close()
+
+	cases := []struct {
+		sub          string
+		snapshot     string
+		expectCode   int
+		expectPulled int
+	}{
+		{"A", "snap", http.StatusOK, 3},
+		{"A", "unknown", http.StatusNotFound, 0},
+		{"C", "snap", http.StatusNotFound, 0},
+	}
+	for i, c := range cases {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(RequestRestore{Snapshot: c.snapshot}); err != nil {
+			t.Fatalf("#%d: failed to encode json, got err %v", i, err)
+		}
+		res, err := dummyClient(t).Post(
+			fmt.Sprintf("%s/subscription/%s/restore", ts.URL, c.sub),
+			"application/json", &buf)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Fatalf("#%d: code want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			continue
+		}
+
+		pulled := pullMessage(t, ts, c.sub, 3)
+		defer pulled.Body.Close()
+		var got ResponsePull
+		json.NewDecoder(pulled.Body).Decode(&got)
+		if len(got.Messages) != c.expectPulled {
+			t.Errorf("#%d: pulled want %d, got %d", i, c.expectPulled, len(got.Messages))
+		}
+	}
+}
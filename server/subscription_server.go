@@ -1,17 +1,20 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"sort"
 	"time"
 
 	"github.com/takashabe/go-pubsub/models"
-	"github.com/takashabe/go-pubsub/stats"
 )
 
 // SubscriptionServer is subscription frontend server
-type SubscriptionServer struct{}
+type SubscriptionServer struct {
+	store *models.Store
+}
 
 // ResourceSubscription represent create subscription request and response data
 type ResourceSubscription struct {
@@ -19,6 +22,37 @@ type ResourceSubscription struct {
 	Topic      string     `json:"topic"`
 	Push       PushConfig `json:"push_config"`
 	AckTimeout int64      `json:"ack_deadline_seconds"`
+	Filter     string     `json:"filter,omitempty"`
+
+	DeadLetterPolicy *DeadLetterPolicy `json:"dead_letter_policy,omitempty"`
+	RetryPolicy      *RetryPolicy      `json:"retry_policy,omitempty"`
+	ExpirationPolicy *ExpirationPolicy `json:"expiration_policy,omitempty"`
+
+	EnableMessageOrdering     bool `json:"enable_message_ordering,omitempty"`
+	EnableExactlyOnceDelivery bool `json:"enable_exactly_once_delivery,omitempty"`
+
+	MessageRetentionDuration int64 `json:"message_retention_duration_seconds,omitempty"`
+	RetainAckedMessages      bool  `json:"retain_acked_messages,omitempty"`
+
+	// LastActivityTime is only response, time of the last pull, ack or modify ack deadline recorded with the ExpirationPolicy
+	LastActivityTime *time.Time `json:"last_activity_time,omitempty"`
+}
+
+// DeadLetterPolicy represent parameter of forwarding the undeliverable message
+type DeadLetterPolicy struct {
+	DeadLetterTopic     string `json:"dead_letter_topic"`
+	MaxDeliveryAttempts int    `json:"max_delivery_attempts"`
+}
+
+// RetryPolicy represent parameter of the redelivery delay for the nacked or expired message
+type RetryPolicy struct {
+	MinimumBackoff int64 `json:"minimum_backoff_seconds"`
+	MaximumBackoff int64 `json:"maximum_backoff_seconds"`
+}
+
+// ExpirationPolicy represent parameter of deleting the subscription after a period with no activity
+type ExpirationPolicy struct {
+	TTL int64 `json:"ttl_seconds"`
 }
 
 // PushConfig represent parmeter of push message
@@ -35,11 +69,52 @@ func subscriptionToResource(s *models.Subscription) ResourceSubscription {
 		pushConfig.Attr = s.PushConfig.Attributes.Dump()
 	}
 
+	var deadLetter *DeadLetterPolicy
+	if s.DeadLetterPolicy != nil {
+		deadLetter = &DeadLetterPolicy{
+			DeadLetterTopic:     s.DeadLetterPolicy.DeadLetterTopic,
+			MaxDeliveryAttempts: s.DeadLetterPolicy.MaxDeliveryAttempts,
+		}
+	}
+
+	var retry *RetryPolicy
+	if s.RetryPolicy != nil {
+		retry = &RetryPolicy{
+			MinimumBackoff: int64(s.RetryPolicy.MinimumBackoff / time.Second),
+			MaximumBackoff: int64(s.RetryPolicy.MaximumBackoff / time.Second),
+		}
+	}
+
+	var expiration *ExpirationPolicy
+	if s.ExpirationPolicy != nil {
+		expiration = &ExpirationPolicy{
+			TTL: int64(s.ExpirationPolicy.TTL / time.Second),
+		}
+	}
+
+	var lastActivity *time.Time
+	if !s.LastActivityAt.IsZero() {
+		t := s.LastActivityAt
+		lastActivity = &t
+	}
+
 	return ResourceSubscription{
-		Name:       s.Name,
-		Topic:      s.TopicID,
-		Push:       pushConfig,
-		AckTimeout: int64(s.DefaultAckDeadline / time.Second),
+		Name:             s.Name,
+		Topic:            s.TopicID,
+		Push:             pushConfig,
+		AckTimeout:       int64(s.DefaultAckDeadline / time.Second),
+		Filter:           s.Filter,
+		DeadLetterPolicy: deadLetter,
+		RetryPolicy:      retry,
+		ExpirationPolicy: expiration,
+
+		EnableMessageOrdering:     s.EnableMessageOrdering,
+		EnableExactlyOnceDelivery: s.EnableExactlyOnceDelivery,
+
+		MessageRetentionDuration: int64(s.MessageRetentionDuration / time.Second),
+		RetainAckedMessages:      s.RetainAckedMessages,
+
+		LastActivityTime: lastActivity,
 	}
 }
 
@@ -52,20 +127,57 @@ func (s *SubscriptionServer) Create(w http.ResponseWriter, r *http.Request, id s
 		return
 	}
 
-	// create subscription
-	sub, err := models.NewSubscription(id, req.Topic, req.AckTimeout, req.Push.Endpoint, req.Push.Attr)
+	opts := models.SubscriptionOptions{
+		AckDeadline:               time.Duration(req.AckTimeout) * time.Second,
+		PushEndpoint:              req.Push.Endpoint,
+		PushAttributes:            req.Push.Attr,
+		Filter:                    req.Filter,
+		EnableMessageOrdering:     req.EnableMessageOrdering,
+		EnableExactlyOnceDelivery: req.EnableExactlyOnceDelivery,
+		MessageRetentionDuration:  time.Duration(req.MessageRetentionDuration) * time.Second,
+		RetainAckedMessages:       req.RetainAckedMessages,
+	}
+	if req.DeadLetterPolicy != nil {
+		p, err := s.store.NewDeadLetterPolicy(req.DeadLetterPolicy.DeadLetterTopic, req.DeadLetterPolicy.MaxDeliveryAttempts)
+		if err != nil {
+			Error(w, http.StatusNotFound, err, "invalid dead letter policy")
+			return
+		}
+		opts.DeadLetterPolicy = p
+	}
+	if req.RetryPolicy != nil {
+		p, err := models.NewRetryPolicy(
+			time.Duration(req.RetryPolicy.MinimumBackoff)*time.Second,
+			time.Duration(req.RetryPolicy.MaximumBackoff)*time.Second)
+		if err != nil {
+			Error(w, http.StatusNotFound, err, "invalid retry policy")
+			return
+		}
+		opts.RetryPolicy = p
+	}
+	if req.ExpirationPolicy != nil {
+		p, err := models.NewExpirationPolicy(time.Duration(req.ExpirationPolicy.TTL) * time.Second)
+		if err != nil {
+			Error(w, http.StatusNotFound, err, "invalid expiration policy")
+			return
+		}
+		opts.ExpirationPolicy = p
+	}
+
+	// create subscription, all options are saved at once
+	sub, err := s.store.NewSubscriptionWithOptions(id, req.Topic, opts)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "failed to create subscription")
 		return
 	}
 	JSON(w, http.StatusCreated, subscriptionToResource(sub))
 
-	stats.GetSubscriptionAdapter().AddSubscription(sub.Name, 1)
+	s.store.Stats().GetSubscriptionAdapter().AddSubscription(sub.Name, 1)
 }
 
 // Get is get already exist subscription
 func (s *SubscriptionServer) Get(w http.ResponseWriter, r *http.Request, id string) {
-	sub, err := models.GetSubscription(id)
+	sub, err := s.store.GetSubscription(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found subscription")
 		return
@@ -75,7 +187,7 @@ func (s *SubscriptionServer) Get(w http.ResponseWriter, r *http.Request, id stri
 
 // List is gets subscription list
 func (s *SubscriptionServer) List(w http.ResponseWriter, r *http.Request) {
-	subs, err := models.ListSubscription()
+	subs, err := s.store.ListSubscription()
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found subscription")
 		return
@@ -88,10 +200,25 @@ func (s *SubscriptionServer) List(w http.ResponseWriter, r *http.Request) {
 	JSON(w, http.StatusOK, resourceSubs)
 }
 
+// MaxPullWaitSeconds is upper limit of the waiting time for Pull
+const MaxPullWaitSeconds = 60
+
 // RequestPull is represents request json for Pull
 type RequestPull struct {
-	// TODO: ReturnImmediately bool
-	MaxMessages int `json:"max_messages"`
+	ReturnImmediately bool  `json:"return_immediately"`
+	MaxMessages       int   `json:"max_messages"`
+	MaxWaitSeconds    int64 `json:"max_wait_seconds"`
+}
+
+// waitDuration returns duration to wait until any message is readable
+func (r *RequestPull) waitDuration() time.Duration {
+	if r.ReturnImmediately || r.MaxWaitSeconds <= 0 {
+		return 0
+	}
+	if r.MaxWaitSeconds > MaxPullWaitSeconds {
+		return MaxPullWaitSeconds * time.Second
+	}
+	return time.Duration(r.MaxWaitSeconds) * time.Second
 }
 
 // ResponsePull is represents response json for Pull
@@ -99,9 +226,10 @@ type ResponsePull struct {
 	Messages []*models.PullMessage `json:"receive_messages"`
 }
 
-// Pull is get some messages
+// Pull is get some messages.
+// when "return_immediately" is false, wait until at least one message up to "max_wait_seconds",
+// return immediately without "max_wait_seconds" same as the previous versions
 func (s *SubscriptionServer) Pull(w http.ResponseWriter, r *http.Request, id string) {
-	// TODO: response timing flag, "immediately" and "wait untile at least one message"
 	// parse request
 	var req RequestPull
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -110,12 +238,19 @@ func (s *SubscriptionServer) Pull(w http.ResponseWriter, r *http.Request, id str
 	}
 
 	// pull messages
-	sub, err := models.GetSubscription(id)
+	sub, err := s.store.GetSubscription(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found subscription")
 		return
 	}
-	msgs, err := sub.Pull(req.MaxMessages)
+	var msgs []*models.PullMessage
+	if wait := req.waitDuration(); wait > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		defer cancel()
+		msgs, err = sub.PullWait(ctx, req.MaxMessages)
+	} else {
+		msgs, err = sub.Pull(req.MaxMessages)
+	}
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found message")
 		return
@@ -128,7 +263,33 @@ type RequestAck struct {
 	AckIDs []string `json:"ack_ids"`
 }
 
-// Ack is setting ack state
+// ResponseAck represent response ack API json in the exactly once delivery Subscription
+type ResponseAck struct {
+	AckResults []AckResult `json:"ack_results"`
+}
+
+// AckResult represent result of the ack for each AckID
+type AckResult struct {
+	AckID   string `json:"ack_id"`
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// confirmAck ack the messages of the exactly once delivery Subscription, and return the result for each AckID
+func confirmAck(sub *models.Subscription, ackIDs []string) []AckResult {
+	results := make([]AckResult, 0, len(ackIDs))
+	for _, r := range sub.ConfirmAck(ackIDs...) {
+		result := AckResult{AckID: r.AckID, Success: r.Err == nil}
+		if r.Err != nil {
+			result.Reason = r.Err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// Ack is setting ack state.
+// in the exactly once delivery Subscription, return the result for each AckID
 func (s *SubscriptionServer) Ack(w http.ResponseWriter, r *http.Request, id string) {
 	// parse request
 	var req RequestAck
@@ -142,11 +303,15 @@ func (s *SubscriptionServer) Ack(w http.ResponseWriter, r *http.Request, id stri
 	}
 
 	// ack message
-	sub, err := models.GetSubscription(id)
+	sub, err := s.store.GetSubscription(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found subscription")
 		return
 	}
+	if sub.EnableExactlyOnceDelivery {
+		JSON(w, http.StatusOK, ResponseAck{AckResults: confirmAck(sub, req.AckIDs)})
+		return
+	}
 	if err := sub.Ack(req.AckIDs...); err != nil {
 		Error(w, http.StatusNotFound, err, "failed to ack message")
 		return
@@ -170,7 +335,7 @@ func (s *SubscriptionServer) ModifyAck(w http.ResponseWriter, r *http.Request, i
 	}
 
 	// modify ack
-	sub, err := models.GetSubscription(id)
+	sub, err := s.store.GetSubscription(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found subscription")
 		return
@@ -199,7 +364,7 @@ func (s *SubscriptionServer) ModifyPush(w http.ResponseWriter, r *http.Request,
 	}
 
 	// modify push
-	sub, err := models.GetSubscription(id)
+	sub, err := s.store.GetSubscription(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found subscription")
 		return
@@ -215,9 +380,95 @@ func (s *SubscriptionServer) ModifyPush(w http.ResponseWriter, r *http.Request,
 	JSON(w, http.StatusOK, "")
 }
 
+// RequestSeek represent request Seek API json
+type RequestSeek struct {
+	Time time.Time `json:"time"`
+}
+
+// Seek is mark messages published before the time as acked, and later messages as unacked
+func (s *SubscriptionServer) Seek(w http.ResponseWriter, r *http.Request, id string) {
+	// parse request
+	var req RequestSeek
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusNotFound, err, "failed to parsed request")
+		return
+	}
+
+	// seek
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "not found subscription")
+		return
+	}
+	if err := sub.Seek(req.Time); err != nil {
+		Error(w, http.StatusInternalServerError, err, "failed to seek")
+		return
+	}
+	JSON(w, http.StatusOK, "")
+}
+
+// RequestRestore represent request Restore API json
+type RequestRestore struct {
+	Snapshot string `json:"snapshot"`
+}
+
+// Restore is mark messages captured in the snapshot as unacked, and other messages as acked
+func (s *SubscriptionServer) Restore(w http.ResponseWriter, r *http.Request, id string) {
+	// parse request
+	var req RequestRestore
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		Error(w, http.StatusNotFound, err, "failed to parsed request")
+		return
+	}
+
+	// restore
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "not found subscription")
+		return
+	}
+	snap, err := s.store.GetSnapshot(req.Snapshot)
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "not found snapshot")
+		return
+	}
+	if err := sub.RestoreSnapshot(snap); err != nil {
+		Error(w, http.StatusNotFound, err, "failed to restore snapshot")
+		return
+	}
+	JSON(w, http.StatusOK, "")
+}
+
+// RequestDetach represent request Detach API json
+type RequestDetach struct {
+	PurgeMessages bool `json:"purge_messages"`
+}
+
+// Detach is detach subscription from the topic, the request body is optional
+func (s *SubscriptionServer) Detach(w http.ResponseWriter, r *http.Request, id string) {
+	// parse request
+	var req RequestDetach
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		Error(w, http.StatusNotFound, err, "failed to parsed request")
+		return
+	}
+
+	// detach
+	sub, err := s.store.GetSubscription(id)
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "not found subscription")
+		return
+	}
+	if err := sub.Detach(req.PurgeMessages); err != nil {
+		Error(w, http.StatusInternalServerError, err, "failed to detach subscription")
+		return
+	}
+	JSON(w, http.StatusOK, "")
+}
+
 // Delete is delete subscription
 func (s *SubscriptionServer) Delete(w http.ResponseWriter, r *http.Request, id string) {
-	sub, err := models.GetSubscription(id)
+	sub, err := s.store.GetSubscription(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "subscription already not exist")
 		return
@@ -228,5 +479,5 @@ func (s *SubscriptionServer) Delete(w http.ResponseWriter, r *http.Request, id s
 	}
 	JSON(w, http.StatusNoContent, "")
 
-	stats.GetSubscriptionAdapter().AddSubscription(sub.Name, -1)
+	s.store.Stats().GetSubscriptionAdapter().AddSubscription(sub.Name, -1)
 }
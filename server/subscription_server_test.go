@@ -7,8 +7,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/takashabe/go-pubsub/models"
 )
 
 func TestCreateSubscription(t *testing.T) {
@@ -63,6 +67,86 @@ func TestCreateSubscription(t *testing.T) {
 			http.StatusNotFound,
 			[]byte(`{"reason":"failed to parsed request"}`),
 		},
+		{
+			"D",
+			ResourceSubscription{
+				Topic:            "a",
+				AckTimeout:       10,
+				DeadLetterPolicy: &DeadLetterPolicy{DeadLetterTopic: "b", MaxDeliveryAttempts: 5},
+			},
+			http.StatusCreated,
+			[]byte(`{"name":"D","topic":"a","push_config":{"endpoint":"","attributes":null},"ack_deadline_seconds":10,"dead_letter_policy":{"dead_letter_topic":"b","max_delivery_attempts":5}}`),
+		},
+		{
+			"E",
+			ResourceSubscription{
+				Topic:            "a",
+				AckTimeout:       10,
+				DeadLetterPolicy: &DeadLetterPolicy{DeadLetterTopic: "z", MaxDeliveryAttempts: 5},
+			},
+			http.StatusNotFound,
+			[]byte(`{"reason":"invalid dead letter policy"}`),
+		},
+		{
+			"F",
+			ResourceSubscription{
+				Topic:       "a",
+				AckTimeout:  10,
+				RetryPolicy: &RetryPolicy{MinimumBackoff: 10, MaximumBackoff: 600},
+			},
+			http.StatusCreated,
+			[]byte(`{"name":"F","topic":"a","push_config":{"endpoint":"","attributes":null},"ack_deadline_seconds":10,"retry_policy":{"minimum_backoff_seconds":10,"maximum_backoff_seconds":600}}`),
+		},
+		{
+			"G",
+			ResourceSubscription{
+				Topic:       "a",
+				AckTimeout:  10,
+				RetryPolicy: &RetryPolicy{MinimumBackoff: 600, MaximumBackoff: 10},
+			},
+			http.StatusNotFound,
+			[]byte(`{"reason":"invalid retry policy"}`),
+		},
+		{
+			"H",
+			ResourceSubscription{
+				Topic:                 "a",
+				AckTimeout:            10,
+				EnableMessageOrdering: true,
+			},
+			http.StatusCreated,
+			[]byte(`{"name":"H","topic":"a","push_config":{"endpoint":"","attributes":null},"ack_deadline_seconds":10,"enable_message_ordering":true}`),
+		},
+		{
+			"I",
+			ResourceSubscription{
+				Topic:      "a",
+				AckTimeout: 10,
+				Filter:     `attributes.type = "order"`,
+			},
+			http.StatusCreated,
+			[]byte(`{"name":"I","topic":"a","push_config":{"endpoint":"","attributes":null},"ack_deadline_seconds":10,"filter":"attributes.type = \"order\""}`),
+		},
+		{
+			"J",
+			ResourceSubscription{
+				Topic:      "a",
+				AckTimeout: 10,
+				Filter:     `type = "order"`,
+			},
+			http.StatusNotFound,
+			[]byte(`{"reason":"failed to create subscription"}`),
+		},
+		{
+			"K",
+			ResourceSubscription{
+				Topic:            "a",
+				AckTimeout:       10,
+				ExpirationPolicy: &ExpirationPolicy{TTL: 0},
+			},
+			http.StatusNotFound,
+			[]byte(`{"reason":"invalid expiration policy"}`),
+		},
 	}
 	for i, c := range cases {
 		client := dummyClient(t)
@@ -136,6 +220,51 @@ func TestGetSubscription(t *testing.T) {
 	}
 }
 
+func TestGetSubscriptionLastActivity(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopics(t, ts)
+	createDummySubscription(t, ts, ResourceSubscription{
+		Name:             "A",
+		Topic:            "a",
+		AckTimeout:       10,
+		ExpirationPolicy: &ExpirationPolicy{TTL: 3600},
+	})
+	createDummySubscription(t, ts, ResourceSubscription{
+		Name:       "B",
+		Topic:      "a",
+		AckTimeout: 10,
+	})
+	pullMessage(t, ts, "B", 1).Body.Close()
+
+	// the activity is recorded only with the expiration policy
+	cases := []struct {
+		input            string
+		expectExpiration *ExpirationPolicy
+		expectActivity   bool
+	}{
+		{"A", &ExpirationPolicy{TTL: 3600}, true},
+		{"B", nil, false},
+	}
+	for i, c := range cases {
+		res, err := dummyClient(t).Get(fmt.Sprintf("%s/subscription/%s", ts.URL, c.input))
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		var got ResourceSubscription
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatalf("#%d: failed to decode json, got err %v", i, err)
+		}
+		if !reflect.DeepEqual(got.ExpirationPolicy, c.expectExpiration) {
+			t.Errorf("#%d: want %v, got %v", i, c.expectExpiration, got.ExpirationPolicy)
+		}
+		if activity := got.LastActivityTime != nil && !got.LastActivityTime.IsZero(); activity != c.expectActivity {
+			t.Errorf("#%d: want last activity time %t, got %v", i, c.expectActivity, got.LastActivityTime)
+		}
+	}
+}
+
 func TestDeleteSubscription(t *testing.T) {
 	ts := setupServer(t)
 	defer ts.Close()
@@ -276,6 +405,150 @@ func TestPull(t *testing.T) {
 	}
 }
 
+func TestPullWait(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+
+	cases := []struct {
+		inputBody  RequestPull
+		publish    bool
+		expectCode int
+		expectSize int
+	}{
+		{RequestPull{MaxMessages: 1, MaxWaitSeconds: 1, ReturnImmediately: true}, false, http.StatusNotFound, 0},
+		{RequestPull{MaxMessages: 1, MaxWaitSeconds: 1}, false, http.StatusNotFound, 0},
+		// return immediately without max_wait_seconds
+		{RequestPull{MaxMessages: 1}, false, http.StatusNotFound, 0},
+		{RequestPull{MaxMessages: 1, MaxWaitSeconds: 5}, true, http.StatusOK, 1},
+	}
+	for i, c := range cases {
+		if c.publish {
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				setupPublishMessages(t, ts, "a", PublishDatas{
+					Messages: []PublishData{PublishData{Data: []byte(`test`)}},
+				})
+			}()
+		}
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(c.inputBody); err != nil {
+			t.Fatalf("#%d: failed to encode struct", i)
+		}
+		client := dummyClient(t)
+		res, err := client.Post(
+			fmt.Sprintf("%s/subscription/%s/pull", ts.URL, "A"),
+			"application/json", &buf)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+
+		if got := res.StatusCode; got != c.expectCode {
+			t.Fatalf("#%d: code want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			continue
+		}
+		var body ResponsePull
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("#%d: failed decode to json, got err %v", i, err)
+		}
+		if got := len(body.Messages); got != c.expectSize {
+			t.Errorf("#%d: message len want %d, got %d", i, c.expectSize, got)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+	dummyPublishMessage(t, ts)
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/subscription/A/stream"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial streaming pull, got err %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(RequestStream{MaxOutstandingMessages: 2}); err != nil {
+		t.Fatalf("failed to send request, got err %v", err)
+	}
+
+	// receive up to MaxOutstandingMessages, and receive rest message after the ack
+	cases := []struct {
+		expectSize int
+		ack        bool
+	}{
+		{2, true},
+		{1, false},
+	}
+	var ackIDs []string
+	for i, c := range cases {
+		var body ResponsePull
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(&body); err != nil {
+			t.Fatalf("#%d: failed to receive messages, got err %v", i, err)
+		}
+		if got := len(body.Messages); got != c.expectSize {
+			t.Errorf("#%d: message len want %d, got %d", i, c.expectSize, got)
+		}
+		if !c.ack {
+			continue
+		}
+		ackIDs = []string{}
+		for _, m := range body.Messages {
+			ackIDs = append(ackIDs, m.AckID)
+		}
+		if err := conn.WriteJSON(RequestStream{AckIDs: ackIDs}); err != nil {
+			t.Fatalf("#%d: failed to send ack, got err %v", i, err)
+		}
+		var results ResponseAck
+		if err := conn.ReadJSON(&results); err != nil {
+			t.Fatalf("#%d: failed to receive ack results, got err %v", i, err)
+		}
+		for _, r := range results.AckResults {
+			if !r.Success {
+				t.Errorf("#%d: want ack success, got %v", i, r)
+			}
+		}
+	}
+
+	// used ackID want failure
+	if err := conn.WriteJSON(RequestStream{AckIDs: ackIDs}); err != nil {
+		t.Fatalf("failed to send ack, got err %v", err)
+	}
+	var results ResponseAck
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if err := conn.ReadJSON(&results); err != nil {
+		t.Fatalf("failed to receive ack results, got err %v", err)
+	}
+	if len(results.AckResults) != len(ackIDs) {
+		t.Fatalf("want %d ack results, got %v", len(ackIDs), results.AckResults)
+	}
+	for _, r := range results.AckResults {
+		if r.Success {
+			t.Errorf("want ack failure, got %v", r)
+		}
+	}
+}
+
+func TestStreamNotFound(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/subscription/unknown/stream"
+	_, res, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil {
+		t.Fatalf("want error, got nil")
+	}
+	if got := res.StatusCode; got != http.StatusNotFound {
+		t.Errorf("want status code %d, got %d", http.StatusNotFound, got)
+	}
+}
+
 // testing for ack response
 func TestAck(t *testing.T) {
 	ts := setupServer(t)
@@ -523,3 +796,183 @@ func TestModifyPush(t *testing.T) {
 		}
 	}
 }
+
+func TestAckExactlyOnce(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopics(t, ts)
+	createDummySubscription(t, ts, ResourceSubscription{
+		Name:                      "A",
+		Topic:                     "a",
+		AckTimeout:                10,
+		EnableExactlyOnceDelivery: true,
+	})
+	dummyPublishMessage(t, ts)
+
+	// beforehand pull message
+	response := pullMessage(t, ts, "A", 1)
+	defer response.Body.Close()
+	var responsePull ResponsePull
+	if err := json.NewDecoder(response.Body).Decode(&responsePull); err != nil {
+		t.Fatalf("failed to beforehand encode json, got err %v", err)
+	}
+	ackID := responsePull.Messages[0].AckID
+
+	cases := []struct {
+		input  []string
+		expect ResponseAck
+	}{
+		{
+			[]string{ackID, "unknown"},
+			ResponseAck{AckResults: []AckResult{
+				{AckID: ackID, Success: true},
+				{AckID: "unknown", Success: false, Reason: models.ErrNotFoundAckID.Error()},
+			}},
+		},
+		{
+			[]string{ackID},
+			ResponseAck{AckResults: []AckResult{
+				{AckID: ackID, Success: false, Reason: models.ErrNotFoundAckID.Error()},
+			}},
+		},
+	}
+	for i, c := range cases {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(RequestAck{AckIDs: c.input}); err != nil {
+			t.Fatalf("#%d: failed to encode json, got err %v", i, err)
+		}
+		client := dummyClient(t)
+		res, err := client.Post(
+			fmt.Sprintf("%s/subscription/%s/ack", ts.URL, "A"),
+			"application/json", &buf)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != http.StatusOK {
+			t.Fatalf("#%d: code want %d, got %d", i, http.StatusOK, got)
+		}
+		var got ResponseAck
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatalf("#%d: failed to decode json, got err %v", i, err)
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopics(t, ts)
+	createDummySubscription(t, ts, ResourceSubscription{
+		Name:                "A",
+		Topic:               "a",
+		AckTimeout:          10,
+		RetainAckedMessages: true,
+	})
+	dummyPublishMessage(t, ts)
+
+	// beforehand pull and ack all messages
+	response := pullMessage(t, ts, "A", 3)
+	defer response.Body.Close()
+	var responsePull ResponsePull
+	if err := json.NewDecoder(response.Body).Decode(&responsePull); err != nil {
+		t.Fatalf("failed to beforehand encode json, got err %v", err)
+	}
+	sub, err := testStore.GetSubscription("A")
+	if err != nil {
+		t.Fatalf("failed to get subscription, got err %v", err)
+	}
+	for _, m := range responsePull.Messages {
+		if err := sub.Ack(m.AckID); err != nil {
+			t.Fatalf("failed to beforehand ack, got err %v", err)
+		}
+	}
+
+	cases := []struct {
+		sub          string
+		inputBody    interface{}
+		expectCode   int
+		expectPulled int
+	}{
+		{"A", RequestSeek{Time: time.Now()}, http.StatusOK, 0},
+		{"A", RequestSeek{Time: time.Time{}}, http.StatusOK, 3},
+		{"A", "", http.StatusNotFound, 0},
+		{"B", RequestSeek{Time: time.Time{}}, http.StatusNotFound, 0},
+	}
+	for i, c := range cases {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(c.inputBody); err != nil {
+			t.Fatalf("#%d: failed to encode json, got err %v", i, err)
+		}
+		client := dummyClient(t)
+		res, err := client.Post(
+			fmt.Sprintf("%s/subscription/%s/seek", ts.URL, c.sub),
+			"application/json", &buf)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Fatalf("#%d: code want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			continue
+		}
+
+		pulled := pullMessage(t, ts, c.sub, 3)
+		defer pulled.Body.Close()
+		var got ResponsePull
+		json.NewDecoder(pulled.Body).Decode(&got)
+		if len(got.Messages) != c.expectPulled {
+			t.Errorf("#%d: pulled want %d, got %d", i, c.expectPulled, len(got.Messages))
+		}
+	}
+}
+
+func TestDetach(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+
+	cases := []struct {
+		sub        string
+		inputBody  interface{}
+		expectCode int
+	}{
+		{"A", nil, http.StatusOK},
+		{"B", RequestDetach{PurgeMessages: true}, http.StatusOK},
+		{"C", nil, http.StatusNotFound},
+	}
+	for i, c := range cases {
+		var buf bytes.Buffer
+		if c.inputBody != nil {
+			if err := json.NewEncoder(&buf).Encode(c.inputBody); err != nil {
+				t.Fatalf("#%d: failed to encode json, got err %v", i, err)
+			}
+		}
+		client := dummyClient(t)
+		res, err := client.Post(
+			fmt.Sprintf("%s/subscription/%s/detach", ts.URL, c.sub),
+			"application/json", &buf)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: code want %d, got %d", i, c.expectCode, got)
+		}
+	}
+
+	// detached subscriptions no longer receive published messages
+	dummyPublishMessage(t, ts)
+	for _, sub := range []string{"A", "B"} {
+		res := pullMessage(t, ts, sub, 3)
+		defer res.Body.Close()
+		if got := res.StatusCode; got != http.StatusNotFound {
+			t.Errorf("%s: want no message, got code %d", sub, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// DefaultMaxOutstandingMessages is limit of the unacked messages on the streaming pull
+const DefaultMaxOutstandingMessages = 1000
+
+// streamUpgrader upgrade the streaming pull request to the websocket connection
+var streamUpgrader = websocket.Upgrader{}
+
+// RequestStream represent request json sent from the client on the streaming pull connection.
+// first request setting the flow control, subsequent requests send ack and modify ack deadline.
+type RequestStream struct {
+	MaxOutstandingMessages int      `json:"max_outstanding_messages"`
+	AckIDs                 []string `json:"ack_ids"`
+	ModifyDeadlineAckIDs   []string `json:"modify_deadline_ack_ids"`
+	ModifyDeadlineSeconds  int64    `json:"modify_deadline_seconds"`
+}
+
+// Stream is continuously send readable messages on the websocket connection,
+// and receive ack and modify ack deadline from the same connection.
+// the messages are sent as ResponsePull, and the results of each ack request are sent as ResponseAck in the request order
+func (s *SubscriptionServer) Stream(w http.ResponseWriter, r *http.Request, id string) {
+	if _, err := s.store.GetSubscription(id); err != nil {
+		Error(w, http.StatusNotFound, err, "not found subscription")
+		return
+	}
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// already responded error by the Upgrade
+		PrintDebugf("failed to upgrade streaming pull: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	var req RequestStream
+	if err := conn.ReadJSON(&req); err != nil {
+		PrintDebugf("failed to read initial streaming pull request: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	sp := newStreamingPull(s.store, id, req.MaxOutstandingMessages)
+	go func() {
+		defer cancel()
+		sp.receive(conn)
+	}()
+	if err := sp.send(ctx, conn); err != nil {
+		PrintDebugf("closed streaming pull: %v", err)
+	}
+}
+
+// streamingPull is holds flow control state of the streaming pull connection
+type streamingPull struct {
+	store       *models.Store
+	subID       string
+	outstanding *models.Outstanding
+
+	// writeMu serialize the messages and the ack results written on the connection
+	writeMu sync.Mutex
+}
+
+func newStreamingPull(store *models.Store, subID string, maxOutstanding int) *streamingPull {
+	if maxOutstanding <= 0 {
+		maxOutstanding = DefaultMaxOutstandingMessages
+	}
+	return &streamingPull{
+		store:       store,
+		subID:       subID,
+		outstanding: models.NewOutstanding(maxOutstanding),
+	}
+}
+
+// send keeps sending messages until ctx is done
+func (sp *streamingPull) send(ctx context.Context, conn *websocket.Conn) error {
+	for {
+		if sp.outstanding.Available() <= 0 {
+			if err := sp.outstanding.Wait(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sub, err := sp.store.GetSubscription(sp.subID)
+		if err != nil {
+			return err
+		}
+		msgs, err := sub.StreamingPullWait(ctx, sp.outstanding.Available())
+		if err != nil {
+			if errors.Cause(err) == models.ErrEmptyMessage {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				continue
+			}
+			return err
+		}
+		sp.outstanding.Deliver(msgs, sub.StreamAckDeadline())
+		if err := sp.write(conn, ResponsePull{Messages: msgs}); err != nil {
+			return err
+		}
+	}
+}
+
+// write send the response on the connection
+func (sp *streamingPull) write(conn *websocket.Conn, v interface{}) error {
+	sp.writeMu.Lock()
+	defer sp.writeMu.Unlock()
+	return conn.WriteJSON(v)
+}
+
+// receive keeps receiving ack and modify ack deadline until the connection is closed
+func (sp *streamingPull) receive(conn *websocket.Conn) {
+	for {
+		var req RequestStream
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		sub, err := sp.store.GetSubscription(sp.subID)
+		if err != nil {
+			return
+		}
+
+		if len(req.AckIDs) > 0 {
+			results := ackResults(sub, req.AckIDs)
+			sp.outstanding.Release(req.AckIDs)
+			if err := sp.write(conn, ResponseAck{AckResults: results}); err != nil {
+				return
+			}
+		}
+
+		for _, id := range req.ModifyDeadlineAckIDs {
+			if err := sub.ModifyAckDeadline(id, req.ModifyDeadlineSeconds); err != nil {
+				PrintDebugf("failed to modify ack deadline on streaming pull, ack_id=%s: %v", id, err)
+			}
+		}
+		if req.ModifyDeadlineSeconds <= 0 {
+			// nack
+			sp.outstanding.Release(req.ModifyDeadlineAckIDs)
+		} else {
+			sp.outstanding.Extend(req.ModifyDeadlineAckIDs, time.Duration(req.ModifyDeadlineSeconds)*time.Second)
+		}
+	}
+}
+
+// ackResults ack the messages and return the result for each AckID, same as the exactly once Ack API
+func ackResults(sub *models.Subscription, ackIDs []string) []AckResult {
+	if sub.EnableExactlyOnceDelivery {
+		return confirmAck(sub, ackIDs)
+	}
+	results := make([]AckResult, 0, len(ackIDs))
+	for _, id := range ackIDs {
+		result := AckResult{AckID: id, Success: true}
+		if err := sub.Ack(id); err != nil {
+			result.Success = false
+			result.Reason = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -14,6 +14,7 @@ import (
 	_ "github.com/takashabe/go-fixture/mysql" // mysql driver
 	"github.com/takashabe/go-pubsub/datastore"
 	"github.com/takashabe/go-pubsub/models"
+	bolt "go.etcd.io/bbolt"
 )
 
 func dummyClient(t *testing.T) *http.Client {
@@ -25,6 +26,9 @@ func dummyClient(t *testing.T) *http.Client {
 	}
 }
 
+// testStore is the Store of the server initialized by setupServer
+var testStore *models.Store
+
 func setupServer(t *testing.T) *httptest.Server {
 	// setup datastore
 	var path string
@@ -41,12 +45,18 @@ func setupServer(t *testing.T) *httptest.Server {
 		t.Fatalf("failed to PrepareServer, err=%v", err)
 	}
 
-	// flush datastore. only Redis
-	d, err := datastore.LoadDatastore(s.cfg.Datastore)
-	if err != nil {
-		t.Fatalf("failed to load datastore, got err %v", err)
-	}
-	switch a := d.(type) {
+	testStore = s.Store()
+
+	// flush datastore
+	switch a := testStore.Datastore().(type) {
+	case *datastore.RedisStream:
+		conn := a.Pool.Get()
+		defer conn.Close()
+
+		_, err := conn.Do("FLUSHDB")
+		if err != nil {
+			t.Fatalf("failed to FLUSHDB on Redis, got error %v", err)
+		}
 	case *datastore.Redis:
 		conn := a.Pool.Get()
 		defer conn.Close()
@@ -63,10 +73,40 @@ func setupServer(t *testing.T) *httptest.Server {
 		if err := f.LoadSQL("fixture/setup_table.sql"); err != nil {
 			t.Fatalf("failed to execute fixture, got err %v", err)
 		}
+	case *datastore.Postgres:
+		_, err := a.Conn.Exec(`TRUNCATE pubsub, pubsub_unique_index, pubsub_sorted_index,
+			topics, subscriptions, messages, message_statuses, snapshots`)
+		if err != nil {
+			t.Fatalf("failed to truncate tables, got err %v", err)
+		}
+	case *datastore.File:
+		if err := flushFile(a.DB); err != nil {
+			t.Fatalf("failed to flush file, got err %v", err)
+		}
 	}
 
 	// setup http server
-	return httptest.NewServer(Routes())
+	return httptest.NewServer(s.Routes())
+}
+
+// flushFile recreate all buckets of the File
+func flushFile(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		names := make([][]byte, 0)
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte{}, name...))
+			return nil
+		})
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 func setupDummyTopics(t *testing.T, ts *httptest.Server) {
@@ -151,7 +191,7 @@ func dummyPublishMessage(t *testing.T, ts *httptest.Server) {
 // warning: direct access to models package
 func hackCreateShortAckSubscription(t *testing.T) {
 	// require created topic "a"
-	s, err := models.NewSubscription("A", "a", 0, "", nil)
+	s, err := testStore.NewSubscription("A", "a", 0, "", nil, "")
 	if err != nil {
 		t.Fatalf("failed to create subscription, got err %v", err)
 	}
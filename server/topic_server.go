@@ -2,47 +2,82 @@ package server
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"sort"
+	"strconv"
+	"time"
 
 	"github.com/takashabe/go-pubsub/models"
-	"github.com/takashabe/go-pubsub/stats"
 )
 
 // TopicServer is topic frontend server
-type TopicServer struct{}
+type TopicServer struct {
+	store *models.Store
+}
+
+// ResourceTopic represent create topic request and response data
+type ResourceTopic struct {
+	Name                     string `json:"name"`
+	MessageRetentionDuration int64  `json:"message_retention_duration_seconds,omitempty"`
+}
+
+// topicToResource is Topic object convert to ResourceTopic
+func topicToResource(t *models.Topic) ResourceTopic {
+	return ResourceTopic{
+		Name:                     t.Name,
+		MessageRetentionDuration: int64(t.MessageRetentionDuration / time.Second),
+	}
+}
 
-// Create is create topic
+// Create is create topic, the request body is optional
 func (s *TopicServer) Create(w http.ResponseWriter, r *http.Request, id string) {
-	t, err := models.NewTopic(id)
+	// parse request
+	var req ResourceTopic
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		Error(w, http.StatusNotFound, err, "failed to parsed request")
+		return
+	}
+	if req.MessageRetentionDuration < 0 {
+		Error(w, http.StatusNotFound, models.ErrInvalidRetentionDuration, "invalid message retention duration")
+		return
+	}
+
+	t, err := s.store.NewTopicWithOptions(id, models.TopicOptions{
+		MessageRetentionDuration: time.Duration(req.MessageRetentionDuration) * time.Second,
+	})
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "failed to create topic")
 		return
 	}
-	JSON(w, http.StatusCreated, t)
+	JSON(w, http.StatusCreated, topicToResource(t))
 
-	stats.GetTopicAdapter().AddTopic(t.Name, 1)
+	s.store.Stats().GetTopicAdapter().AddTopic(t.Name, 1)
 }
 
 // Get is get already exist topic
 func (s *TopicServer) Get(w http.ResponseWriter, r *http.Request, id string) {
-	t, err := models.GetTopic(id)
+	t, err := s.store.GetTopic(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found topic")
 		return
 	}
-	JSON(w, http.StatusOK, t)
+	JSON(w, http.StatusOK, topicToResource(t))
 }
 
 // List is gets topic list
 func (s *TopicServer) List(w http.ResponseWriter, r *http.Request) {
-	t, err := models.ListTopic()
+	t, err := s.store.ListTopic()
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found topic")
 		return
 	}
 	sort.Sort(models.ByTopicName(t))
-	JSON(w, http.StatusOK, t)
+	res := make([]ResourceTopic, 0, len(t))
+	for _, v := range t {
+		res = append(res, topicToResource(v))
+	}
+	JSON(w, http.StatusOK, res)
 }
 
 // ResponseListSubscription represent response json of ListSubscription
@@ -52,7 +87,7 @@ type ResponseListSubscription struct {
 
 // ListSubscription is gets topic depends subscription list
 func (s *TopicServer) ListSubscription(w http.ResponseWriter, r *http.Request, id string) {
-	t, err := models.GetTopic(id)
+	t, err := s.store.GetTopic(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found topic")
 		return
@@ -72,26 +107,42 @@ func (s *TopicServer) ListSubscription(w http.ResponseWriter, r *http.Request, i
 	JSON(w, http.StatusOK, res)
 }
 
-// Delete is delete topic
+// Delete is delete topic, and detach depended subscriptions.
+// when "purge_messages" query is true, delete pending messages of the subscriptions
 func (s *TopicServer) Delete(w http.ResponseWriter, r *http.Request, id string) {
-	t, err := models.GetTopic(id)
+	purge, err := parsePurgeMessages(r)
+	if err != nil {
+		Error(w, http.StatusNotFound, err, "invalid purge_messages")
+		return
+	}
+	t, err := s.store.GetTopic(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "topic already not exist")
 		return
 	}
-	if err := t.Delete(); err != nil {
+	if err := t.Delete(purge); err != nil {
 		Error(w, http.StatusInternalServerError, err, "failed to delete topic")
 		return
 	}
 	JSON(w, http.StatusNoContent, "")
 
-	stats.GetTopicAdapter().AddTopic(t.Name, -1)
+	s.store.Stats().GetTopicAdapter().AddTopic(t.Name, -1)
+}
+
+// parsePurgeMessages return "purge_messages" query parameter, default is false
+func parsePurgeMessages(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("purge_messages")
+	if v == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(v)
 }
 
 // PublishData represent post publish data
 type PublishData struct {
-	Data []byte            `json:"data"`
-	Attr map[string]string `json:"attributes"`
+	Data        []byte            `json:"data"`
+	Attr        map[string]string `json:"attributes"`
+	OrderingKey string            `json:"ordering_key"`
 }
 
 // PublishDatas represent PublishData group
@@ -115,21 +166,21 @@ func (s *TopicServer) Publish(w http.ResponseWriter, r *http.Request, id string)
 	}
 
 	// publish message
-	t, err := models.GetTopic(id)
+	t, err := s.store.GetTopic(id)
 	if err != nil {
 		Error(w, http.StatusNotFound, err, "not found topic")
 		return
 	}
-	pubIDs := make([]string, 0)
+	msgs := make([]*models.PublishMessage, 0, len(datas.Messages))
 	for _, d := range datas.Messages {
-		id, err := t.Publish(d.Data, d.Attr)
-		if err != nil {
-			Error(w, http.StatusInternalServerError, err, "failed publish message")
-			return
-		}
-		pubIDs = append(pubIDs, id)
+		msgs = append(msgs, &models.PublishMessage{Data: d.Data, Attributes: d.Attr, OrderingKey: d.OrderingKey})
+	}
+	pubIDs, err := t.PublishBatch(msgs)
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err, "failed publish message")
+		return
 	}
 	JSON(w, http.StatusOK, ResponsePublish{MessageIDs: pubIDs})
 
-	stats.GetTopicAdapter().AddMessage(t.Name, len(datas.Messages))
+	s.store.Stats().GetTopicAdapter().AddMessage(t.Name, len(datas.Messages))
 }
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+
+	"github.com/takashabe/go-pubsub/models"
 )
 
 func TestCreateAndGetTopic(t *testing.T) {
@@ -136,6 +138,60 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteWithSubscriptions(t *testing.T) {
+	cases := []struct {
+		query        string
+		expectCode   int
+		expectTopic  string
+		expectPulled int
+	}{
+		{"", http.StatusNoContent, models.DeletedTopicID, 3},
+		{"?purge_messages=true", http.StatusNoContent, models.DeletedTopicID, 0},
+		{"?purge_messages=invalid", http.StatusNotFound, "a", 3},
+	}
+	for i, c := range cases {
+		ts := setupServer(t)
+		defer ts.Close()
+		setupDummyTopicAndSub(t, ts)
+		dummyPublishMessage(t, ts)
+
+		client := dummyClient(t)
+		req, err := http.NewRequest("DELETE", ts.URL+"/topic/a"+c.query, nil)
+		if err != nil {
+			t.Fatalf("#%d: failed to create request", i)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request", i)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+
+		get, err := client.Get(ts.URL + "/subscription/A")
+		if err != nil {
+			t.Fatalf("#%d: failed to send request", i)
+		}
+		defer get.Body.Close()
+		var sub ResourceSubscription
+		if err := json.NewDecoder(get.Body).Decode(&sub); err != nil {
+			t.Fatalf("#%d: failed to decode json, got err %v", i, err)
+		}
+		if sub.Topic != c.expectTopic {
+			t.Errorf("#%d: want topic %s, got %s", i, c.expectTopic, sub.Topic)
+		}
+
+		pulled := pullMessage(t, ts, "A", 3)
+		defer pulled.Body.Close()
+		var got ResponsePull
+		json.NewDecoder(pulled.Body).Decode(&got)
+		if len(got.Messages) != c.expectPulled {
+			t.Errorf("#%d: pulled want %d, got %d", i, c.expectPulled, len(got.Messages))
+		}
+	}
+}
+
 func TestListTopic(t *testing.T) {
 	ts := setupServer(t)
 	defer ts.Close()
@@ -251,3 +307,52 @@ func TestPublish(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateTopicWithRetention(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+
+	cases := []struct {
+		input      string
+		inputBody  string
+		expectCode int
+		expectBody []byte
+	}{
+		{
+			"A",
+			`{"message_retention_duration_seconds":3600}`,
+			http.StatusCreated,
+			[]byte(`{"name":"A","message_retention_duration_seconds":3600}`),
+		},
+		{
+			"B",
+			`{"message_retention_duration_seconds":-1}`,
+			http.StatusNotFound,
+			[]byte(`{"reason":"invalid message retention duration"}`),
+		},
+		{
+			"C",
+			`invalid`,
+			http.StatusNotFound,
+			[]byte(`{"reason":"failed to parsed request"}`),
+		},
+	}
+	for i, c := range cases {
+		client := dummyClient(t)
+		req, err := http.NewRequest("PUT", ts.URL+"/topic/"+c.input, bytes.NewBufferString(c.inputBody))
+		if err != nil {
+			t.Fatalf("#%d: failed to create request, %v", i, err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; c.expectCode != got {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+		if got, _ := ioutil.ReadAll(res.Body); !reflect.DeepEqual(got, c.expectBody) {
+			t.Errorf("#%d: want %s, got %s", i, c.expectBody, got)
+		}
+	}
+}
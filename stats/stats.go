@@ -3,20 +3,22 @@ package stats
 import (
 	"bytes"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/takashabe/go-metrics/collect"
 	"github.com/takashabe/go-metrics/forward"
 )
 
-// Pooling accessor for metrics library
-var (
+// Stats is the metrics of the topics and subscriptions, each models Store has the own Stats
+type Stats struct {
 	collector collect.Collector
 	forwarder forward.MetricsWriter
-)
 
-// buf is output buffer from the MetricsWriter
-var buf = &buffer{}
+	// buf is output buffer from the MetricsWriter, mu serializes the flush and the read
+	buf *buffer
+	mu  sync.Mutex
+}
 
 // buffer is wrapped bytes.Buffer
 type buffer struct {
@@ -39,35 +41,37 @@ func getTopicSummaryKeys() []string {
 func getSubscriptionSummaryKeys() []string {
 	return []string{"subscription.subscription_num", "subscription.message_count"}
 }
-func getTopicDetailKeys(id string) []string {
-	adapter := GetTopicAdapter()
+func (s *Stats) getTopicDetailKeys(id string) []string {
+	adapter := s.GetTopicAdapter()
 	return []string{
 		adapter.assembleMetricsKey(id, "created_at"),
 		adapter.assembleMetricsKey(id, "message_count"),
 	}
 }
-func getSubscriptionDetailKeys(id string) []string {
-	adapter := GetSubscriptionAdapter()
+func (s *Stats) getSubscriptionDetailKeys(id string) []string {
+	adapter := s.GetSubscriptionAdapter()
 	return []string{
 		adapter.assembleMetricsKey(id, "created_at"),
 		adapter.assembleMetricsKey(id, "message_count"),
 		adapter.assembleMetricsKey(id, "current_messages"),
+		adapter.assembleMetricsKey(id, "filtered_count"),
+		adapter.assembleMetricsKey(id, "expired_count"),
 	}
 }
 
 // TopicAdapter is adapter of operation metrics for Topic
 type TopicAdapter struct {
 	prefix  string
+	stats   *Stats
 	collect collect.Collector
-	forward forward.MetricsWriter
 }
 
 // GetTopicAdapter return prepared TopicAdapter
-func GetTopicAdapter() *TopicAdapter {
+func (s *Stats) GetTopicAdapter() *TopicAdapter {
 	return &TopicAdapter{
 		prefix:  "topic",
-		collect: collector,
-		forward: forwarder,
+		stats:   s,
+		collect: s.collector,
 	}
 }
 
@@ -81,7 +85,7 @@ func (t *TopicAdapter) assembleMetricsKey(parts ...string) string {
 
 // AddTopic send metrics the topic
 func (t *TopicAdapter) AddTopic(topicID string, num int) {
-	prepareDetailTopicMetrics(topicID)
+	t.stats.prepareDetailTopicMetrics(topicID)
 	t.collect.Add(t.assembleMetricsKey("topic_num"), float64(num))
 	t.collect.Gauge(t.assembleMetricsKey(topicID, "created_at"), float64(time.Now().Unix()))
 }
@@ -95,16 +99,16 @@ func (t *TopicAdapter) AddMessage(topicID string, num int) {
 // SubscriptionAdapter is adapter of operation metrics for Subscription
 type SubscriptionAdapter struct {
 	prefix  string
+	stats   *Stats
 	collect collect.Collector
-	forward forward.MetricsWriter
 }
 
 // GetSubscriptionAdapter return prepared SubscriptionAdapter
-func GetSubscriptionAdapter() *SubscriptionAdapter {
+func (s *Stats) GetSubscriptionAdapter() *SubscriptionAdapter {
 	return &SubscriptionAdapter{
 		prefix:  "subscription",
-		collect: collector,
-		forward: forwarder,
+		stats:   s,
+		collect: s.collector,
 	}
 }
 
@@ -118,7 +122,7 @@ func (t *SubscriptionAdapter) assembleMetricsKey(parts ...string) string {
 
 // AddSubscription send metrics the topic
 func (t *SubscriptionAdapter) AddSubscription(subID string, num int) {
-	prepareDetailSubscriptionMetrics(subID)
+	t.stats.prepareDetailSubscriptionMetrics(subID)
 	t.collect.Add(t.assembleMetricsKey("subscription_num"), float64(num))
 	t.collect.Gauge(t.assembleMetricsKey(subID, "created_at"), float64(time.Now().Unix()))
 }
@@ -129,94 +133,94 @@ func (t *SubscriptionAdapter) AddMessage(subID string, num int) {
 	t.collect.Add(t.assembleMetricsKey(subID, "message_count"), float64(num))
 }
 
+// AddFilteredMessage send metrics the message not matched the filter
+func (t *SubscriptionAdapter) AddFilteredMessage(subID string, num int) {
+	t.collect.Add(t.assembleMetricsKey(subID, "filtered_count"), float64(num))
+}
+
+// AddExpiredMessage send metrics the message deleted by exceeded the retention duration
+func (t *SubscriptionAdapter) AddExpiredMessage(subID string, num int) {
+	t.collect.Add(t.assembleMetricsKey(subID, "expired_count"), float64(num))
+}
+
 // CurrentMessages send metrics the added message
 func (t *SubscriptionAdapter) CurrentMessages(subID string, msgs []string) {
 	t.collect.Snapshot(t.assembleMetricsKey(subID, "current_messages"), msgs)
 }
 
-func prepareMetrics() {
+func (s *Stats) prepareMetrics() {
 	// NOTE: premise that following metrics keys is Counter type
 	for _, key := range getSummaryKeys() {
-		collector.Add(key, 0)
+		s.collector.Add(key, 0)
 	}
 }
 
-func prepareDetailTopicMetrics(id string) {
+func (s *Stats) prepareDetailTopicMetrics(id string) {
 	// TODO: improve
-	adapter := GetTopicAdapter()
-	collector.Gauge(adapter.assembleMetricsKey(id, "created_at"), 0)
-	collector.Add(adapter.assembleMetricsKey(id, "message_count"), 0)
+	adapter := s.GetTopicAdapter()
+	s.collector.Gauge(adapter.assembleMetricsKey(id, "created_at"), 0)
+	s.collector.Add(adapter.assembleMetricsKey(id, "message_count"), 0)
 }
 
-func prepareDetailSubscriptionMetrics(id string) {
+func (s *Stats) prepareDetailSubscriptionMetrics(id string) {
 	// TODO: improve
-	adapter := GetSubscriptionAdapter()
-	collector.Gauge(adapter.assembleMetricsKey(id, "created_at"), 0)
-	collector.Add(adapter.assembleMetricsKey(id, "message_count"), 0)
+	adapter := s.GetSubscriptionAdapter()
+	s.collector.Gauge(adapter.assembleMetricsKey(id, "created_at"), 0)
+	s.collector.Add(adapter.assembleMetricsKey(id, "message_count"), 0)
+	s.collector.Add(adapter.assembleMetricsKey(id, "filtered_count"), 0)
+	s.collector.Add(adapter.assembleMetricsKey(id, "expired_count"), 0)
 }
 
-// Summary returns summary of the all stats
-func Summary() ([]byte, error) {
-	forwarder.AddMetrics(collector.GetMetricsKeys()...)
-	err := forwarder.FlushWithKeys(getSummaryKeys()...)
+// flush returns the metrics of the keys
+func (s *Stats) flush(keys ...string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forwarder.AddMetrics(s.collector.GetMetricsKeys()...)
+	err := s.forwarder.FlushWithKeys(keys...)
 	if err != nil {
 		return nil, err
 	}
-	return buf.ReadOnce(), nil
+	return s.buf.ReadOnce(), nil
+}
+
+// Summary returns summary of the all stats
+func (s *Stats) Summary() ([]byte, error) {
+	return s.flush(getSummaryKeys()...)
 }
 
 // TopicSummary returns summary of the topic stats
-func TopicSummary() ([]byte, error) {
-	forwarder.AddMetrics(collector.GetMetricsKeys()...)
-	err := forwarder.FlushWithKeys(getTopicSummaryKeys()...)
-	if err != nil {
-		return nil, err
-	}
-	return buf.ReadOnce(), nil
+func (s *Stats) TopicSummary() ([]byte, error) {
+	return s.flush(getTopicSummaryKeys()...)
 }
 
 // SubscriptionSummary returns summary of the subscription stats
-func SubscriptionSummary() ([]byte, error) {
-	forwarder.AddMetrics(collector.GetMetricsKeys()...)
-	err := forwarder.FlushWithKeys(getSubscriptionSummaryKeys()...)
-	if err != nil {
-		return nil, err
-	}
-	return buf.ReadOnce(), nil
+func (s *Stats) SubscriptionSummary() ([]byte, error) {
+	return s.flush(getSubscriptionSummaryKeys()...)
 }
 
 // TopicDetail returns detail of the topic stats
-func TopicDetail(id string) ([]byte, error) {
-	forwarder.AddMetrics(collector.GetMetricsKeys()...)
-	err := forwarder.FlushWithKeys(getTopicDetailKeys(id)...)
-	if err != nil {
-		return nil, err
-	}
-	return buf.ReadOnce(), nil
+func (s *Stats) TopicDetail(id string) ([]byte, error) {
+	return s.flush(s.getTopicDetailKeys(id)...)
 }
 
 // SubscriptionDetail returns detail of the subscription stats
-func SubscriptionDetail(id string) ([]byte, error) {
-	forwarder.AddMetrics(collector.GetMetricsKeys()...)
-	err := forwarder.FlushWithKeys(getSubscriptionDetailKeys(id)...)
-	if err != nil {
-		return nil, err
-	}
-	return buf.ReadOnce(), nil
+func (s *Stats) SubscriptionDetail(id string) ([]byte, error) {
+	return s.flush(s.getSubscriptionDetailKeys(id)...)
 }
 
-// Initialize prepare collector and forwarder object
-func Initialize() {
-	collector = collect.NewSimpleCollector()
-	f, err := forward.NewSimpleWriter(collector, buf)
+// New return Stats prepared the collector and the forwarder
+func New() *Stats {
+	s := &Stats{
+		collector: collect.NewSimpleCollector(),
+		buf:       &buffer{},
+	}
+	f, err := forward.NewSimpleWriter(s.collector, s.buf)
 	if err != nil {
 		log.Fatal(err)
 	}
-	forwarder = f
-
-	prepareMetrics()
-}
+	s.forwarder = f
 
-func init() {
-	Initialize()
+	s.prepareMetrics()
+	return s
 }